@@ -13,17 +13,26 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"provisioning-system/internal/accesslog"
+	"provisioning-system/internal/accesspolicy"
 	"provisioning-system/internal/api"
 	"provisioning-system/internal/backup"
 	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/checkin"
 	"provisioning-system/internal/config"
 	"provisioning-system/internal/db"
+	"provisioning-system/internal/deploy"
 	"provisioning-system/internal/devicelogger"
+	"provisioning-system/internal/firmware"
 	"provisioning-system/internal/license"
 	"provisioning-system/internal/logger" // This is the custom logger package
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/phonebook"
 	"provisioning-system/internal/provisioner"
+	"provisioning-system/internal/secrets"
 	"provisioning-system/internal/tftp"
 	"provisioning-system/internal/version"
+	"provisioning-system/internal/webhook"
 )
 
 //go:embed static/*
@@ -60,18 +69,6 @@ func main() {
 	r := mux.NewRouter()
 	r.SkipClean(true)
 
-	// Раздача сгенерированных конфигов (если включено)
-	if cfg.Server.ServeConfigs {
-		configsDir := filepath.Join(*configDir, "temp_configs")
-		configFs := http.FileServer(http.Dir(configsDir))
-
-		// Оборачиваем в логгер
-		loggingHandler := deviceLogger.Middleware(http.StripPrefix("/config/", configFs))
-
-		r.PathPrefix("/config/").Handler(loggingHandler)
-		fmt.Printf("Serving generated configs at http://.../ from %s\n", configsDir)
-	}
-
 	// 5. Инициализация Provisioner Manager
 	provManager := provisioner.NewManager(cfg)
 	if err := provManager.LoadVendors(filepath.Join(*configDir, "vendors")); err != nil {
@@ -87,6 +84,79 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Шифрование паролей линий (мастер-ключ в config dir)
+	secretsBox, err := secrets.LoadKey(*configDir)
+	if err != nil {
+		log.Fatalf("Failed to load master key: %v", err)
+	}
+	provManager.Secrets = secretsBox
+	if n, err := api.EncryptStoredSecrets(database, provManager); err != nil {
+		log.Printf("Warning: Failed to encrypt stored secrets: %v", err)
+	} else if n > 0 {
+		fmt.Printf("Encrypted secrets of %d lines\n", n)
+	}
+
+	// Типизированные SIP-аккаунты строятся из линий телефонов (в т.ч. созданных до их появления)
+	if n, skipped, err := models.RebuildSIPAccounts(database); err != nil {
+		log.Printf("Warning: Failed to build SIP accounts: %v", err)
+	} else {
+		for _, c := range skipped {
+			logger.Warn("SIP account %s of domain %s is used by phones %d and %d, not indexed for phone %d", c.UserName, c.Domain, c.PhoneID, c.LinePhoneID, c.LinePhoneID)
+		}
+		fmt.Printf("SIP accounts: %d\n", n)
+	}
+
+	// MAC телефонов хранятся в каноническом виде (00:15:65:aa:bb:cc), старые записи приводятся к нему
+	macChanges, problems, err := db.CanonicalizeMACs(database)
+	if err != nil {
+		log.Printf("Warning: Failed to canonicalize MAC addresses: %v", err)
+	}
+	for _, p := range problems {
+		logger.Warn("MAC address not canonicalized: %s", p)
+	}
+	if len(macChanges) > 0 {
+		fmt.Printf("Canonicalized MAC addresses of %d phones\n", len(macChanges))
+	}
+
+	// Учет обращений устройств (last seen, прошивка, модель)
+	deviceLogger.Tracker = checkin.NewTracker(database)
+	deviceLogger.Tracker.Events = b
+
+	// Журнал обращений устройств в БД
+	accessLogStore := accesslog.NewStore(cfg, database)
+	accessLogStore.Start()
+	deviceLogger.Store = accessLogStore
+	deviceLogger.Start()
+
+	// Исходящие webhooks по системным событиям
+	webhookDispatcher := webhook.NewDispatcher(database, b)
+	webhookDispatcher.Start()
+
+	// Проверка доступа устройств к своим конфигам (access_policy домена)
+	accessChecker := accesspolicy.NewChecker(cfg, database, deviceLogger)
+
+	// Репозиторий прошивок и выбор целевой прошивки телефона для шаблонов
+	firmwareRepo := firmware.NewRepository(*configDir)
+	firmwareResolver := firmware.NewResolver(database)
+	provManager.Firmware = firmwareResolver.Loader
+	provManager.Phonebooks = phonebook.Loader(database)
+
+	// Раздача сгенерированных конфигов (если включено)
+	if cfg.Server.ServeConfigs {
+		configsDir := filepath.Join(*configDir, "temp_configs")
+		configFs := http.FileServer(http.Dir(configsDir))
+
+		// Оборачиваем в логгер
+		loggingHandler := deviceLogger.Middleware(http.StripPrefix("/config/", configFs))
+
+		r.PathPrefix("/config/").Handler(accessChecker.Middleware(loggingHandler))
+		fmt.Printf("Serving generated configs at http://.../ from %s\n", configsDir)
+
+		// Прошивки (firmware_url домена указывает сюда)
+		firmwareFs := http.StripPrefix("/firmware/", http.FileServer(http.Dir(firmwareRepo.Dir)))
+		r.PathPrefix("/firmware/").Handler(deviceLogger.Middleware(firmwareFs))
+	}
+
 	// 7. Инициализация License Manager
 	licenseManager := license.NewManager(*configDir)
 
@@ -96,7 +166,7 @@ func main() {
 	// 10. Start TFTP Server (if enabled)
 	var tftpSrv *tftp.Server
 	if cfg.Server.TFTPServer {
-		tftpSrv = tftp.NewServer(*configDir, cfg, deviceLogger)
+		tftpSrv = tftp.NewServer(*configDir, cfg, deviceLogger, accessChecker)
 		go func() {
 			if err := tftpSrv.Start(); err != nil {
 				log.Printf("TFTP Server error: %v", err)
@@ -105,10 +175,27 @@ func main() {
 	}
 
 	// 9. Инициализация API Handlers
+	// Deploys of a domain run one at a time, phone changes are coalesced (deploy_debounce)
+	deployQueue := deploy.NewQueue()
 	phoneHandler := api.NewPhoneHandler(*configDir, database, provManager)
-	debugHandler := api.NewDebugHandler(b)
+	phoneHandler.Events = b
+	phoneHandler.Queue = deployQueue
+	// Имена конфигов из MAC могли измениться: старые файлы удаляются, конфиги генерируются и доставляются заново
+	if err := phoneHandler.RegenerateCanonicalizedMACs(macChanges); err != nil {
+		log.Printf("Warning: Failed to regenerate configs of phones with canonicalized MAC addresses: %v", err)
+	}
+	debugHandler := api.NewDebugHandler(b, accessLogStore)
+	debugHandler.Dropped = deviceLogger.Dropped
+	eventsHandler := api.NewEventsHandler(b)
+	webhookHandler := api.NewWebhookHandler(database, webhookDispatcher)
 	migrationHandler := api.NewMigrationHandler(database)
+	migrationHandler.ProvManager = provManager
 	sysHandler := api.NewSystemHandler(*configDir, &cfg, provManager, database, backupManager, licenseManager, *logFile, tftpSrv)
+	sysHandler.Events = b
+	sysHandler.Queue = deployQueue
+	firmwareHandler := api.NewFirmwareHandler(*configDir, database, provManager, firmwareRepo, firmwareResolver)
+	firmwareHandler.Events = b
+	firmwareHandler.Phones = phoneHandler
 
 	// API Routes
 	apiRouter := r.PathPrefix("/api").Subrouter()
@@ -128,7 +215,14 @@ func main() {
 	protected.HandleFunc("/system/reload", sysHandler.Reload).Methods("POST")
 	protected.HandleFunc("/system/apply", sysHandler.ApplyConfig).Methods("POST")
 	protected.HandleFunc("/domains", sysHandler.GetDomains).Methods("GET")
+	protected.HandleFunc("/domains/{domain}/numbers", phoneHandler.GetNumbers).Methods("GET")
+	protected.HandleFunc("/domains/{domain}/rotate-passwords", phoneHandler.RotatePasswords).Methods("POST")
 	protected.HandleFunc("/deploy", sysHandler.Deploy).Methods("POST")
+	protected.HandleFunc("/deploy/queue", sysHandler.GetDeployQueue).Methods("GET")
+	protected.HandleFunc("/deploy/queue/flush", sysHandler.FlushDeployQueue).Methods("POST")
+	protected.HandleFunc("/deploy/runs", sysHandler.GetDeployRuns).Methods("GET")
+	protected.HandleFunc("/deploy/runs/{id}", sysHandler.GetDeployRun).Methods("GET")
+	protected.HandleFunc("/deploy/runs/{id}/retry", sysHandler.RetryDeployRun).Methods("POST")
 
 	protected.HandleFunc("/system/backups/create/db", sysHandler.CreateDBBackup).Methods("POST")
 	protected.HandleFunc("/system/backups/create/cfg", sysHandler.CreateConfigBackup).Methods("POST")
@@ -154,16 +248,64 @@ func main() {
 
 	protected.HandleFunc("/phones", phoneHandler.CreatePhone).Methods("POST")
 	protected.HandleFunc("/phones", phoneHandler.GetPhones).Methods("GET")
+	protected.HandleFunc("/phones/resync", phoneHandler.ResyncPhones).Methods("POST")
 	protected.HandleFunc("/phones/{id}", phoneHandler.UpdatePhone).Methods("PUT")
+	protected.HandleFunc("/phones/{id}/resync", phoneHandler.ResyncPhone).Methods("POST")
+	protected.HandleFunc("/phones/{id}/actions", phoneHandler.GetPhoneActions).Methods("GET")
+	protected.HandleFunc("/phones/{id}/variables", phoneHandler.GetPhoneVariables).Methods("GET")
+	protected.HandleFunc("/phones/{id}/remote-actions", phoneHandler.GetRemoteActions).Methods("GET")
+	protected.HandleFunc("/phones/{id}/remote-actions/{action}", phoneHandler.RunRemoteAction).Methods("POST")
 	protected.HandleFunc("/phones/{id}", phoneHandler.DeletePhone).Methods("DELETE")
+	protected.HandleFunc("/sip-accounts", phoneHandler.GetSIPAccounts).Methods("GET")
+	protected.HandleFunc("/mac/{mac}", phoneHandler.LookupMAC).Methods("GET")
+	protected.HandleFunc("/phonebooks", phoneHandler.GetPhonebooks).Methods("GET")
+	protected.HandleFunc("/phonebooks", phoneHandler.CreatePhonebook).Methods("POST")
+	protected.HandleFunc("/phonebooks/{id}", phoneHandler.UpdatePhonebook).Methods("PUT")
+	protected.HandleFunc("/phonebooks/{id}", phoneHandler.DeletePhonebook).Methods("DELETE")
+	protected.HandleFunc("/phonebooks/{id}/contacts", phoneHandler.GetContacts).Methods("GET")
+	protected.HandleFunc("/phonebooks/{id}/contacts", phoneHandler.CreateContact).Methods("POST")
+	protected.HandleFunc("/phonebooks/{id}/import", phoneHandler.ImportContacts).Methods("POST")
+	protected.HandleFunc("/contacts/{id}", phoneHandler.UpdateContact).Methods("PUT")
+	protected.HandleFunc("/contacts/{id}", phoneHandler.DeleteContact).Methods("DELETE")
+	protected.HandleFunc("/domains/{domain}/directory", phoneHandler.GetDirectory).Methods("GET")
+	protected.HandleFunc("/profiles", phoneHandler.GetProfiles).Methods("GET")
+	protected.HandleFunc("/profiles", phoneHandler.CreateProfile).Methods("POST")
+	protected.HandleFunc("/profiles/{id}", phoneHandler.GetProfile).Methods("GET")
+	protected.HandleFunc("/profiles/{id}", phoneHandler.UpdateProfile).Methods("PUT")
+	protected.HandleFunc("/profiles/{id}", phoneHandler.DeleteProfile).Methods("DELETE")
+
+	protected.HandleFunc("/unprovisioned", phoneHandler.GetUnprovisioned).Methods("GET")
+	protected.HandleFunc("/unprovisioned/{id}/claim", phoneHandler.ClaimUnprovisioned).Methods("POST")
+	protected.HandleFunc("/unprovisioned/{id}", phoneHandler.DeleteUnprovisioned).Methods("DELETE")
 
 	protected.HandleFunc("/vendors", phoneHandler.GetVendors).Methods("GET")
 	protected.HandleFunc("/models", phoneHandler.GetModels).Methods("GET")
 
+	protected.HandleFunc("/firmware", firmwareHandler.GetFirmware).Methods("GET")
+	protected.HandleFunc("/firmware", firmwareHandler.UploadFirmware).Methods("POST")
+	protected.HandleFunc("/firmware/policies", firmwareHandler.GetPolicies).Methods("GET")
+	protected.HandleFunc("/firmware/policies", firmwareHandler.CreatePolicy).Methods("POST")
+	protected.HandleFunc("/firmware/policies/{id}", firmwareHandler.UpdatePolicy).Methods("PUT")
+	protected.HandleFunc("/firmware/policies/{id}", firmwareHandler.DeletePolicy).Methods("DELETE")
+	protected.HandleFunc("/firmware/policies/{id}/status", firmwareHandler.GetPolicyStatus).Methods("GET")
+	protected.HandleFunc("/firmware/{id}", firmwareHandler.UpdateFirmware).Methods("PUT")
+	protected.HandleFunc("/firmware/{id}", firmwareHandler.DeleteFirmware).Methods("DELETE")
+
 	protected.HandleFunc("/migration/apply", migrationHandler.ApplyMigration).Methods("POST")
 
 	// Debug API (SSE)
 	protected.HandleFunc("/debug/logs", debugHandler.StreamLogs).Methods("GET")
+	protected.HandleFunc("/device-logs", debugHandler.GetDeviceLogs).Methods("GET")
+
+	// System events (SSE)
+	protected.HandleFunc("/events", eventsHandler.StreamEvents).Methods("GET")
+
+	protected.HandleFunc("/webhooks", webhookHandler.GetWebhooks).Methods("GET")
+	protected.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	protected.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET")
+	protected.HandleFunc("/webhooks/deliveries/{id}/redeliver", webhookHandler.Redeliver).Methods("POST")
 
 	// Serve Vendor Static Files (Images, etc.)
 	vendorsDir := filepath.Join(*configDir, "vendors")
@@ -201,6 +343,10 @@ func main() {
 
 		// 2. Universal Config Serving (Fallback for configs)
 		if cfg.Server.ServeConfigs {
+			if !accessChecker.Enforce(w, r) {
+				return
+			}
+
 			configsDir := filepath.Join(*configDir, "temp_configs")
 
 			// 2a. Check default domain (first in config)
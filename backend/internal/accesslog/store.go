@@ -0,0 +1,256 @@
+package accesslog
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/useragent"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultRetentionDays = 30
+	DefaultMaxRows       = 100000
+
+	queueSize     = 1000
+	batchSize     = 100
+	flushInterval = time.Second
+	pruneInterval = time.Hour
+)
+
+// Store persists device access events in the device_access_logs table.
+// Events are queued and written in batches by a single goroutine, so device requests never wait for SQLite.
+type Store struct {
+	Config  *config.SystemConfig
+	DB      *gorm.DB
+	queue   chan models.DeviceAccessLog
+	dropped atomic.Int64
+}
+
+func NewStore(cfg *config.SystemConfig, database *gorm.DB) *Store {
+	return &Store{
+		Config: cfg,
+		DB:     database,
+		queue:  make(chan models.DeviceAccessLog, queueSize),
+	}
+}
+
+// Start runs the writer and the retention loop
+func (s *Store) Start() {
+	go s.run()
+}
+
+// Save queues an event for storage. If the queue is full the event is dropped (and counted).
+func (s *Store) Save(event broadcaster.LogEvent) {
+	mac := macaddr.FromFilename(event.RequestedFile)
+	if mac == "" {
+		mac = useragent.Parse(event.UserAgent).MAC
+	}
+
+	entry := models.DeviceAccessLog{
+		Time:          event.Time,
+		SourceIP:      event.SourceIP,
+		MacAddress:    mac,
+		StatusCode:    event.StatusCode,
+		Method:        event.Method,
+		RequestedFile: event.RequestedFile,
+		UserAgent:     event.UserAgent,
+		Message:       event.Message,
+	}
+
+	select {
+	case s.queue <- entry:
+	default:
+		if dropped := s.dropped.Add(1); dropped%100 == 1 {
+			logger.Warn("Device access log queue is full, events are being dropped (%d since start)", dropped)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was full
+func (s *Store) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Store) run() {
+	flush := time.NewTicker(flushInterval)
+	prune := time.NewTicker(pruneInterval)
+	defer flush.Stop()
+	defer prune.Stop()
+
+	s.Prune()
+
+	batch := make([]models.DeviceAccessLog, 0, batchSize)
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.DB.CreateInBatches(batch, batchSize).Error; err != nil {
+			logger.Error("Failed to store device access log: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-s.queue:
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				write()
+			}
+		case <-flush.C:
+			write()
+		case <-prune.C:
+			s.Prune()
+		}
+	}
+}
+
+// Prune applies the retention settings: drops entries older than device_log_retention_days
+// and keeps at most device_log_max_rows newest entries
+func (s *Store) Prune() {
+	retentionDays := s.Config.Server.DeviceLogRetentionDays
+	if retentionDays == 0 {
+		retentionDays = DefaultRetentionDays
+	}
+	maxRows := s.Config.Server.DeviceLogMaxRows
+	if maxRows == 0 {
+		maxRows = DefaultMaxRows
+	}
+
+	if retentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -retentionDays)
+		if err := s.DB.Where("time < ?", cutoff).Delete(&models.DeviceAccessLog{}).Error; err != nil {
+			logger.Warn("Failed to prune device access log: %v", err)
+		}
+	}
+
+	if maxRows > 0 {
+		var maxID uint
+		s.DB.Model(&models.DeviceAccessLog{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID)
+		if maxID > uint(maxRows) {
+			if err := s.DB.Where("id <= ?", maxID-uint(maxRows)).Delete(&models.DeviceAccessLog{}).Error; err != nil {
+				logger.Warn("Failed to prune device access log: %v", err)
+			}
+		}
+	}
+}
+
+// Page size of Query: default and maximum
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter for Query. Empty fields are ignored.
+type Filter struct {
+	IP     string
+	MAC    string
+	Status string // Exact code ("404") or class ("4xx")
+	Path   string // Glob with "*"
+	Method string
+	From   time.Time
+	To     time.Time
+	Page   int
+	Limit  int
+}
+
+// Query returns the newest entries matching the filter and the total number of matches
+func (s *Store) Query(f Filter) ([]models.DeviceAccessLog, int64, error) {
+	query := s.DB.Model(&models.DeviceAccessLog{})
+
+	if f.IP != "" {
+		query = query.Where("source_ip = ?", f.IP)
+	}
+	if f.MAC != "" {
+		mac := macaddr.Normalize(f.MAC)
+		if mac == "" {
+			mac = strings.ToLower(f.MAC)
+		}
+		query = query.Where("mac_address = ?", mac)
+	}
+	if f.Status != "" {
+		if lo, hi, ok := StatusRange(f.Status); ok {
+			query = query.Where("status_code >= ? AND status_code <= ?", lo, hi)
+		}
+	}
+	if f.Path != "" {
+		query = query.Where("requested_file LIKE ?", strings.ReplaceAll(f.Path, "*", "%"))
+	}
+	if f.Method != "" {
+		query = query.Where("method = ?", strings.ToUpper(f.Method))
+	}
+	if !f.From.IsZero() {
+		query = query.Where("time >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("time <= ?", f.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.Limit < 1 {
+		f.Limit = DefaultLimit
+	}
+	if f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+
+	var entries []models.DeviceAccessLog
+	err := query.Order("id desc").Limit(f.Limit).Offset((f.Page - 1) * f.Limit).Find(&entries).Error
+	return entries, total, err
+}
+
+// Recent returns the last n events in chronological order (used to replay history to SSE clients)
+func (s *Store) Recent(n int) ([]broadcaster.LogEvent, error) {
+	var entries []models.DeviceAccessLog
+	if err := s.DB.Order("id desc").Limit(n).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]broadcaster.LogEvent, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		events = append(events, broadcaster.LogEvent{
+			Time:          e.Time,
+			SourceIP:      e.SourceIP,
+			StatusCode:    e.StatusCode,
+			RequestedFile: e.RequestedFile,
+			Method:        e.Method,
+			UserAgent:     e.UserAgent,
+			Message:       e.Message,
+		})
+	}
+	return events, nil
+}
+
+// StatusRange parses "404" or "4xx" into an inclusive range of status codes
+func StatusRange(s string) (int, int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err != nil {
+			return 0, 0, false
+		}
+		return class * 100, class*100 + 99, true
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, false
+	}
+	return code, code, true
+}
@@ -0,0 +1,74 @@
+package accesslog
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestQueryAndPrune(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	cfg := &config.SystemConfig{}
+	cfg.Server.DeviceLogMaxRows = 3
+	s := NewStore(cfg, database)
+
+	now := time.Now()
+	entries := []models.DeviceAccessLog{
+		{Time: now.AddDate(0, 0, -60), SourceIP: "10.0.0.1", StatusCode: 200, Method: "GET", RequestedFile: "/old.cfg"},
+		{Time: now, SourceIP: "10.0.0.5", MacAddress: "001565aabbcc", StatusCode: 200, Method: "GET", RequestedFile: "/001565aabbcc.cfg"},
+		{Time: now, SourceIP: "10.0.0.5", StatusCode: 404, Method: "GET", RequestedFile: "/y000000000108.cfg"},
+		{Time: now, SourceIP: "10.0.0.9", StatusCode: 403, Method: "GET", RequestedFile: "/001565112233.cfg"},
+		{Time: now, SourceIP: "10.0.0.9", StatusCode: 200, Method: "HEAD", RequestedFile: "/directory.xml"},
+	}
+	if err := database.Create(&entries).Error; err != nil {
+		t.Fatalf("Failed to create entries: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int64
+	}{
+		{"all", Filter{}, 5},
+		{"ip", Filter{IP: "10.0.0.5"}, 2},
+		{"mac", Filter{MAC: "00:15:65:AA:BB:CC"}, 1},
+		{"status class", Filter{Status: "4xx"}, 2},
+		{"status code", Filter{Status: "404"}, 1},
+		{"path glob", Filter{Path: "/001565*"}, 2},
+		{"method", Filter{Method: "head"}, 1},
+		{"from", Filter{From: now.Add(-time.Hour)}, 4},
+	}
+	for _, tt := range tests {
+		_, total, err := s.Query(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", tt.name, err)
+		}
+		if total != tt.want {
+			t.Errorf("%s: expected %d entries, got %d", tt.name, tt.want, total)
+		}
+	}
+
+	// Retention removes the 60-day-old entry, max rows keeps the 3 newest
+	s.Prune()
+	var count int64
+	database.Model(&models.DeviceAccessLog{}).Count(&count)
+	if count != 3 {
+		t.Errorf("expected 3 entries after prune, got %d", count)
+	}
+
+	recent, err := s.Recent(2)
+	if err != nil {
+		t.Fatalf("Recent failed: %v", err)
+	}
+	if len(recent) != 2 || recent[1].RequestedFile != "/directory.xml" {
+		t.Errorf("Recent returned unexpected events: %+v", recent)
+	}
+}
@@ -0,0 +1,147 @@
+package accesspolicy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/devicelogger"
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/useragent"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ModeOff    = "off"
+	ModeAlert  = "alert"
+	ModeReject = "reject"
+)
+
+// Decision is the result of checking one device request against the domain policy
+type Decision struct {
+	Mode       string
+	Phone      *models.Phone
+	Violations []string
+}
+
+// Allowed reports whether the file may be served
+func (d Decision) Allowed() bool {
+	return len(d.Violations) == 0 || d.Mode != ModeReject
+}
+
+// Checker verifies that the device fetching <mac>.cfg is the device that owns it
+type Checker struct {
+	Config       *config.SystemConfig
+	DB           *gorm.DB
+	DeviceLogger *devicelogger.DeviceLogger
+}
+
+func NewChecker(cfg *config.SystemConfig, database *gorm.DB, dl *devicelogger.DeviceLogger) *Checker {
+	return &Checker{
+		Config:       cfg,
+		DB:           database,
+		DeviceLogger: dl,
+	}
+}
+
+// Check evaluates an HTTP request for requestedFile coming from sourceIP.
+// Files without a MAC in the name, and MACs unknown to the DB, are not restricted.
+func (c *Checker) Check(requestedFile, sourceIP, userAgent string) Decision {
+	return c.check(requestedFile, sourceIP, userAgent, true)
+}
+
+// CheckTFTP evaluates a TFTP request. TFTP has no User-Agent, so only the IP part of the policy applies.
+func (c *Checker) CheckTFTP(requestedFile, sourceIP string) Decision {
+	return c.check(requestedFile, sourceIP, "", false)
+}
+
+func (c *Checker) check(requestedFile, sourceIP, userAgent string, hasUserAgent bool) Decision {
+	decision := Decision{Mode: ModeOff}
+
+	mac := macaddr.FromFilename(requestedFile)
+	if mac == "" {
+		return decision
+	}
+
+	phone, err := db.FindPhoneByMAC(c.DB, mac)
+	if err != nil {
+		return decision
+	}
+	decision.Phone = phone
+
+	policy := c.Config.GetEffectiveDomainConfig(phone.Domain).AccessPolicy
+	if policy.Mode == "" || policy.Mode == ModeOff {
+		return decision
+	}
+	decision.Mode = policy.Mode
+
+	if policy.CheckUserAgent && hasUserAgent {
+		uaMAC := useragent.Parse(userAgent).MAC
+		if uaMAC == "" {
+			if policy.RequireUserAgentMAC {
+				decision.Violations = append(decision.Violations, "no MAC in User-Agent")
+			}
+		} else if uaMAC != mac {
+			decision.Violations = append(decision.Violations, fmt.Sprintf("User-Agent MAC %s does not match %s", uaMAC, mac))
+		}
+	}
+
+	if policy.CheckIP && phone.IPAddress != "" && sourceIP != phone.IPAddress {
+		decision.Violations = append(decision.Violations, fmt.Sprintf("source IP %s does not match phone IP %s", sourceIP, phone.IPAddress))
+	}
+
+	return decision
+}
+
+// Message formats the violations for the device log
+func (d Decision) Message() string {
+	action := "alert"
+	if d.Mode == ModeReject {
+		action = "rejected"
+	}
+	return fmt.Sprintf("Access policy %s: %s", action, strings.Join(d.Violations, "; "))
+}
+
+// Status returns the device log status for a decision with violations
+func (d Decision) Status() int {
+	if d.Mode == ModeReject {
+		return devicelogger.StatusAccessDenied
+	}
+	return devicelogger.StatusAccessAlert
+}
+
+// Enforce checks an HTTP request, logs violations and writes a 403 if the request is rejected.
+// Returns false if the caller must not serve the file.
+func (c *Checker) Enforce(w http.ResponseWriter, r *http.Request) bool {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	decision := c.Check(r.URL.Path, ip, r.UserAgent())
+	if len(decision.Violations) == 0 {
+		return true
+	}
+
+	c.DeviceLogger.LogCustom(r, decision.Status(), decision.Message())
+	if !decision.Allowed() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Middleware enforces the policy in front of a config file server
+func (c *Checker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Enforce(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package accesspolicy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestCheck(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	mac := "00:15:65:AA:BB:CC"
+	if err := database.Create(&models.Phone{Domain: "office", MacAddress: &mac, IPAddress: "10.0.0.5"}).Error; err != nil {
+		t.Fatalf("Failed to create phone: %v", err)
+	}
+
+	cfg := &config.SystemConfig{
+		Domains: []config.DomainSettings{
+			{
+				Name: "office",
+				AccessPolicy: config.AccessPolicy{
+					Mode:           ModeReject,
+					CheckUserAgent: true,
+					CheckIP:        true,
+				},
+			},
+		},
+	}
+	c := NewChecker(cfg, database, nil)
+
+	tests := []struct {
+		name       string
+		file, ip   string
+		ua         string
+		violations int
+	}{
+		{"owner", "/001565aabbcc.cfg", "10.0.0.5", "Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc", 0},
+		{"other device", "/001565aabbcc.cfg", "10.0.0.5", "Yealink SIP-T46U 108.86.0.45 00:15:65:11:22:33", 1},
+		{"other ip", "/001565aabbcc.cfg", "10.0.0.99", "Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc", 1},
+		{"scraper", "/001565aabbcc.cfg", "10.0.0.99", "Yealink SIP-T46U 108.86.0.45 00:15:65:11:22:33", 2},
+		{"generic file", "/y000000000108.cfg", "10.0.0.99", "curl/8.4.0", 0},
+		{"unknown mac", "/001565ffffff.cfg", "10.0.0.99", "curl/8.4.0", 0},
+	}
+
+	for _, tt := range tests {
+		d := c.Check(tt.file, tt.ip, tt.ua)
+		if len(d.Violations) != tt.violations {
+			t.Errorf("%s: expected %d violations, got %v", tt.name, tt.violations, d.Violations)
+		}
+		if d.Allowed() != (tt.violations == 0) {
+			t.Errorf("%s: unexpected Allowed() = %v", tt.name, d.Allowed())
+		}
+	}
+
+	// TFTP requests are only checked by IP
+	if d := c.CheckTFTP("/001565aabbcc.cfg", "10.0.0.5"); len(d.Violations) != 0 {
+		t.Errorf("TFTP from owner IP: unexpected violations %v", d.Violations)
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+	"provisioning-system/internal/secrets"
+
+	"github.com/glebarez/sqlite"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// bundleSecretKeys are the yaml keys whose values are masked in support bundles
+var bundleSecretKeys = map[string]bool{
+	"password":       true,
+	"admin_password": true,
+	"secret_key":     true,
+	"secret":         true,
+	"token":          true,
+}
+
+// bundleSkipped reports whether a file of the config dir must not go to a support bundle:
+// the master key, generated configs (they contain passwords in clear), databases and backups
+func bundleSkipped(rel string, info os.FileInfo, backupDir string) bool {
+	name := info.Name()
+	if info.IsDir() {
+		return rel == "temp_configs" || (backupDir != "" && rel == backupDir)
+	}
+	if name == secrets.KeyFile || strings.HasSuffix(name, ".zip") {
+		return true
+	}
+	for _, suffix := range []string{".db", ".db-wal", ".db-shm", ".db-journal"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addRedactedConfigDir adds the config dir to the bundle, secret values of yaml files are masked
+func addRedactedConfigDir(zw *zip.Writer, configDir, backupDir, prefix string) error {
+	if rel, err := filepath.Rel(configDir, backupDir); err == nil && !strings.HasPrefix(rel, "..") {
+		backupDir = rel
+	} else {
+		backupDir = ""
+	}
+
+	return filepath.Walk(configDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(configDir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && bundleSkipped(rel, info, backupDir) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+			data = redactYAML(data)
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		header.Method = zip.Deflate
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	})
+}
+
+// redactYAML masks string values of secret keys. Files that cannot be parsed are returned as is.
+func redactYAML(data []byte) []byte {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return data
+	}
+	if !redactNode(&doc) {
+		return data
+	}
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func redactNode(node *yaml.Node) bool {
+	changed := false
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if bundleSecretKeys[strings.ToLower(key.Value)] && value.Kind == yaml.ScalarNode && value.Tag == "!!str" && value.Value != "" {
+				value.Value = secrets.Mask
+				value.Style = 0
+				changed = true
+			}
+		}
+	}
+	for _, child := range node.Content {
+		if redactNode(child) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// addRedactedDatabase adds a snapshot of the database to the bundle. Secret line params
+// and webhook secrets are masked in the snapshot, the live database is not changed.
+func addRedactedDatabase(zw *zip.Writer, db *gorm.DB, pm *provisioner.Manager, nameInZip string) error {
+	tempDir, err := os.MkdirTemp("", "support_bundle_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	snapshot := filepath.Join(tempDir, "provisioning.db")
+	if err := db.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return fmt.Errorf("failed to create db snapshot: %w", err)
+	}
+
+	if err := redactDatabase(snapshot, pm); err != nil {
+		return err
+	}
+
+	file, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	header := &zip.FileHeader{Name: nameInZip, Method: zip.Deflate}
+	header.Modified = time.Now()
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+func redactDatabase(path string, pm *provisioner.Manager) error {
+	snap, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to open db snapshot: %w", err)
+	}
+	if sqlDB, err := snap.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	// All rows, including lines detached from their phone by updates: without a vendor
+	// only encrypted values are recognized (and masked)
+	var phones []models.Phone
+	if err := snap.Select("id", "vendor").Find(&phones).Error; err != nil {
+		return err
+	}
+	phoneVendors := make(map[uint]string, len(phones))
+	for _, p := range phones {
+		phoneVendors[p.ID] = p.Vendor
+	}
+	var lines []models.PhoneLine
+	if err := snap.Find(&lines).Error; err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if masked := pm.MaskInfo(phoneVendors[l.PhoneID], l.Type, l.AdditionalInfo); masked != l.AdditionalInfo {
+			if err := snap.Model(&models.PhoneLine{}).Where("id = ?", l.ID).Update("additional_info", masked).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var profiles []models.Profile
+	if err := snap.Select("id", "vendor").Find(&profiles).Error; err != nil {
+		return err
+	}
+	profileVendors := make(map[uint]string, len(profiles))
+	for _, p := range profiles {
+		profileVendors[p.ID] = p.Vendor
+	}
+	var profileLines []models.ProfileLine
+	if err := snap.Find(&profileLines).Error; err != nil {
+		return err
+	}
+	for _, l := range profileLines {
+		if masked := pm.MaskInfo(profileVendors[l.ProfileID], l.Type, l.AdditionalInfo); masked != l.AdditionalInfo {
+			if err := snap.Model(&models.ProfileLine{}).Where("id = ?", l.ID).Update("additional_info", masked).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Typed accounts hold a copy of the line password
+	if err := snap.Model(&models.SIPAccount{}).Where("password <> ''").Update("password", secrets.Mask).Error; err != nil {
+		return err
+	}
+	if err := snap.Model(&models.Webhook{}).Where("secret <> ''").Update("secret", secrets.Mask).Error; err != nil {
+		return err
+	}
+	// History: rendered deploy commands, their output, event payloads and action URLs may hold
+	// decrypted passwords (runs recorded before secrets were masked in them, passwords in URLs)
+	if err := snap.Model(&models.DeployRun{}).Where("1 = 1").Updates(map[string]interface{}{
+		"commands": "[]",
+		"output":   gorm.Expr("CASE WHEN output <> '' THEN ? ELSE '' END", secrets.Mask),
+		"error":    gorm.Expr("CASE WHEN error <> '' THEN ? ELSE '' END", secrets.Mask),
+		"result":   "",
+	}).Error; err != nil {
+		return err
+	}
+	if err := snap.Model(&models.WebhookDelivery{}).Where("payload <> ''").Update("payload", secrets.Mask).Error; err != nil {
+		return err
+	}
+	if err := snap.Model(&models.PhoneActionLog{}).Where("1 = 1").Updates(map[string]interface{}{
+		"address": gorm.Expr("CASE WHEN address <> '' THEN ? ELSE '' END", secrets.Mask),
+		"reason":  gorm.Expr("CASE WHEN reason <> '' THEN ? ELSE '' END", secrets.Mask),
+		"error":   gorm.Expr("CASE WHEN error <> '' THEN ? ELSE '' END", secrets.Mask),
+	}).Error; err != nil {
+		return err
+	}
+	// Free pages still hold the clear values
+	return snap.Exec("VACUUM").Error
+}
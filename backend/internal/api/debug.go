@@ -3,49 +3,216 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"provisioning-system/internal/accesslog"
 	"provisioning-system/internal/broadcaster"
 )
 
 type DebugHandler struct {
 	Broadcaster *broadcaster.Broadcaster
+	Store       *accesslog.Store
+	Dropped     func() int64 // Optional: number of access events not stored (sinks too slow)
 }
 
-func NewDebugHandler(b *broadcaster.Broadcaster) *DebugHandler {
+func NewDebugHandler(b *broadcaster.Broadcaster, store *accesslog.Store) *DebugHandler {
 	return &DebugHandler{
 		Broadcaster: b,
+		Store:       store,
 	}
 }
 
+// logStreamFilter is a server-side filter for the SSE log stream
+type logStreamFilter struct {
+	IP       string
+	Network  *net.IPNet
+	StatusLo int
+	StatusHi int
+	Path     *regexp.Regexp
+	Method   string
+}
+
+// parseLogStreamFilter reads filters from query params: ip, cidr, status (404 or 4xx), path (glob), method
+func parseLogStreamFilter(q url.Values) (*logStreamFilter, error) {
+	f := &logStreamFilter{
+		IP:     q.Get("ip"),
+		Method: strings.ToUpper(q.Get("method")),
+	}
+	if cidr := q.Get("cidr"); cidr != "" {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr: %v", err)
+		}
+		f.Network = network
+	}
+	if status := q.Get("status"); status != "" {
+		lo, hi, ok := accesslog.StatusRange(status)
+		if !ok {
+			return nil, fmt.Errorf("invalid status %q, expected code (404) or class (4xx)", status)
+		}
+		f.StatusLo, f.StatusHi = lo, hi
+	}
+	if glob := q.Get("path"); glob != "" {
+		pattern := regexp.QuoteMeta(glob)
+		pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+		pattern = strings.ReplaceAll(pattern, `\?`, ".")
+		f.Path = regexp.MustCompile("(?i)^" + pattern + "$")
+	}
+	return f, nil
+}
+
+// Match reports whether the event passes the filter
+func (f *logStreamFilter) Match(event broadcaster.LogEvent) bool {
+	if f.IP != "" && event.SourceIP != f.IP {
+		return false
+	}
+	if f.Network != nil {
+		ip := net.ParseIP(event.SourceIP)
+		if ip == nil || !f.Network.Contains(ip) {
+			return false
+		}
+	}
+	if f.StatusHi > 0 && (event.StatusCode < f.StatusLo || event.StatusCode > f.StatusHi) {
+		return false
+	}
+	if f.Path != nil && !f.Path.MatchString(event.RequestedFile) {
+		return false
+	}
+	if f.Method != "" && event.Method != f.Method {
+		return false
+	}
+	return true
+}
+
 // StreamLogs handles GET /api/debug/logs (SSE)
+// Query params:
+//   - ip, cidr, status (404 or 4xx), path (glob), method - server-side filters
+//   - replay - number of stored events to send before live events (ignored when resuming)
+//   - last_event_id - same as the Last-Event-ID header, for clients that reconnect manually
+//
+// Besides log events (default "message" type, with "id:") the stream carries
+// "heartbeat" events, "dropped" events with the number of events the client has missed
+// and a "reset" event if the Last-Event-ID is unknown (see StreamEvents).
 func (h *DebugHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	filter, err := parseLogStreamFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastID, reset := parseLastEventID(r, h.Broadcaster)
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Subscribe to logs
-	logChan := h.Broadcaster.Subscribe()
-	defer h.Broadcaster.Unsubscribe(logChan)
-
-	// Notify client of connection
-	fmt.Fprintf(w, "data: %s\n\n", "connected")
-	w.(http.Flusher).Flush()
-
-	// Loop to send events
-	for {
-		select {
-		case event := <-logChan:
-			data, err := json.Marshal(event)
-			if err != nil {
-				continue
+	sub, history, missed := h.Broadcaster.SubscribeFrom(lastID, broadcaster.TypeDeviceAccess)
+	defer h.Broadcaster.Unsubscribe(sub)
+
+	send := func(event broadcaster.Event) {
+		logEvent, ok := event.Data.(broadcaster.LogEvent)
+		if !ok || !filter.Match(logEvent) {
+			return
+		}
+		logEvent.ID = event.ID
+		stream.Send(h.Broadcaster.EventID(event.ID), "", logEvent)
+	}
+
+	// Replay history from the DB (only on a fresh connection)
+	if n, _ := strconv.Atoi(r.URL.Query().Get("replay")); n > 0 && lastID == 0 && h.Store != nil {
+		if n > 1000 {
+			n = 1000
+		}
+		if stored, err := h.Store.Recent(n); err == nil {
+			for _, logEvent := range stored {
+				if filter.Match(logEvent) {
+					stream.Send("", "", logEvent)
+				}
 			}
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			w.(http.Flusher).Flush()
-		case <-r.Context().Done():
+		}
+	}
+
+	if reset {
+		stream.Reset()
+	}
+	stream.Run(r, sub, history, missed, send)
+}
+
+// GetDeviceLogs handles GET /api/device-logs
+// Query params: ip, mac, status (404 or 4xx), path (glob), method, from, to (RFC3339), page, limit (max 1000)
+// "dropped" in the response is the number of events not stored since start because the log was too slow.
+func (h *DebugHandler) GetDeviceLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := accesslog.Filter{
+		IP:     q.Get("ip"),
+		MAC:    q.Get("mac"),
+		Status: q.Get("status"),
+		Path:   q.Get("path"),
+		Method: q.Get("method"),
+		Page:   1,
+		Limit:  100,
+	}
+	if from := q.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			http.Error(w, "Invalid 'from' time, expected RFC3339", http.StatusBadRequest)
 			return
 		}
+		filter.From = t
 	}
+	if to := q.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			http.Error(w, "Invalid 'to' time, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.To = t
+	}
+	if p := q.Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid 'page'", http.StatusBadRequest)
+			return
+		}
+		filter.Page = n
+	}
+	filter.Limit = accesslog.DefaultLimit
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid 'limit'", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(n, accesslog.MaxLimit)
+	}
+
+	var dropped int64
+	if h.Dropped != nil {
+		dropped = h.Dropped()
+	}
+
+	entries, total, err := h.Store.Query(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query device logs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"logs":    entries,
+		"total":   total,
+		"page":    filter.Page,
+		"limit":   filter.Limit,
+		"dropped": dropped,
+	})
 }
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+
+	"provisioning-system/internal/broadcaster"
+)
+
+func TestLogStreamFilter(t *testing.T) {
+	event := broadcaster.LogEvent{
+		SourceIP:      "10.0.0.5",
+		StatusCode:    404,
+		RequestedFile: "/001565aabbcc.cfg",
+		Method:        "GET",
+	}
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"ip=10.0.0.5", true},
+		{"ip=10.0.0.6", false},
+		{"cidr=10.0.0.0/24", true},
+		{"cidr=192.168.0.0/16", false},
+		{"status=4xx", true},
+		{"status=404", true},
+		{"status=2xx", false},
+		{"path=*.cfg", true},
+		{"path=/001565*", true},
+		{"path=*.xml", false},
+		{"method=get", true},
+		{"method=HEAD", false},
+		{"cidr=10.0.0.0/8&status=4xx&path=*.CFG", true},
+	}
+
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		f, err := parseLogStreamFilter(q)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.query, err)
+		}
+		if got := f.Match(event); got != tt.match {
+			t.Errorf("%q: Match() = %v, want %v", tt.query, got, tt.match)
+		}
+	}
+
+	for _, bad := range []string{"cidr=10.0.0.0", "status=abc"} {
+		q, _ := url.ParseQuery(bad)
+		if _, err := parseLogStreamFilter(q); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
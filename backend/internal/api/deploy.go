@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/deploy"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// hookRunner runs deploy/delete hooks of a domain, records every run in the deploy history
+// and publishes deploy.result
+type hookRunner struct {
+	ConfigDir string
+	DB        *gorm.DB
+	Events    *broadcaster.Broadcaster
+	// ProvManager decrypts the secrets of the phone for command templates, they are masked
+	// in the recorded run and the published result (optional)
+	ProvManager *provisioner.Manager
+}
+
+// run executes the hooks selected by origin.Action: targets are synced for both actions,
+// commands are DeployCommands or DeleteCommands. Returns a nil run if the domain has nothing to run.
+func (k hookRunner) run(ctx context.Context, domainName string, domainCfg config.DomainSettings, origin deploy.Origin, phone *models.Phone, dryRun, force bool) (*deploy.Result, *models.DeployRun, error) {
+	commands := domainCfg.DeployCommands
+	if origin.Action == models.DeployActionDelete {
+		commands = domainCfg.DeleteCommands
+	}
+	if len(commands) == 0 && len(domainCfg.DeployTargets) == 0 {
+		return nil, nil, nil
+	}
+	req := deploy.Request{
+		Domain:   domainName,
+		Targets:  domainCfg.DeployTargets,
+		Commands: commands,
+		Phone:    phone,
+		Vars:     domainCfg.Variables,
+		DryRun:   dryRun,
+		Force:    force,
+	}
+	var result *deploy.Result
+	var err error
+	if phone != nil && k.ProvManager != nil {
+		var opened models.Phone
+		if opened, err = k.ProvManager.OpenPhone(*phone); err == nil {
+			req.Phone = &opened
+			req.Secrets, err = k.ProvManager.SecretValues(*phone)
+		}
+	}
+	if err == nil {
+		result, err = deploy.NewExecutor(k.ConfigDir).Run(ctx, req)
+	}
+	run := deploy.Record(k.DB, origin, req, result, err)
+
+	if !dryRun {
+		event := map[string]interface{}{
+			"action":  origin.Action,
+			"trigger": origin.Trigger,
+			"run_id":  run.ID,
+			"success": err == nil,
+			"output":  run.Output,
+		}
+		if run.PhoneID != nil {
+			event["phone_id"] = *run.PhoneID
+		}
+		if err != nil {
+			event["error"] = err.Error()
+		}
+		k.Events.Publish(broadcaster.TypeDeployResult, domainName, event)
+	}
+	return result, run, err
+}
+
+func (h *SystemHandler) hooks() hookRunner {
+	return hookRunner{ConfigDir: h.ConfigDir, DB: h.DB, Events: h.Events, ProvManager: h.ProvManager}
+}
+
+// deployRunResponse adds the full per-target/per-command result to a history record
+type deployRunResponse struct {
+	models.DeployRun
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// GetDeployRuns handles GET /api/deploy/runs
+// Query params: domain, phone_id, trigger, action, success (true/false), page, limit
+func (h *SystemHandler) GetDeployRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, limit := 1, 50
+	if p := q.Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if l := q.Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	query := h.DB.Model(&models.DeployRun{})
+	if domain := q.Get("domain"); domain != "" {
+		query = query.Where("domain = ?", domain)
+	}
+	if phoneID := q.Get("phone_id"); phoneID != "" {
+		query = query.Where("phone_id = ?", phoneID)
+	}
+	if trigger := q.Get("trigger"); trigger != "" {
+		query = query.Where("trigger = ?", trigger)
+	}
+	if action := q.Get("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	switch q.Get("success") {
+	case "true":
+		query = query.Where("success = ?", true)
+	case "false":
+		query = query.Where("success = ?", false)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var runs []models.DeployRun
+	if err := query.Order("id desc").Limit(limit).Offset((page - 1) * limit).Find(&runs).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs":  runs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetDeployRun handles GET /api/deploy/runs/{id}
+func (h *SystemHandler) GetDeployRun(w http.ResponseWriter, r *http.Request) {
+	var run models.DeployRun
+	if err := h.DB.First(&run, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Deploy run not found", http.StatusNotFound)
+		return
+	}
+
+	resp := deployRunResponse{DeployRun: run}
+	if run.Result != "" {
+		resp.Result = json.RawMessage(run.Result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RetryDeployRun handles POST /api/deploy/runs/{id}/retry
+// The hooks are run again with the current domain config. The retry is recorded as a new run.
+func (h *SystemHandler) RetryDeployRun(w http.ResponseWriter, r *http.Request) {
+	var prev models.DeployRun
+	if err := h.DB.First(&prev, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Deploy run not found", http.StatusNotFound)
+		return
+	}
+
+	// The phone may be gone (delete hooks), then the recorded MAC and number are used
+	var phone *models.Phone
+	if prev.PhoneID != nil {
+		var existing models.Phone
+		if err := models.PreloadPhone(h.DB).First(&existing, *prev.PhoneID).Error; err == nil {
+			phone = &existing
+		} else {
+			phone = &models.Phone{ID: *prev.PhoneID, Domain: prev.Domain}
+			if prev.PhoneMAC != "" {
+				mac := prev.PhoneMAC
+				phone.MacAddress = &mac
+			}
+			if prev.PhoneNumber != "" {
+				number := prev.PhoneNumber
+				phone.PhoneNumber = &number
+			}
+		}
+	}
+
+	cfg := *h.Config
+	domainCfg := cfg.GetEffectiveDomainConfig(prev.Domain)
+	origin := deploy.Origin{Action: prev.Action, Trigger: models.TriggerRetry, RetryOf: &prev.ID}
+
+	var result *deploy.Result
+	var run *models.DeployRun
+	var err error
+	if err := h.Queue.Do(r.Context(), deploy.JobState{Domain: prev.Domain, Action: prev.Action, Trigger: models.TriggerRetry}, func() {
+		result, run, err = h.hooks().run(r.Context(), prev.Domain, domainCfg, origin, phone, false, false)
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("Retry cancelled while waiting for the running deploy of %s: %v", prev.Domain, err), http.StatusServiceUnavailable)
+		return
+	}
+	if run == nil {
+		http.Error(w, fmt.Sprintf(`{"error": "No %s command or target defined for domain '%s'"}`, prev.Action, prev.Domain), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		log.Printf("Retry of deploy run %d failed for %s: %v", prev.ID, prev.Domain, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  fmt.Sprintf("Deploy failed: %v", err),
+			"run":    run,
+			"result": result,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": fmt.Sprintf("Deploy run %d retried successfully", prev.ID),
+		"run":     run,
+		"result":  result,
+	})
+}
+
+// GetDeployQueue handles GET /api/deploy/queue
+func (h *SystemHandler) GetDeployQueue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Queue.State())
+}
+
+// FlushDeployQueue handles POST /api/deploy/queue/flush
+// Query params: domain (empty - all domains). Pending deploys start right away instead of waiting for the debounce window.
+func (h *SystemHandler) FlushDeployQueue(w http.ResponseWriter, r *http.Request) {
+	n := h.Queue.Flush(r.URL.Query().Get("domain"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"flushed": n,
+	})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/deploy"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+	"provisioning-system/internal/secrets"
+)
+
+func TestHookRunnerMasksSecrets(t *testing.T) {
+	database := newTestDB(t)
+	box, err := secrets.LoadKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := &provisioner.Manager{Secrets: box, Vendors: []provisioner.VendorConfig{{
+		ID:       "yealink",
+		Accounts: []provisioner.Feature{{ID: "sip", Params: []provisioner.FeatureParam{{ID: "user_name"}, {ID: "password", Secret: true}}}},
+	}}}
+	phone := models.Phone{Domain: "office", Vendor: "yealink", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"101","password":"s3cret-pass"}`},
+	}}
+	if err := pm.SealLines(&phone, nil); err != nil {
+		t.Fatal(err)
+	}
+	database.Create(&phone)
+
+	k := hookRunner{ConfigDir: t.TempDir(), DB: database, ProvManager: pm}
+	domainCfg := config.DomainSettings{DeployCommands: []config.Command{
+		config.ShellCommand(`echo {{ (index .Phone.Lines 0).GetAdditionalInfoMap.password }}`),
+		{Argv: []string{"sh", "-c", "echo $0 >&2; exit 1", "{{ (index .Phone.Lines 0).GetAdditionalInfoMap.password }}"}},
+	}}
+	origin := deploy.Origin{Action: models.DeployActionDeploy, Trigger: models.TriggerManual}
+	result, run, err := k.run(context.Background(), "office", domainCfg, origin, &phone, false, false)
+	if err == nil || result == nil || len(result.Commands) != 2 {
+		t.Fatalf("expected the second command to fail: %+v %v", result, err)
+	}
+	// The command got the decrypted password
+	if got := result.Commands[0].Stdout; got != secrets.Mask+"\n" {
+		t.Errorf("unexpected masked output %q", got)
+	}
+
+	var stored models.DeployRun
+	database.First(&stored, run.ID)
+	for name, value := range map[string]string{
+		"commands": strings.Join(stored.Commands, "\n"),
+		"output":   stored.Output,
+		"result":   stored.Result,
+		"error":    stored.Error,
+		"returned": err.Error(),
+	} {
+		if strings.Contains(value, "s3cret-pass") {
+			t.Errorf("password stored in clear text in %s: %s", name, value)
+		}
+	}
+	if !strings.Contains(stored.Output, secrets.Mask) {
+		t.Errorf("output not masked: %q", stored.Output)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// httpError carries the HTTP status and message to return to the client
+type httpError struct {
+	Status  int
+	Message string
+}
+
+func (e *httpError) Error() string {
+	return e.Message
+}
+
+// FieldError is a validation error of one field of the request, e.g. "lines[2].key_number"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError is returned as 400 {"error": "...", "fields": [...]}
+type validationError struct {
+	Fields []FieldError
+}
+
+func (e *validationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil if no field failed, so that a nil *validationError never becomes a non-nil error
+func (e *validationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *validationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "Validation failed: " + strings.Join(msgs, "; ")
+}
+
+// writeError writes err as a plain-text HTTP error (500 unless it is an *httpError).
+// Validation errors are written as JSON with the failed fields.
+func writeError(w http.ResponseWriter, err error) {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "Validation failed",
+			"fields": ve.Fields,
+		})
+		return
+	}
+	var he *httpError
+	if errors.As(err, &he) {
+		http.Error(w, he.Message, he.Status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+)
+
+// heartbeatInterval keeps proxies from closing idle SSE connections
+const heartbeatInterval = 15 * time.Second
+
+type EventsHandler struct {
+	Broadcaster *broadcaster.Broadcaster
+}
+
+func NewEventsHandler(b *broadcaster.Broadcaster) *EventsHandler {
+	return &EventsHandler{
+		Broadcaster: b,
+	}
+}
+
+// StreamEvents handles GET /api/events (SSE)
+// Query params:
+//   - types - comma separated event types, prefix wildcards allowed ("phone.*,deploy.result")
+//   - domain - only events of this domain (events without a domain are still sent)
+//   - last_event_id - same as the Last-Event-ID header
+//
+// Each event is sent with "id:" and "event:" set to the event type, data is the Event JSON.
+// A "reset" event is sent first if the Last-Event-ID is unknown (e.g. the server restarted):
+// events may have been missed and the client should reload its state.
+func (h *EventsHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	lastID, reset := parseLastEventID(r, h.Broadcaster)
+
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	domain := r.URL.Query().Get("domain")
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sub, history, missed := h.Broadcaster.SubscribeFrom(lastID, types...)
+	defer h.Broadcaster.Unsubscribe(sub)
+
+	send := func(event broadcaster.Event) {
+		if domain != "" && event.Domain != "" && event.Domain != domain {
+			return
+		}
+		stream.Send(h.Broadcaster.EventID(event.ID), event.Type, event)
+	}
+
+	if reset {
+		stream.Reset()
+	}
+	stream.Run(r, sub, history, missed, send)
+}
+
+// parseLastEventID reads the Last-Event-ID header (or last_event_id query param
+// for clients that reconnect manually). Returns 0 if not set.
+// reset is true if the ID is not from this process (the server restarted) or malformed:
+// the events after it are unknown and the client has to resync.
+func parseLastEventID(r *http.Request, b *broadcaster.Broadcaster) (lastID uint64, reset bool) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return 0, false
+	}
+	id, ok := b.ParseEventID(lastEventID)
+	return id, !ok
+}
+
+// sseStream writes Server-Sent Events to a client
+type sseStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEStream(w http.ResponseWriter) (*sseStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+
+	// Set headers for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Notify client of connection
+	fmt.Fprintf(w, "data: %s\n\n", "connected")
+
+	return &sseStream{w: w, flusher: flusher}, nil
+}
+
+// Send writes one event. Empty eventType means the default "message" type, empty id means no "id:" line.
+func (s *sseStream) Send(id, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(s.w, "id: %s\n", id)
+	}
+	if eventType != "" {
+		fmt.Fprintf(s.w, "event: %s\n", eventType)
+	}
+	fmt.Fprintf(s.w, "data: %s\n\n", payload)
+}
+
+// Reset tells the client that it cannot resume from its Last-Event-ID and has to resync
+func (s *sseStream) Reset() {
+	s.Send("", "reset", map[string]string{"reason": "unknown Last-Event-ID, events may have been missed"})
+}
+
+// Run replays history and then streams live events from sub until the client disconnects.
+// Heartbeats are sent periodically, and a "dropped" event whenever the number of
+// events the client has missed (not in the buffer on resume, or dropped as too slow) grows.
+func (s *sseStream) Run(r *http.Request, sub *broadcaster.Subscription, history []broadcaster.Event, missed int64, send func(broadcaster.Event)) {
+	var reported int64
+	reportDropped := func() {
+		dropped := missed + sub.Dropped()
+		if dropped == reported {
+			return
+		}
+		reported = dropped
+		s.Send("", "dropped", map[string]int64{"dropped": dropped})
+	}
+
+	reportDropped()
+	for _, event := range history {
+		send(event)
+	}
+	s.flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Loop to send events
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			reportDropped()
+			send(event)
+			s.flusher.Flush()
+		case t := <-heartbeat.C:
+			reportDropped()
+			s.Send("", "heartbeat", map[string]string{"time": t.Format(time.RFC3339)})
+			s.flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
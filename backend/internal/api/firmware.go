@@ -0,0 +1,544 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/firmware"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxFirmwareSize limits firmware uploads
+const maxFirmwareSize = 512 << 20
+
+type FirmwareHandler struct {
+	ConfigDir   string
+	DB          *gorm.DB
+	ProvManager *provisioner.Manager
+	Repo        *firmware.Repository
+	Resolver    *firmware.Resolver
+	Events      *broadcaster.Broadcaster // Optional: system event bus
+	Phones      *PhoneHandler            // Optional: runs the deploy hooks of the domains of regenerated phones
+}
+
+func NewFirmwareHandler(configDir string, db *gorm.DB, pm *provisioner.Manager, repo *firmware.Repository, resolver *firmware.Resolver) *FirmwareHandler {
+	return &FirmwareHandler{
+		ConfigDir:   configDir,
+		DB:          db,
+		ProvManager: pm,
+		Repo:        repo,
+		Resolver:    resolver,
+	}
+}
+
+// GetFirmware handles GET /api/firmware
+// Query params: vendor, model
+func (h *FirmwareHandler) GetFirmware(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Order("vendor, id desc")
+	if vendor := r.URL.Query().Get("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+
+	var list []models.Firmware
+	if err := query.Find(&list).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := []models.Firmware{}
+	model := r.URL.Query().Get("model")
+	for _, fw := range list {
+		if model == "" || fw.AppliesTo(model) {
+			result = append(result, fw)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"firmware": result,
+	})
+}
+
+// UploadFirmware handles POST /api/firmware
+// Multipart form: file, vendor, version, models (comma separated, empty - any model), notes,
+// sha256 (optional, the upload is rejected if it does not match)
+func (h *FirmwareHandler) UploadFirmware(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFirmwareSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse upload: %v", err), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get file from request: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	fw := models.Firmware{
+		Vendor:   strings.TrimSpace(r.FormValue("vendor")),
+		FileName: filepath.Base(header.Filename),
+		Version:  strings.TrimSpace(r.FormValue("version")),
+		Notes:    r.FormValue("notes"),
+	}
+	for _, m := range strings.Split(r.FormValue("models"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			fw.Models = append(fw.Models, m)
+		}
+	}
+	if err := h.validateFirmware(&fw); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	size, sum, err := h.Repo.Save(fw.Vendor, fw.FileName, file)
+	if errors.Is(err, os.ErrExist) {
+		http.Error(w, fmt.Sprintf("Firmware %s/%s already exists", fw.Vendor, fw.FileName), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save firmware: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fw.Size, fw.SHA256 = size, sum
+
+	if expected := strings.TrimSpace(r.FormValue("sha256")); expected != "" && !strings.EqualFold(expected, sum) {
+		h.Repo.Remove(fw)
+		http.Error(w, fmt.Sprintf("Checksum mismatch: uploaded file has SHA-256 %s", sum), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.Create(&fw).Error; err != nil {
+		h.Repo.Remove(fw)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fw)
+}
+
+// UpdateFirmware handles PUT /api/firmware/{id}
+// Body: {"version": "...", "models": [...], "notes": "..."}. The file cannot be changed.
+func (h *FirmwareHandler) UpdateFirmware(w http.ResponseWriter, r *http.Request) {
+	var existing models.Firmware
+	if err := h.DB.First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Firmware not found", http.StatusNotFound)
+		return
+	}
+
+	req := existing
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	existing.Version = strings.TrimSpace(req.Version)
+	existing.Models = req.Models
+	existing.Notes = req.Notes
+	if err := h.validateFirmware(&existing); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.DB.Save(&existing).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	regenerated, err := h.regenerate(firmwarePolicyScopes(h.DB, existing.ID)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(regenerateResult(map[string]interface{}{
+		"firmware": existing,
+	}, regenerated, err))
+}
+
+// DeleteFirmware handles DELETE /api/firmware/{id}
+func (h *FirmwareHandler) DeleteFirmware(w http.ResponseWriter, r *http.Request) {
+	var fw models.Firmware
+	if err := h.DB.First(&fw, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Firmware not found", http.StatusNotFound)
+		return
+	}
+
+	if scopes := firmwarePolicyScopes(h.DB, fw.ID); len(scopes) > 0 {
+		http.Error(w, fmt.Sprintf("Firmware is used by %d firmware policies", len(scopes)), http.StatusConflict)
+		return
+	}
+
+	if err := h.DB.Delete(&fw).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.Remove(fw); err != nil {
+		logger.Warn("Failed to remove firmware file %s: %v", firmware.Path(fw), err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPolicies handles GET /api/firmware/policies
+// Query params: domain, vendor
+func (h *FirmwareHandler) GetPolicies(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("Firmware").Preload("PreviousFirmware").Order("vendor, domain, model_id")
+	if domain := r.URL.Query().Get("domain"); domain != "" {
+		query = query.Where("domain = ?", domain)
+	}
+	if vendor := r.URL.Query().Get("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+
+	policies := []models.FirmwarePolicy{}
+	if err := query.Find(&policies).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policies": policies,
+	})
+}
+
+// CreatePolicy handles POST /api/firmware/policies
+// Body: {"domain": "", "vendor": "yealink", "model_id": "", "firmware_id": 1, "previous_firmware_id": null,
+// "rollout_percent": 100, "phone_ids": [], "enabled": true}
+func (h *FirmwareHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	policy := models.FirmwarePolicy{RolloutPercent: 100, Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.ID = 0
+	if err := h.validatePolicy(&policy); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.DB.Omit(clause.Associations).Create(&policy).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	regenerated, err := h.regenerate(policy)
+
+	h.writePolicy(w, http.StatusCreated, policy.ID, regenerated, err)
+}
+
+// UpdatePolicy handles PUT /api/firmware/policies/{id}
+// Fields missing from the body keep their values (e.g. {"rollout_percent": 50} to widen a rollout)
+func (h *FirmwareHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	var existing models.FirmwarePolicy
+	if err := h.DB.First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Firmware policy not found", http.StatusNotFound)
+		return
+	}
+
+	policy := existing
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.ID = existing.ID
+	policy.CreatedAt = existing.CreatedAt
+	if err := h.validatePolicy(&policy); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.DB.Omit(clause.Associations).Save(&policy).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Phones of the old scope may have lost their firmware
+	regenerated, err := h.regenerate(existing, policy)
+
+	h.writePolicy(w, http.StatusOK, policy.ID, regenerated, err)
+}
+
+// DeletePolicy handles DELETE /api/firmware/policies/{id}
+func (h *FirmwareHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.FirmwarePolicy
+	if err := h.DB.First(&policy, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Firmware policy not found", http.StatusNotFound)
+		return
+	}
+	if err := h.DB.Delete(&policy).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	regenerated, err := h.regenerate(policy)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(regenerateResult(map[string]interface{}{
+		"status": "ok",
+	}, regenerated, err))
+}
+
+// firmwarePhoneStatus is a phone governed by a firmware policy
+type firmwarePhoneStatus struct {
+	ID              uint    `json:"id"`
+	Domain          string  `json:"domain"`
+	ModelID         string  `json:"model_id"`
+	MacAddress      *string `json:"mac_address"`
+	PhoneNumber     *string `json:"phone_number"`
+	FirmwareVersion string  `json:"firmware_version"` // Reported by the phone
+	TargetVersion   string  `json:"target_version"`   // Empty - the phone gets no firmware
+	InRollout       bool    `json:"in_rollout"`
+	UpToDate        bool    `json:"up_to_date"`
+}
+
+// GetPolicyStatus handles GET /api/firmware/policies/{id}/status
+// Shows the rollout progress: phones the policy applies to (not overridden by a more specific one),
+// which of them are in the current stage and which already report the target version.
+func (h *FirmwareHandler) GetPolicyStatus(w http.ResponseWriter, r *http.Request) {
+	var policy models.FirmwarePolicy
+	if err := h.DB.Preload("Firmware").Preload("PreviousFirmware").First(&policy, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Firmware policy not found", http.StatusNotFound)
+		return
+	}
+
+	var phones []models.Phone
+	if err := policyScope(h.DB, policy).Order("id").Find(&phones).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	policies, err := h.Resolver.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	statuses := []firmwarePhoneStatus{}
+	inRollout, upToDate := 0, 0
+	for _, phone := range phones {
+		if effective := policies.Policy(phone); effective == nil || effective.ID != policy.ID {
+			continue
+		}
+		status := firmwarePhoneStatus{
+			ID:              phone.ID,
+			Domain:          phone.Domain,
+			ModelID:         phone.ModelID,
+			MacAddress:      phone.MacAddress,
+			PhoneNumber:     phone.PhoneNumber,
+			FirmwareVersion: phone.FirmwareVersion,
+			InRollout:       firmware.InRollout(policy, phone),
+		}
+		if target := firmware.Target(policy, phone); target != nil {
+			status.TargetVersion = target.Version
+			status.UpToDate = phone.FirmwareVersion != "" && phone.FirmwareVersion == target.Version
+		}
+		if status.InRollout {
+			inRollout++
+		}
+		if status.InRollout && status.UpToDate {
+			upToDate++
+		}
+		statuses = append(statuses, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policy":     policy,
+		"total":      len(statuses),
+		"in_rollout": inRollout,
+		"upgraded":   upToDate,
+		"phones":     statuses,
+	})
+}
+
+func (h *FirmwareHandler) writePolicy(w http.ResponseWriter, status int, id uint, regenerated int, regenerateErr error) {
+	var policy models.FirmwarePolicy
+	h.DB.Preload("Firmware").Preload("PreviousFirmware").First(&policy, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(regenerateResult(map[string]interface{}{
+		"policy": policy,
+	}, regenerated, regenerateErr))
+}
+
+func (h *FirmwareHandler) validateFirmware(fw *models.Firmware) error {
+	if _, ok := h.vendor(fw.Vendor); !ok {
+		return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Unknown vendor %q", fw.Vendor)}
+	}
+	if !firmware.ValidName(fw.FileName) {
+		return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid file name %q", fw.FileName)}
+	}
+	if fw.Version == "" {
+		return &httpError{Status: http.StatusBadRequest, Message: "Version is required"}
+	}
+	for _, m := range fw.Models {
+		if err := h.checkModel(fw.Vendor, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *FirmwareHandler) validatePolicy(p *models.FirmwarePolicy) error {
+	p.Firmware, p.PreviousFirmware = nil, nil
+
+	if _, ok := h.vendor(p.Vendor); !ok {
+		return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Unknown vendor %q", p.Vendor)}
+	}
+	if p.Domain != "" && !h.domainExists(p.Domain) {
+		return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Unknown domain %q", p.Domain)}
+	}
+	if p.ModelID != "" {
+		if err := h.checkModel(p.Vendor, p.ModelID); err != nil {
+			return err
+		}
+	}
+	if p.RolloutPercent < 0 || p.RolloutPercent > 100 {
+		return &httpError{Status: http.StatusBadRequest, Message: "rollout_percent must be between 0 and 100"}
+	}
+
+	check := func(field string, id uint) error {
+		var fw models.Firmware
+		if err := h.DB.First(&fw, id).Error; err != nil {
+			return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s %d not found", field, id)}
+		}
+		if fw.Vendor != p.Vendor {
+			return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s %d is for vendor %q", field, id, fw.Vendor)}
+		}
+		if p.ModelID != "" && !fw.AppliesTo(p.ModelID) {
+			return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s %d does not apply to model %q", field, id, p.ModelID)}
+		}
+		return nil
+	}
+	if err := check("firmware_id", p.FirmwareID); err != nil {
+		return err
+	}
+	if p.PreviousFirmwareID != nil {
+		if err := check("previous_firmware_id", *p.PreviousFirmwareID); err != nil {
+			return err
+		}
+	}
+
+	var count int64
+	h.DB.Model(&models.FirmwarePolicy{}).
+		Where("domain = ? AND vendor = ? AND model_id = ? AND id <> ?", p.Domain, p.Vendor, p.ModelID, p.ID).
+		Count(&count)
+	if count > 0 {
+		return &httpError{Status: http.StatusConflict, Message: "A firmware policy for this domain, vendor and model already exists"}
+	}
+	return nil
+}
+
+func (h *FirmwareHandler) vendor(id string) (provisioner.VendorConfig, bool) {
+	for _, v := range h.ProvManager.Vendors {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return provisioner.VendorConfig{}, false
+}
+
+func (h *FirmwareHandler) checkModel(vendor, modelID string) error {
+	for _, m := range h.ProvManager.Models {
+		if m.ID == modelID {
+			if !strings.EqualFold(m.Vendor, vendor) {
+				return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Model %q is not a %s model", modelID, vendor)}
+			}
+			return nil
+		}
+	}
+	return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Unknown model %q", modelID)}
+}
+
+func (h *FirmwareHandler) domainExists(name string) bool {
+	for _, d := range h.ProvManager.Config.Domains {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// regenerate rewrites the configs of the phones in the scopes of the policies and schedules the deploy hooks
+// of their domains in the background. Returns the number of phones; if a config is not generated,
+// nothing is published or deployed and the error is returned.
+func (h *FirmwareHandler) regenerate(policies ...models.FirmwarePolicy) (int, error) {
+	seen := map[uint]bool{}
+	var phones []models.Phone
+	for _, p := range policies {
+		var scoped []models.Phone
+		if err := models.PreloadPhone(policyScope(h.DB, p)).Find(&scoped).Error; err != nil {
+			logger.Error("Failed to fetch phones for firmware policy %d: %v", p.ID, err)
+			return 0, err
+		}
+		for _, phone := range scoped {
+			if !seen[phone.ID] {
+				seen[phone.ID] = true
+				phones = append(phones, phone)
+			}
+		}
+	}
+	if len(phones) == 0 {
+		return 0, nil
+	}
+
+	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
+	if _, err := h.ProvManager.GeneratePhoneConfigs(outputDir, phones); err != nil {
+		logger.Error("Failed to regenerate phone configs: %v", err)
+		return 0, err
+	}
+	h.Events.Publish(broadcaster.TypeConfigGenerated, "", map[string]interface{}{
+		"phones": len(phones),
+		"reason": "firmware",
+	})
+
+	if h.Phones != nil {
+		byDomain := make(map[string][]models.Phone)
+		for _, p := range phones {
+			byDomain[p.Domain] = append(byDomain[p.Domain], p)
+		}
+		h.Phones.goBackground(func() {
+			for domainName, domainPhones := range byDomain {
+				h.Phones.deployPhones(domainName, domainPhones, models.TriggerFirmware)
+			}
+		})
+	}
+	return len(phones), nil
+}
+
+// regenerateResult adds the outcome of a regeneration to a response: the number of regenerated phones,
+// or regenerate_error if the configs were not generated (and not deployed)
+func regenerateResult(response map[string]interface{}, regenerated int, err error) map[string]interface{} {
+	response["regenerated"] = regenerated
+	if err != nil {
+		response["regenerate_error"] = fmt.Sprintf("Configs not generated, nothing deployed: %v", err)
+	}
+	return response
+}
+
+// policyScope selects the phones a policy can apply to
+func policyScope(db *gorm.DB, p models.FirmwarePolicy) *gorm.DB {
+	query := db.Where("vendor = ?", p.Vendor)
+	if p.Domain != "" {
+		query = query.Where("domain = ?", p.Domain)
+	}
+	if p.ModelID != "" {
+		query = query.Where("model_id = ?", p.ModelID)
+	}
+	return query
+}
+
+// firmwarePolicyScopes returns the policies that use the firmware
+func firmwarePolicyScopes(db *gorm.DB, firmwareID uint) []models.FirmwarePolicy {
+	var policies []models.FirmwarePolicy
+	db.Where("firmware_id = ? OR previous_firmware_id = ?", firmwareID, firmwareID).Find(&policies)
+	return policies
+}
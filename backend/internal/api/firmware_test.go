@@ -0,0 +1,76 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/firmware"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func TestFirmwarePolicyRegenerate(t *testing.T) {
+	database := newTestDB(t)
+	tftpRoot := t.TempDir()
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{
+		Name:          "office",
+		FirmwareURL:   "http://10.0.0.1/firmware",
+		DeployTargets: []config.DeployTarget{{Name: "tftp", Type: "local", Path: tftpRoot}},
+	}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadModels(); err != nil {
+		t.Fatal(err)
+	}
+	resolver := firmware.NewResolver(database)
+	pm.Firmware = resolver.Loader
+
+	configDir := t.TempDir()
+	phones := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: configDir}
+	t.Cleanup(phones.background.Wait)
+	h := &FirmwareHandler{DB: database, ProvManager: pm, ConfigDir: configDir, Resolver: resolver, Phones: phones}
+
+	mac := "00:15:65:aa:bb:cc"
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &mac})
+	fw := models.Firmware{Vendor: "yealink", FileName: "T46U.rom", Version: "108.86.0.45"}
+	database.Create(&fw)
+	policy := models.FirmwarePolicy{Vendor: "yealink", FirmwareID: fw.ID, RolloutPercent: 100, Enabled: true}
+	database.Create(&policy)
+
+	if n, err := h.regenerate(policy); n != 1 || err != nil {
+		t.Fatalf("regenerated %d phones, want 1 (%v)", n, err)
+	}
+	phones.background.Wait()
+
+	var runs []models.DeployRun
+	database.Find(&runs)
+	if len(runs) != 1 || runs[0].Trigger != models.TriggerFirmware || runs[0].PhoneID != nil {
+		t.Fatalf("expected one domain-wide deploy run, got %+v", runs)
+	}
+	data, err := os.ReadFile(filepath.Join(tftpRoot, "001565aabbcc.cfg"))
+	if err != nil {
+		t.Fatalf("config not deployed: %v", err)
+	}
+	if !strings.Contains(string(data), "static.firmware.url = http://10.0.0.1/firmware/yealink/T46U.rom") {
+		t.Errorf("deployed config has no firmware:\n%s", data)
+	}
+
+	// A config that cannot be generated: nothing is deployed, the error is returned
+	broken := "00:15:65:aa:bb:dd"
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &broken, Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"101","password":"enc:v1:AAAA"}`},
+	}})
+	if n, err := h.regenerate(policy); n != 0 || err == nil {
+		t.Fatalf("expected a generation error, got %d phones (%v)", n, err)
+	}
+	phones.background.Wait()
+	var count int64
+	database.Model(&models.DeployRun{}).Count(&count)
+	if count != 1 {
+		t.Errorf("deployed after a generation error: %d runs", count)
+	}
+}
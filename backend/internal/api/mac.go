@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// canonicalMAC validates the MAC address of a phone and rewrites it in the canonical form (00:15:65:aa:bb:cc)
+func canonicalMAC(mac *string) error {
+	if mac == nil || *mac == "" {
+		return nil
+	}
+	m, err := macaddr.Parse(*mac)
+	if err != nil {
+		ve := &validationError{}
+		ve.add("mac_address", "%v", err)
+		return ve.err()
+	}
+	*mac = m.String()
+	return nil
+}
+
+// LookupMAC handles GET /api/mac/{mac}: validates an address and returns its formats and the vendor guessed by OUI
+func (h *PhoneHandler) LookupMAC(w http.ResponseWriter, r *http.Request) {
+	m, err := macaddr.Parse(mux.Vars(r)["mac"])
+	if err != nil {
+		ve := &validationError{}
+		ve.add("mac", "%v", err)
+		writeError(w, ve)
+		return
+	}
+
+	formats := make(map[string]string, len(macaddr.Formats))
+	for _, f := range macaddr.Formats {
+		formats[f], _ = m.Format(f)
+	}
+	response := map[string]interface{}{
+		"mac":     m.String(),
+		"oui":     m.OUI(),
+		"vendor":  m.Vendor(),
+		"formats": formats,
+	}
+	if phone, err := db.FindPhoneByMAC(h.DB, string(m)); err == nil {
+		response["phone_id"] = phone.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RegenerateCanonicalizedMACs updates the configs of phones whose MAC address was canonicalized (see
+// db.CanonicalizeMACs): file names built from the address may change case, so the files named after the old
+// address are deleted, the configs regenerated and the deploy hooks of their domains scheduled.
+// The deploys run in the background.
+func (h *PhoneHandler) RegenerateCanonicalizedMACs(changes []db.MACChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(changes))
+	for _, c := range changes {
+		ids = append(ids, c.PhoneID)
+	}
+	var phones []models.Phone
+	if err := models.PreloadPhone(h.DB).Order("id").Find(&phones, ids).Error; err != nil {
+		return err
+	}
+
+	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
+	for _, c := range changes {
+		for _, phone := range phones {
+			if phone.ID != c.PhoneID {
+				continue
+			}
+			oldPath, _ := h.ProvManager.GetLegacyPhoneConfigPath(outputDir, phone, c.Old)
+			newPath, _ := h.ProvManager.GetPhoneConfigPath(outputDir, phone)
+			if oldPath != "" && oldPath != newPath {
+				if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+					logger.Warn("Failed to delete old config %s: %v", oldPath, err)
+				}
+			}
+		}
+	}
+	if _, err := h.ProvManager.GeneratePhoneConfigs(outputDir, phones); err != nil {
+		return err
+	}
+
+	byDomain := make(map[string][]models.Phone)
+	for _, p := range phones {
+		byDomain[p.Domain] = append(byDomain[p.Domain], p)
+	}
+	for domain, domainPhones := range byDomain {
+		h.goBackground(func() { h.deployPhones(domain, domainPhones, models.TriggerMAC) })
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func TestRegenerateCanonicalizedMACs(t *testing.T) {
+	database := newTestDB(t)
+	tftpRoot := t.TempDir()
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{
+		Name:          "office",
+		DeployTargets: []config.DeployTarget{{Name: "tftp", Type: "local", Path: tftpRoot}},
+	}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadModels(); err != nil {
+		t.Fatal(err)
+	}
+	configDir := t.TempDir()
+	h := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: configDir}
+	t.Cleanup(h.background.Wait)
+
+	// Stored before validation: upper case, its config named after it
+	mac := "00:15:65:AA:BB:CC"
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &mac})
+	oldFile := filepath.Join(configDir, "temp_configs", "office", "001565AABBCC.cfg")
+	os.MkdirAll(filepath.Dir(oldFile), 0755)
+	os.WriteFile(oldFile, []byte("old"), 0644)
+	if _, err := h.deployDomain("office", nil, models.TriggerManual); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, _, err := db.CanonicalizeMACs(database)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("canonicalize: %+v %v", changes, err)
+	}
+	if err := h.RegenerateCanonicalizedMACs(changes); err != nil {
+		t.Fatalf("regenerate: %v", err)
+	}
+	h.background.Wait()
+
+	if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+		t.Errorf("old config not deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "temp_configs", "office", "001565aabbcc.cfg")); err != nil {
+		t.Errorf("config not regenerated: %v", err)
+	}
+	var runs []models.DeployRun
+	database.Order("id").Find(&runs)
+	if len(runs) != 2 || runs[1].Trigger != models.TriggerMAC {
+		t.Fatalf("expected a deploy run after the change, got %+v", runs)
+	}
+	entries, _ := os.ReadDir(tftpRoot)
+	if len(entries) != 1 || entries[0].Name() != "001565aabbcc.cfg" {
+		t.Errorf("unexpected deployed files: %v", entries)
+	}
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"provisioning-system/internal/logger"
 	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
 	"strings"
 
 	"gorm.io/gorm"
@@ -22,7 +24,8 @@ type MigrationRequest struct {
 }
 
 type MigrationHandler struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	ProvManager *provisioner.Manager // Optional: encrypts secret params of the imported lines
 }
 
 func NewMigrationHandler(db *gorm.DB) *MigrationHandler {
@@ -142,6 +145,7 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 		ModelID    string            `json:"model_id"`
 		Data       map[string]string `json:"data"`
 		GlobalData map[string]string `json:"global_data"`
+		AutoNumber bool              `json:"auto_number"` // No phone.phone_number: take the next free number from the domain number_pool
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -153,6 +157,10 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 	mac := req.Data["phone.mac_address"]
 	phoneNum := req.Data["phone.phone_number"]
 
+	if err := canonicalMAC(&mac); err != nil {
+		writeError(w, err)
+		return
+	}
 	if mac != "" {
 		var count int64
 		h.DB.Model(&models.Phone{}).Where("mac_address = ?", mac).Count(&count)
@@ -162,13 +170,27 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	if phoneNum == "" && req.AutoNumber && h.ProvManager != nil {
+		next, err := nextFreeNumber(h.DB, h.ProvManager.Config, req.Domain)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		phoneNum = next
+	}
+
 	if phoneNum != "" {
-		var count int64
-		h.DB.Model(&models.Phone{}).Where("phone_number = ?", phoneNum).Count(&count)
-		if count > 0 {
-			http.Error(w, "Conflict: Phone Number already exists in system", http.StatusConflict)
+		// Phone numbers are unique within the domain
+		if phoneNumberTaken(h.DB, req.Domain, phoneNum, 0) {
+			http.Error(w, fmt.Sprintf("Conflict: Phone Number already exists in domain %s", req.Domain), http.StatusConflict)
 			return
 		}
+		if h.ProvManager != nil {
+			if err := checkPhoneNumber(h.ProvManager.Config, &models.Phone{Domain: req.Domain, PhoneNumber: &phoneNum}); err != nil {
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+				return
+			}
+		}
 	}
 
 	// 2. Map Discovery Data to System Models
@@ -288,6 +310,9 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 			}
 			infoJSON, _ := json.Marshal(info)
 			line.AdditionalInfo = string(infoJSON)
+			if err := h.seal(req.Vendor, line); err != nil {
+				return err
+			}
 			
 			if err := tx.Create(line).Error; err != nil {
 				return err
@@ -296,15 +321,34 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 
 		// Create Button lines
 		for _, btn := range buttons {
+			if err := h.seal(req.Vendor, btn); err != nil {
+				return err
+			}
 			if err := tx.Create(btn).Error; err != nil {
 				return err
 			}
 		}
 
+		// Typed SIP accounts of the imported lines (and of the profile), user names must be unique in the domain
+		if err := models.PreloadPhone(tx).First(&phone, phone.ID).Error; err != nil {
+			return err
+		}
+		if err := models.SyncSIPAccounts(tx, &phone); err != nil {
+			return err
+		}
+
 		logger.Info("[Migration] Successfully processed record for MAC %s", mac)
 		return nil
 	})
 
+	if conflict, ok := err.(*models.SIPAccountConflict); ok {
+		http.Error(w, "Conflict: "+conflict.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		http.Error(w, "Conflict: Phone number or MAC address was taken by another phone", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Migration finalize failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -312,5 +356,18 @@ func (h *MigrationHandler) ApplyMigration(w http.ResponseWriter, r *http.Request
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "mac": mac})
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "mac": mac, "phone_number": phoneNum})
+}
+
+// seal encrypts the secret params of an imported line
+func (h *MigrationHandler) seal(vendor string, line *models.PhoneLine) error {
+	if h.ProvManager == nil {
+		return nil
+	}
+	sealed, err := h.ProvManager.SealInfo(vendor, line.Type, line.AdditionalInfo, "")
+	if err != nil {
+		return err
+	}
+	line.AdditionalInfo = sealed
+	return nil
 }
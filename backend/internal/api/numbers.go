@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/numberpool"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// domainExists reports whether the domain is configured
+func domainExists(cfg *config.SystemConfig, name string) bool {
+	for _, d := range cfg.Domains {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// domainNumberPool returns the parsed number_pool of the domain
+func domainNumberPool(cfg *config.SystemConfig, domain string) (*numberpool.Pool, error) {
+	pool, err := numberpool.New(cfg.GetEffectiveDomainConfig(domain).NumberPool)
+	if err != nil {
+		return nil, &httpError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Invalid number_pool of domain %s: %v", domain, err)}
+	}
+	return pool, nil
+}
+
+// allocatedNumbers returns the numbers that cannot be given to a new phone of the domain:
+// phone numbers and SIP user names of the domain's phones
+func allocatedNumbers(db *gorm.DB, domain string) (map[string]bool, error) {
+	var used []string
+	if err := db.Model(&models.Phone{}).Where("domain = ? AND phone_number IS NOT NULL", domain).Pluck("phone_number", &used).Error; err != nil {
+		return nil, err
+	}
+
+	var users []string
+	if err := db.Model(&models.SIPAccount{}).Where("domain = ? AND user_name <> ''", domain).Pluck("user_name", &users).Error; err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(used)+len(users))
+	for _, n := range append(used, users...) {
+		set[n] = true
+	}
+	return set, nil
+}
+
+// nextFreeNumber returns the lowest number of the domain number_pool that is not used, reserved or excluded.
+// The number is not held: a phone created with it concurrently fails on the unique index, see duplicateError.
+func nextFreeNumber(db *gorm.DB, cfg *config.SystemConfig, domain string) (string, error) {
+	pool, err := domainNumberPool(cfg, domain)
+	if err != nil {
+		return "", err
+	}
+	if !pool.Configured() {
+		return "", &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("No number pool configured for domain %s", domain)}
+	}
+	allocated, err := allocatedNumbers(db, domain)
+	if err != nil {
+		return "", err
+	}
+	if next, ok := pool.Next(allocated); ok {
+		return next, nil
+	}
+	return "", &httpError{Status: http.StatusConflict, Message: fmt.Sprintf("Number pool of domain %s is exhausted", domain)}
+}
+
+func (h *PhoneHandler) nextFreeNumber(domain string) (string, error) {
+	return nextFreeNumber(h.DB, h.ProvManager.Config, domain)
+}
+
+// phoneNumberTaken reports whether another phone of the domain has the number.
+// Phone numbers are unique within a domain, different domains may use the same extensions.
+func phoneNumberTaken(db *gorm.DB, domain, number string, excludeID uint) bool {
+	if number == "" {
+		return false
+	}
+	var count int64
+	db.Model(&models.Phone{}).Where("domain = ? AND phone_number = ? AND id <> ?", domain, number, excludeID).Count(&count)
+	return count > 0
+}
+
+// checkPhoneNumber rejects numbers excluded in the phone's domain and numbers it takes from the pool of another
+// domain outside its own pool. Like the conflicts of GetNumbers, a domain without a pool may use any number.
+func checkPhoneNumber(cfg *config.SystemConfig, phone *models.Phone) error {
+	if phone.Type == "gateway" || phone.PhoneNumber == nil || *phone.PhoneNumber == "" {
+		return nil
+	}
+	number := *phone.PhoneNumber
+	ve := &validationError{}
+
+	pool, err := domainNumberPool(cfg, phone.Domain)
+	if err != nil {
+		return err
+	}
+	if pool.IsExcluded(number) {
+		ve.add("phone_number", "Number %s is excluded in domain %s", number, phone.Domain)
+	}
+	if pool.Configured() && !pool.Contains(number) {
+		for _, d := range cfg.Domains {
+			if d.Name == phone.Domain {
+				continue
+			}
+			other, err := domainNumberPool(cfg, d.Name)
+			if err != nil {
+				return err
+			}
+			if other.Contains(number) {
+				ve.add("phone_number", "Number %s belongs to the number pool of domain %s", number, d.Name)
+				break
+			}
+		}
+	}
+	return ve.err()
+}
+
+// duplicateError turns a unique index violation of a phone save into a 409: the number, MAC or SIP user
+// was taken by a concurrent request after the checks
+func duplicateError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return &httpError{Status: http.StatusConflict, Message: "Phone number, MAC address or SIP user is already used by another phone"}
+	}
+	return err
+}
+
+func equalStringPtr(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+type numberUse struct {
+	Number  string `json:"number"`
+	PhoneID uint   `json:"phone_id"`
+	Domain  string `json:"domain"`
+	Source  string `json:"source"` // phone_number, sip_account
+}
+
+type numberConflict struct {
+	numberUse
+	Message string `json:"message"`
+}
+
+type poolOverlap struct {
+	Domain string   `json:"domain"`
+	Ranges []string `json:"ranges"`
+}
+
+// GetNumbers handles GET /api/domains/{domain}/numbers: used/free numbers of the domain pool and conflicts
+// (numbers of the pool used in other domains, excluded numbers in use, pools overlapping other domains)
+func (h *PhoneHandler) GetNumbers(w http.ResponseWriter, r *http.Request) {
+	cfg := h.ProvManager.Config
+	domain := mux.Vars(r)["domain"]
+	if !domainExists(cfg, domain) {
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+	pool, err := domainNumberPool(cfg, domain)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var phones []models.Phone
+	if err := h.DB.Select("id", "domain", "phone_number", "type").Where("phone_number IS NOT NULL AND phone_number <> ''").Find(&phones).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch phones: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var accounts []models.SIPAccount
+	if err := h.DB.Where("domain = ? AND user_name <> ''", domain).Find(&accounts).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch SIP accounts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	used := []numberUse{}
+	conflicts := []numberConflict{}
+	usedSet := make(map[string]bool)
+	for _, p := range phones {
+		if p.Type == "gateway" {
+			continue
+		}
+		use := numberUse{Number: *p.PhoneNumber, PhoneID: p.ID, Domain: p.Domain, Source: "phone_number"}
+		if p.Domain == domain {
+			used = append(used, use)
+			usedSet[use.Number] = true
+			if pool.IsExcluded(use.Number) {
+				conflicts = append(conflicts, numberConflict{use, "Excluded number is used by a phone"})
+			}
+			continue
+		}
+		// Other domains may use the same numbers (numbers are unique per domain) unless they take them
+		// from this pool without having them in their own one
+		if pool.Contains(use.Number) {
+			other, err := domainNumberPool(cfg, p.Domain)
+			if err == nil && other.Configured() && !other.Contains(use.Number) {
+				conflicts = append(conflicts, numberConflict{use, fmt.Sprintf("Number of the pool is used in domain %s", p.Domain)})
+			}
+		}
+	}
+	for _, a := range accounts {
+		if usedSet[a.UserName] {
+			continue
+		}
+		use := numberUse{Number: a.UserName, PhoneID: a.PhoneID, Domain: a.Domain, Source: "sip_account"}
+		used = append(used, use)
+		usedSet[a.UserName] = true
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].Number < used[j].Number })
+
+	overlaps := []poolOverlap{}
+	for _, d := range cfg.Domains {
+		if d.Name == domain {
+			continue
+		}
+		other, err := domainNumberPool(cfg, d.Name)
+		if err != nil {
+			continue
+		}
+		if ranges := pool.Overlaps(other); len(ranges) > 0 {
+			o := poolOverlap{Domain: d.Name}
+			for _, r := range ranges {
+				o.Ranges = append(o.Ranges, r.String())
+			}
+			overlaps = append(overlaps, o)
+		}
+	}
+
+	response := map[string]interface{}{
+		"domain":    domain,
+		"pool":      pool,
+		"used":      used,
+		"conflicts": conflicts,
+		"overlaps":  overlaps,
+	}
+	if pool.Configured() {
+		response["summary"] = pool.Summarize(usedSet)
+		allocated, err := allocatedNumbers(h.DB, domain)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch numbers: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if next, ok := pool.Next(allocated); ok {
+			response["next"] = next
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestCheckPhoneNumber(t *testing.T) {
+	cfg := &config.SystemConfig{Domains: []config.DomainSettings{
+		{Name: "office", NumberPool: config.NumberPool{Start: 100, End: 199, Excluded: []string{"112"}}},
+		{Name: "branch", NumberPool: config.NumberPool{Start: 200, End: 299}},
+		{Name: "hq"},
+	}}
+	check := func(domain, number string) error {
+		return checkPhoneNumber(cfg, &models.Phone{Domain: domain, PhoneNumber: &number})
+	}
+
+	if err := check("office", "150"); err != nil {
+		t.Errorf("number of the pool rejected: %v", err)
+	}
+	if err := check("office", "5000"); err != nil {
+		t.Errorf("number outside of all pools rejected: %v", err)
+	}
+	if err := check("office", "112"); err == nil {
+		t.Error("excluded number accepted")
+	}
+	if err := check("office", "250"); err == nil {
+		t.Error("number of another domain's pool accepted")
+	}
+	if err := check("hq", "250"); err != nil {
+		t.Errorf("number of another pool rejected in a domain without a pool: %v", err)
+	}
+}
+
+func TestPhoneNumberUniquePerDomain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	database, err := db.Init(path)
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+	// Databases of older versions have a system-wide unique index
+	database.Migrator().DropIndex(&models.Phone{}, "idx_phones_domain_number")
+	if err := database.Exec("CREATE UNIQUE INDEX idx_phones_phone_number ON phones(phone_number)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if database, err = db.Init(path); err != nil {
+		t.Fatalf("Failed to migrate db: %v", err)
+	}
+
+	number := "100"
+	for _, domain := range []string{"office", "branch"} {
+		if err := database.Create(&models.Phone{Domain: domain, PhoneNumber: &number}).Error; err != nil {
+			t.Fatalf("number %s in domain %s: %v", number, domain, err)
+		}
+	}
+	// A number allocated by a concurrent request is a conflict, not a server error
+	err = database.Create(&models.Phone{Domain: "office", PhoneNumber: &number}).Error
+	var he *httpError
+	if !errors.As(duplicateError(err), &he) || he.Status != http.StatusConflict {
+		t.Errorf("duplicate number in the domain: expected a conflict, got %v", err)
+	}
+
+	if !phoneNumberTaken(database, "office", "100", 0) {
+		t.Error("number of the domain not taken")
+	}
+	if phoneNumberTaken(database, "other", "100", 0) {
+		t.Error("number of other domains taken")
+	}
+	var phone models.Phone
+	database.Where("domain = ?", "office").First(&phone)
+	if phoneNumberTaken(database, "office", "100", phone.ID) {
+		t.Error("number taken by the phone itself")
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/password"
+	"provisioning-system/internal/secrets"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// linePassword returns the password of an account line and whether it was entered by the user:
+// masked (kept) and encrypted (stored) values are not
+func linePassword(l models.PhoneLine) (string, bool) {
+	if l.Type != "Line" || l.AdditionalInfo == "" {
+		return "", false
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal([]byte(l.AdditionalInfo), &info); err != nil {
+		return "", false
+	}
+	pwd, _ := info["password"].(string)
+	if pwd == "" || pwd == secrets.Mask || secrets.IsEncrypted(pwd) {
+		return "", false
+	}
+	return pwd, true
+}
+
+// checkPasswords validates the passwords entered for the account lines against the domain password_policy
+// (if enforced). Generated passwords are not checked.
+func checkPasswords(phone *models.Phone, policy config.PasswordPolicy) error {
+	if !policy.Enforce {
+		return nil
+	}
+	ve := &validationError{}
+	for i, l := range phone.Lines {
+		pwd, entered := linePassword(l)
+		if !entered {
+			continue
+		}
+		if problems := password.Check(policy, pwd); len(problems) > 0 {
+			ve.add(fmt.Sprintf("lines[%d].password", i), "Password %s", strings.Join(problems, ", "))
+		}
+	}
+	return ve.err()
+}
+
+// fillPasswords sets generated passwords for the account lines without one (generate_random_password)
+func fillPasswords(phone *models.Phone, policy config.PasswordPolicy) error {
+	for i := range phone.Lines {
+		if phone.Lines[i].Type != "Line" {
+			continue
+		}
+		// Parse AdditionalInfo
+		var info map[string]interface{}
+		if phone.Lines[i].AdditionalInfo != "" {
+			json.Unmarshal([]byte(phone.Lines[i].AdditionalInfo), &info)
+		}
+		if info == nil {
+			info = make(map[string]interface{})
+		}
+
+		// Check if password is empty
+		if pwd, ok := info["password"].(string); ok && pwd != "" {
+			continue
+		}
+		if err := setLinePassword(&phone.Lines[i], info, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setLinePassword(l *models.PhoneLine, info map[string]interface{}, policy config.PasswordPolicy) error {
+	pwd, err := password.Generate(policy)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %w", err)
+	}
+	info["password"] = pwd
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	l.AdditionalInfo = string(data)
+	return nil
+}
+
+// RotatePasswords handles POST /api/domains/{domain}/rotate-passwords: new passwords (domain password_policy)
+// for all account lines of the domain, then configs are regenerated and the deploy hooks update the PBX.
+// Accounts inherited from a profile are not rotated: a profile can be shared by phones of several domains,
+// its password is changed in the profile (or overridden by an own account line of the phone).
+func (h *PhoneHandler) RotatePasswords(w http.ResponseWriter, r *http.Request) {
+	domainName := mux.Vars(r)["domain"]
+	if !domainExists(h.ProvManager.Config, domainName) {
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+	policy := h.ProvManager.Config.GetEffectiveDomainConfig(domainName).PasswordPolicy
+
+	var phones []models.Phone
+	if err := models.PreloadPhone(h.DB).Where("domain = ?", domainName).Find(&phones).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch phones: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
+	rotated := 0
+	var changed []models.Phone
+	var generateErr error
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range phones {
+			phone := &phones[i]
+			lines := 0
+			for j := range phone.Lines {
+				l := &phone.Lines[j]
+				if l.Type != "Line" {
+					continue
+				}
+				var info map[string]interface{}
+				json.Unmarshal([]byte(l.AdditionalInfo), &info)
+				if info == nil {
+					info = make(map[string]interface{})
+				}
+				if err := setLinePassword(l, info, policy); err != nil {
+					return err
+				}
+				sealed, err := h.ProvManager.SealInfo(phone.Vendor, l.Type, l.AdditionalInfo, "")
+				if err != nil {
+					return err
+				}
+				l.AdditionalInfo = sealed
+				if err := tx.Model(&models.PhoneLine{}).Where("id = ?", l.ID).Update("additional_info", sealed).Error; err != nil {
+					return err
+				}
+				lines++
+			}
+			if lines > 0 {
+				if err := models.SyncSIPAccounts(tx, phone); err != nil {
+					return err
+				}
+				rotated += lines
+				changed = append(changed, *phone)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+
+		// Configs are generated before the commit: if a phone cannot be rendered (a secret of the phone
+		// or of its profile cannot be decrypted), no config is written and the passwords stay as they were
+		for _, phone := range changed {
+			if _, generateErr = h.ProvManager.OpenPhone(phone.ApplyProfile()); generateErr != nil {
+				return generateErr
+			}
+		}
+		_, generateErr = h.ProvManager.GeneratePhoneConfigs(outputDir, changed)
+		return generateErr
+	})
+	if generateErr != nil {
+		logger.Error("Passwords of domain %s not rotated, configs cannot be generated: %v", domainName, generateErr)
+		http.Error(w, fmt.Sprintf("Passwords not rotated, configs cannot be generated: %v", generateErr), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to rotate passwords: %v", err), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Rotated %d SIP passwords of %d phones in domain %s", rotated, len(changed), domainName)
+
+	if len(changed) > 0 {
+		h.Events.Publish(broadcaster.TypeConfigGenerated, domainName, map[string]interface{}{
+			"trigger": models.TriggerPassword,
+			"phones":  len(changed),
+		})
+		h.goBackground(func() { h.deployPhones(domainName, changed, models.TriggerPassword) })
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain": domainName,
+		"phones": len(changed),
+		"lines":  rotated,
+	})
+}
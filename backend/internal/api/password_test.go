@@ -2,14 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"net/http/httptest"
 	"testing"
 
 	"provisioning-system/internal/config"
 	"provisioning-system/internal/models"
+	"provisioning-system/internal/password"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
 )
 
 func TestGenerateRandomPassword(t *testing.T) {
-	pwd := generateRandomPassword(12)
+	pwd, err := password.Generate(config.PasswordPolicy{Length: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(pwd) != 12 {
 		t.Errorf("Expected length 12, got %d", len(pwd))
 	}
@@ -51,7 +59,7 @@ func TestCreatePhone_RandomPassword(t *testing.T) {
 
 	// Re-implement the logic here for testing purposes (white-box testing the snippet)
 	// Or better, I should have extracted it to a method.
-	// Let's verify generateRandomPassword works (done above).
+	// Let's verify password.Generate works (done above).
 	// And verify the JSON manipulation works.
 
 	domainCfg := cfg.GetEffectiveDomainConfig(phone.Domain)
@@ -66,7 +74,10 @@ func TestCreatePhone_RandomPassword(t *testing.T) {
 				}
 
 				if pwd, ok := info["password"].(string); !ok || pwd == "" {
-					newPwd := generateRandomPassword(12)
+					newPwd, err := password.Generate(config.PasswordPolicy{Length: 12})
+					if err != nil {
+						t.Fatal(err)
+					}
 					info["password"] = newPwd
 					if data, err := json.Marshal(info); err == nil {
 						phone.Lines[i].AdditionalInfo = string(data)
@@ -87,3 +98,97 @@ func TestCreatePhone_RandomPassword(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckPasswords(t *testing.T) {
+	policy := config.PasswordPolicy{Length: 8, Enforce: true}
+	phone := models.Phone{Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"password":"weak"}`},
+		{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"password":"********"}`}, // Kept stored value
+		{Type: "Line", AccountNumber: 3, AdditionalInfo: `{"password":"Strong123"}`},
+		{Type: "Line", AccountNumber: 4},
+	}}
+
+	err := checkPasswords(&phone, policy)
+	ve, ok := err.(*validationError)
+	if !ok || len(ve.Fields) != 1 || ve.Fields[0].Field != "lines[0].password" {
+		t.Fatalf("unexpected result: %v", err)
+	}
+
+	policy.Enforce = false
+	if err := checkPasswords(&phone, policy); err != nil {
+		t.Errorf("policy not enforced, got %v", err)
+	}
+
+	if err := fillPasswords(&phone, config.PasswordPolicy{Length: 16}); err != nil {
+		t.Fatal(err)
+	}
+	var info map[string]string
+	json.Unmarshal([]byte(phone.Lines[3].AdditionalInfo), &info)
+	if len(info["password"]) != 16 {
+		t.Errorf("password not generated by the policy: %s", phone.Lines[3].AdditionalInfo)
+	}
+	if phone.Lines[0].AdditionalInfo != `{"password":"weak"}` {
+		t.Errorf("entered password replaced: %s", phone.Lines[0].AdditionalInfo)
+	}
+}
+
+func TestRotatePasswords(t *testing.T) {
+	database := newTestDB(t)
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{
+		Name:          "office",
+		DeployTargets: []config.DeployTarget{{Name: "tftp", Type: "local", Path: t.TempDir()}},
+	}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadModels(); err != nil {
+		t.Fatal(err)
+	}
+	h := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: t.TempDir()}
+	t.Cleanup(h.background.Wait)
+
+	// The inherited account cannot be decrypted: its phone cannot be rendered
+	profile := models.Profile{Name: "Reception", Vendor: "yealink", Lines: []models.ProfileLine{
+		{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"user_name":"200","password":"enc:v1:AAAA"}`},
+	}}
+	database.Create(&profile)
+	mac := "00:15:65:aa:bb:cc"
+	phone := models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &mac, ProfileID: &profile.ID, Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"101","password":"old-pass"}`},
+	}}
+	database.Create(&phone)
+
+	rotate := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.RotatePasswords(rec, mux.SetURLVars(httptest.NewRequest("POST", "/api/domains/office/rotate-passwords", nil), map[string]string{"domain": "office"}))
+		h.background.Wait()
+		return rec
+	}
+	linePassword := func() string {
+		var line models.PhoneLine
+		database.First(&line, phone.Lines[0].ID)
+		return line.GetAdditionalInfoMap()["password"].(string)
+	}
+	var runs int64
+
+	if rec := rotate(); rec.Code != 500 {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := linePassword(); got != "old-pass" {
+		t.Errorf("password rotated although configs were not generated: %q", got)
+	}
+	if database.Model(&models.DeployRun{}).Count(&runs); runs != 0 {
+		t.Errorf("deployed after a generation error: %d runs", runs)
+	}
+
+	database.Model(&phone).Update("profile_id", nil)
+	if rec := rotate(); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := linePassword(); got == "old-pass" || got == "" {
+		t.Errorf("password not rotated: %q", got)
+	}
+	if database.Model(&models.DeployRun{}).Count(&runs); runs != 1 {
+		t.Errorf("expected one deploy run, got %d", runs)
+	}
+}
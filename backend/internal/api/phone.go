@@ -1,22 +1,24 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
-	"text/template"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/deploy"
 	"provisioning-system/internal/logger"
+	"provisioning-system/internal/macaddr"
 	"provisioning-system/internal/models"
 	"provisioning-system/internal/provisioner"
 
@@ -27,6 +29,19 @@ type PhoneHandler struct {
 	ConfigDir   string
 	DB          *gorm.DB
 	ProvManager *provisioner.Manager
+	Events      *broadcaster.Broadcaster // Optional: system event bus
+	Queue       *deploy.Queue            // Optional: per-domain deploy queue
+
+	background sync.WaitGroup // Work left running after the response (directories), awaited by tests
+}
+
+// goBackground runs fn after the response is written
+func (h *PhoneHandler) goBackground(fn func()) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		fn()
+	}()
 }
 
 func NewPhoneHandler(configDir string, db *gorm.DB, pm *provisioner.Manager) *PhoneHandler {
@@ -44,12 +59,38 @@ func (h *PhoneHandler) CreatePhone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var phone models.Phone
-	if err := json.NewDecoder(r.Body).Decode(&phone); err != nil {
+	var req struct {
+		models.Phone
+		AutoNumber bool `json:"auto_number"` // No phone_number: take the next free number from the domain number_pool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	phone := req.Phone
+	if req.AutoNumber && (phone.PhoneNumber == nil || *phone.PhoneNumber == "") {
+		next, err := h.nextFreeNumber(phone.Domain)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		phone.PhoneNumber = &next
+	}
+
+	deployed, err := h.createPhone(&phone)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(phoneResponse{Phone: h.responsePhone(phone, false), phoneDeploy: deployed})
+}
 
+// createPhone validates and saves a new phone, generates its config and deploys the domain.
+// Returns the deploy triggered by it.
+func (h *PhoneHandler) createPhone(phone *models.Phone) (phoneDeploy, error) {
 	// Find model in manager
 	var model *provisioner.DeviceModel
 	if phone.ModelID != "" {
@@ -70,14 +111,12 @@ func (h *PhoneHandler) CreatePhone(w http.ResponseWriter, r *http.Request) {
 
 	if !isGateway {
 		if phone.MacAddress == nil || *phone.MacAddress == "" {
-			http.Error(w, "MAC Address is required for phones", http.StatusBadRequest)
-			return
+			return phoneDeploy{}, &httpError{Status: http.StatusBadRequest, Message: "MAC Address is required for phones"}
 		}
 	} else {
 		// Gateway Logic
 		if phone.IPAddress == "" {
-			http.Error(w, "IP Address is required for gateways", http.StatusBadRequest)
-			return
+			return phoneDeploy{}, &httpError{Status: http.StatusBadRequest, Message: "IP Address is required for gateways"}
 		}
 		// Copy IP to PhoneNumber for search
 		ip := phone.IPAddress
@@ -88,56 +127,26 @@ func (h *PhoneHandler) CreatePhone(w http.ResponseWriter, r *http.Request) {
 			phone.MacAddress = nil
 		}
 	}
+	if err := canonicalMAC(phone.MacAddress); err != nil {
+		return phoneDeploy{}, err
+	}
 
+	if err := h.loadProfile(phone); err != nil {
+		return phoneDeploy{}, err
+	}
 	if model != nil {
-		// Calculate limits
-		maxAccountLines := model.MaxAccountLines
-		ownSoftKeys := model.OwnSoftKeys
-		ownHardKeys := model.OwnHardKeys
-
-		// Expansion modules
-		expansionKeys := 0
-		if phone.ExpansionModulesCount > 0 && phone.ExpansionModuleModel != "" {
-			// Find expansion module model
-			var expModel *provisioner.DeviceModel
-			for _, m := range h.ProvManager.Models {
-				if m.ID == phone.ExpansionModuleModel && m.Type == "expansion-module" {
-					expModel = &m
-					break
-				}
-			}
-			if expModel != nil {
-				expansionKeys = phone.ExpansionModulesCount * expModel.OwnHardKeys
-			}
-		}
-
-		totalLimit := ownSoftKeys + ownHardKeys + maxAccountLines + expansionKeys
-		if isGateway {
-			totalLimit = maxAccountLines // For gateway, limit is just max accounts (lines)
-		}
-
-		if len(phone.Lines) > totalLimit {
-			http.Error(w, fmt.Sprintf("Too many lines. Max allowed: %d", totalLimit), http.StatusBadRequest)
-			return
+		// Inherited keys must fit the model too
+		effective := phone.ApplyProfile()
+		if err := h.validatePhoneModel(&effective, model); err != nil {
+			return phoneDeploy{}, err
 		}
+	}
 
-		// Check "Line" type limit and one-account-one-line rule
-		usedAccounts := make(map[int]bool)
-		lineCount := 0
-		for _, l := range phone.Lines {
-			if l.Type == "Line" {
-				lineCount++
-				if usedAccounts[l.AccountNumber] {
-					http.Error(w, fmt.Sprintf("Duplicate account %d used for Line type", l.AccountNumber), http.StatusBadRequest)
-					return
-				}
-				usedAccounts[l.AccountNumber] = true
-			}
-		}
-		if lineCount > maxAccountLines {
-			http.Error(w, fmt.Sprintf("Too many account lines. Max allowed: %d", maxAccountLines), http.StatusBadRequest)
-			return
-		}
+	if err := checkPhoneNumber(h.ProvManager.Config, phone); err != nil {
+		return phoneDeploy{}, err
+	}
+	if phone.PhoneNumber != nil && phoneNumberTaken(h.DB, phone.Domain, *phone.PhoneNumber, 0) {
+		return phoneDeploy{}, &httpError{Status: http.StatusConflict, Message: fmt.Sprintf("Phone number %s already exists in domain %s", *phone.PhoneNumber, phone.Domain)}
 	}
 
 	// Check for duplicate MAC
@@ -145,77 +154,69 @@ func (h *PhoneHandler) CreatePhone(w http.ResponseWriter, r *http.Request) {
 		var count int64
 		h.DB.Model(&models.Phone{}).Where("mac_address = ?", *phone.MacAddress).Count(&count)
 		if count > 0 {
-			http.Error(w, "Phone with this MAC address already exists", http.StatusConflict)
-			return
+			return phoneDeploy{}, &httpError{Status: http.StatusConflict, Message: "Phone with this MAC address already exists"}
 		}
 	}
 
-	// Generate Random Password if enabled
-	cfg := h.ProvManager.Config
-	domainCfg := cfg.GetEffectiveDomainConfig(phone.Domain)
+	// Entered passwords must match the domain policy, missing ones are generated if enabled
+	domainCfg := h.ProvManager.Config.GetEffectiveDomainConfig(phone.Domain)
+	if err := checkPasswords(phone, domainCfg.PasswordPolicy); err != nil {
+		return phoneDeploy{}, err
+	}
 	if domainCfg.GenerateRandomPassword {
-		for i := range phone.Lines {
-			if phone.Lines[i].Type == "Line" {
-				// Parse AdditionalInfo
-				var info map[string]interface{}
-				if phone.Lines[i].AdditionalInfo != "" {
-					json.Unmarshal([]byte(phone.Lines[i].AdditionalInfo), &info)
-				} else {
-					info = make(map[string]interface{})
-				}
-
-				// Check if password is empty
-				if pwd, ok := info["password"].(string); !ok || pwd == "" {
-					newPwd := generateRandomPassword(12)
-					info["password"] = newPwd
-
-					// Update AdditionalInfo
-					if data, err := json.Marshal(info); err == nil {
-						phone.Lines[i].AdditionalInfo = string(data)
-					}
-				}
-			}
+		if err := fillPasswords(phone, domainCfg.PasswordPolicy); err != nil {
+			return phoneDeploy{}, &httpError{Status: http.StatusInternalServerError, Message: err.Error()}
 		}
 	}
 
-	if result := h.DB.Create(&phone); result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-		return
+	if err := h.checkSIPAccounts(phone); err != nil {
+		return phoneDeploy{}, err
+	}
+
+	if err := h.ProvManager.SealLines(phone, nil); err != nil {
+		return phoneDeploy{}, &httpError{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	// The phone and its typed accounts are saved together
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Profile").Create(phone).Error; err != nil {
+			return duplicateError(err)
+		}
+		return syncSIPAccounts(tx, phone)
+	})
+	if err != nil {
+		return phoneDeploy{}, err
 	}
 
 	// Generate config for new phone
 	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
-	if _, err := h.ProvManager.GeneratePhoneConfigs(outputDir, []models.Phone{phone}); err != nil {
+	if _, err := h.ProvManager.GeneratePhoneConfigs(outputDir, []models.Phone{*phone}); err != nil {
 		// Rollback: Delete the phone we just created
-		h.DB.Delete(&phone)
-		http.Error(w, fmt.Sprintf("Failed to generate configs: %v", err), http.StatusInternalServerError)
-		return
+		h.DB.Where("phone_id = ?", phone.ID).Delete(&models.SIPAccount{})
+		h.DB.Delete(phone)
+		return phoneDeploy{}, &httpError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to generate configs: %v", err)}
 	}
+	h.Events.Publish(broadcaster.TypePhoneCreated, phone.Domain, phoneEventData(phone))
+	h.Events.Publish(broadcaster.TypeConfigGenerated, phone.Domain, map[string]interface{}{"phone_id": phone.ID})
 
-	// Deploy to domain
-	if err := h.deployDomain(phone.Domain, &phone); err != nil {
+	// The device is provisioned now, drop it from the unknown devices inbox
+	if phone.MacAddress != nil {
+		if mac := macaddr.Normalize(*phone.MacAddress); mac != "" {
+			h.DB.Where("mac_address = ?", mac).Delete(&models.UnprovisionedDevice{})
+		}
+	}
+
+	// Deploy to domain.
+	// We don't fail the request if deployment fails: the run is recorded and returned with the phone.
+	deployed, err := h.deployDomain(phone.Domain, phone, models.TriggerPhoneCreate)
+	if err != nil {
 		logger.Warn("Failed to deploy domain %s: %v", phone.Domain, err)
-		// We don't fail the request if deployment fails, but we log it.
-		// Or should we? User might want to know.
-		// Let's keep it as is for now, but maybe add a warning header?
 	}
 
 	// Regenerate directories
-	go func() {
-		var allPhones []models.Phone
-		if err := h.DB.Preload("Lines").Find(&allPhones).Error; err != nil {
-			fmt.Printf("Failed to fetch phones for directory regeneration: %v\n", err)
-			return
-		}
-		outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
-		if err := h.ProvManager.GenerateDirectories(outputDir, allPhones); err != nil {
-			fmt.Printf("Failed to regenerate directories: %v\n", err)
-		}
-	}()
+	h.goBackground(h.regenerateDirectories)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(phone)
+	return deployed, nil
 }
 
 // GetPhones handles GET /api/phones
@@ -238,13 +239,48 @@ func (h *PhoneHandler) GetPhones(w http.ResponseWriter, r *http.Request) {
 		query = query.Where("model_id = ?", modelID)
 	}
 	if mac := r.URL.Query().Get("mac"); mac != "" {
-		mac = strings.ReplaceAll(mac, "*", "%")
-		query = query.Where("mac_address LIKE ?", mac)
+		// A full address matches in any format, otherwise a pattern of the stored form (00:15:65:*)
+		if m, err := macaddr.Parse(mac); err == nil {
+			query = query.Where("mac_address = ?", m.String())
+		} else {
+			mac = strings.ReplaceAll(strings.ToLower(mac), "*", "%")
+			query = query.Where("mac_address LIKE ?", mac)
+		}
+	}
+	if user := r.URL.Query().Get("sip_user"); user != "" {
+		user = strings.ReplaceAll(user, "*", "%")
+		query = query.Where("id IN (SELECT phone_id FROM sip_accounts WHERE user_name LIKE ? OR auth_name LIKE ?)", user, user)
 	}
 	if number := r.URL.Query().Get("number"); number != "" {
 		number = strings.ReplaceAll(number, "*", "%")
 		query = query.Where("phone_number LIKE ?", number)
 	}
+	// Check-in filters
+	if days := r.URL.Query().Get("not_seen_days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid not_seen_days", http.StatusBadRequest)
+			return
+		}
+		since := time.Now().AddDate(0, 0, -n)
+		query = query.Where("last_seen_at IS NULL OR last_seen_at < ?", since)
+	}
+	if days := r.URL.Query().Get("seen_days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid seen_days", http.StatusBadRequest)
+			return
+		}
+		since := time.Now().AddDate(0, 0, -n)
+		query = query.Where("last_seen_at >= ?", since)
+	}
+	if r.URL.Query().Get("never_seen") == "true" {
+		query = query.Where("last_seen_at IS NULL")
+	}
+	if firmware := r.URL.Query().Get("firmware"); firmware != "" {
+		firmware = strings.ReplaceAll(firmware, "*", "%")
+		query = query.Where("firmware_version LIKE ?", firmware)
+	}
 	if q := r.URL.Query().Get("q"); q != "" {
 		q = "%" + strings.ReplaceAll(q, "*", "%") + "%"
 		query = query.Where(
@@ -275,8 +311,15 @@ func (h *PhoneHandler) GetPhones(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reveal, err := h.revealSecrets(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	// Enrich phones with display names
 	for i := range phones {
+		phones[i] = h.responsePhone(phones[i], reveal)
 		// Model Name
 		for _, m := range h.ProvManager.Models {
 			if m.ID == phones[i].ModelID {
@@ -357,53 +400,32 @@ func (h *PhoneHandler) UpdatePhone(w http.ResponseWriter, r *http.Request) {
 			reqPhone.MacAddress = nil
 		}
 	}
+	if err := canonicalMAC(reqPhone.MacAddress); err != nil {
+		writeError(w, err)
+		return
+	}
 
+	if err := h.loadProfile(&reqPhone); err != nil {
+		writeError(w, err)
+		return
+	}
 	if model != nil {
-		maxAccountLines := model.MaxAccountLines
-
-		// 1. Check Account Lines
-		usedAccounts := make(map[int]bool)
-		lineCount := 0
-		for _, l := range reqPhone.Lines {
-			if l.Type == "Line" {
-				lineCount++
-				if usedAccounts[l.AccountNumber] {
-					http.Error(w, fmt.Sprintf("Duplicate account %d used for Line type", l.AccountNumber), http.StatusBadRequest)
-					return
-				}
-				usedAccounts[l.AccountNumber] = true
-			}
-		}
-		if lineCount > maxAccountLines {
-			http.Error(w, fmt.Sprintf("Too many account lines. Max allowed: %d", maxAccountLines), http.StatusBadRequest)
+		effective := reqPhone.ApplyProfile()
+		if err := h.validatePhoneModel(&effective, model); err != nil {
+			writeError(w, err)
 			return
 		}
+	}
 
-		// 2. Check Key Limits (Main Phone)
-		// ...
-
-		// 3. Check Expansion Modules
-		if reqPhone.ExpansionModulesCount > 0 && reqPhone.ExpansionModuleModel != "" {
-			var expModel *provisioner.DeviceModel
-			for _, m := range h.ProvManager.Models {
-				if m.ID == reqPhone.ExpansionModuleModel && m.Type == "expansion-module" {
-					expModel = &m
-					break
-				}
-			}
-			if expModel != nil {
-				for i := 1; i <= reqPhone.ExpansionModulesCount; i++ {
-					count := 0
-					for _, l := range reqPhone.Lines {
-						if l.PanelNumber != nil && *l.PanelNumber == i {
-							count++
-						}
-					}
-					// For expansion modules, we just check if total keys doesn't exceed its capacity?
-					// Actually, with the new model-driven approach, we'll validate against module keys too.
-					// For now, keep it simple.
-				}
-			}
+	// Number pools and uniqueness in the domain: only a changed number (or domain) is checked
+	if reqPhone.Domain != existingPhone.Domain || !equalStringPtr(reqPhone.PhoneNumber, existingPhone.PhoneNumber) {
+		if err := checkPhoneNumber(h.ProvManager.Config, &reqPhone); err != nil {
+			writeError(w, err)
+			return
+		}
+		if reqPhone.PhoneNumber != nil && phoneNumberTaken(h.DB, reqPhone.Domain, *reqPhone.PhoneNumber, existingPhone.ID) {
+			http.Error(w, fmt.Sprintf("Phone number %s already exists in domain %s", *reqPhone.PhoneNumber, reqPhone.Domain), http.StatusConflict)
+			return
 		}
 	}
 
@@ -429,6 +451,32 @@ func (h *PhoneHandler) UpdatePhone(w http.ResponseWriter, r *http.Request) {
 	tempPhone.ExpansionModulesCount = reqPhone.ExpansionModulesCount
 	tempPhone.ExpansionModuleModel = reqPhone.ExpansionModuleModel
 	tempPhone.Type = reqPhone.Type
+	tempPhone.ProfileID = reqPhone.ProfileID
+	tempPhone.Variables = reqPhone.Variables
+	tempPhone.RawConfig = reqPhone.RawConfig
+	tempPhone.Profile = reqPhone.Profile
+	domainCfg := h.ProvManager.Config.GetEffectiveDomainConfig(reqPhone.Domain)
+	if err := checkPasswords(&reqPhone, domainCfg.PasswordPolicy); err != nil {
+		writeError(w, err)
+		return
+	}
+	if domainCfg.GenerateRandomPassword {
+		if err := fillPasswords(&reqPhone, domainCfg.PasswordPolicy); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	accountsPhone := reqPhone
+	accountsPhone.ID = existingPhone.ID
+	if err := h.checkSIPAccounts(&accountsPhone); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Masked secrets keep their stored values
+	if err := h.ProvManager.SealLines(&reqPhone, existingPhone.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	tempPhone.Lines = reqPhone.Lines // This is a slice, so it's a reference, but GeneratePhoneConfigs reads it.
 
 	// Determine if config path will change
@@ -458,49 +506,111 @@ func (h *PhoneHandler) UpdatePhone(w http.ResponseWriter, r *http.Request) {
 
 	// Apply updates to DB
 	existingPhone = tempPhone // Copy fields back (except Lines which need association update)
+	profile := existingPhone.Profile
+	existingPhone.Profile = nil // Only the reference is saved
 
-	// Update Lines using Association Replace
-	if err := h.DB.Session(&gorm.Session{FullSaveAssociations: true}).Model(&existingPhone).Association("Lines").Replace(reqPhone.Lines); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update lines: %v", err), http.StatusInternalServerError)
-		return
-	}
+	// Lines, the phone and its typed accounts are saved together: a conflict leaves nothing saved
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Update Lines using Association Replace
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Model(&existingPhone).Association("Lines").Replace(reqPhone.Lines); err != nil {
+			return &httpError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to update lines: %v", err)}
+		}
 
-	// Save the phone itself
-	if err := h.DB.Save(&existingPhone).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update phone: %v", err), http.StatusInternalServerError)
+		// Save the phone itself (check-in fields belong to the tracker)
+		if err := tx.Omit(append([]string{"Profile"}, models.CheckInFields...)...).Save(&existingPhone).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+			return duplicateError(err)
+		} else if err != nil {
+			return &httpError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to update phone: %v", err)}
+		}
+		existingPhone.Profile = profile
+		return syncSIPAccounts(tx, &existingPhone)
+	})
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	h.Events.Publish(broadcaster.TypePhoneUpdated, existingPhone.Domain, phoneEventData(&existingPhone))
+	h.Events.Publish(broadcaster.TypeConfigGenerated, existingPhone.Domain, map[string]interface{}{"phone_id": existingPhone.ID})
 
 	// Deploy to domain
-	if err := h.deployDomain(existingPhone.Domain, &existingPhone); err != nil {
+	deployed, err := h.deployDomain(existingPhone.Domain, &existingPhone, models.TriggerPhoneUpdate)
+	if err != nil {
 		fmt.Printf("Failed to deploy domain %s: %v\n", existingPhone.Domain, err)
 	}
 
 	// Regenerate directories
-	go func() {
-		var allPhones []models.Phone
-		if err := h.DB.Preload("Lines").Find(&allPhones).Error; err != nil {
-			fmt.Printf("Failed to fetch phones for directory regeneration: %v\n", err)
-			return
-		}
-		outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
-		if err := h.ProvManager.GenerateDirectories(outputDir, allPhones); err != nil {
-			fmt.Printf("Failed to regenerate directories: %v\n", err)
-		}
-	}()
+	h.goBackground(h.regenerateDirectories)
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(existingPhone)
+	json.NewEncoder(w).Encode(phoneResponse{Phone: h.responsePhone(existingPhone, false), phoneDeploy: deployed})
+}
+
+// deployDomain runs the deploy hooks of the domain after a phone change, see scheduleHooks
+func (h *PhoneHandler) deployDomain(domainName string, phone *models.Phone, trigger string) (phoneDeploy, error) {
+	return h.scheduleHooks(domainName, phone, deploy.Origin{Action: models.DeployActionDeploy, Trigger: trigger})
 }
 
-func (h *PhoneHandler) deployDomain(domainName string, phone *models.Phone) error {
-	cfg := h.ProvManager.Config
-	domainCfg := cfg.GetEffectiveDomainConfig(domainName)
+// scheduleHooks runs the domain hooks for a phone change. Without deploy_debounce they run right away
+// (after the in-flight deploy of the domain) and the recorded run is returned. With deploy_debounce the run
+// is queued and coalesced with other changes of the domain, or of the same phone if the commands use phone data;
+// then the queued job is returned. Both are empty if the domain has nothing to run.
+func (h *PhoneHandler) scheduleHooks(domainName string, phone *models.Phone, origin deploy.Origin) (phoneDeploy, error) {
+	domainCfg := h.ProvManager.Config.GetEffectiveDomainConfig(domainName)
+	commands := domainCfg.DeployCommands
+	if origin.Action == models.DeployActionDelete {
+		commands = domainCfg.DeleteCommands
+	}
+	if len(commands) == 0 && len(domainCfg.DeployTargets) == 0 {
+		return phoneDeploy{}, nil
+	}
+
+	job := deploy.JobState{Domain: domainName, Action: origin.Action, Trigger: origin.Trigger}
+
+	window := deploy.DebounceWindow(domainCfg)
+	if window == 0 || h.Queue == nil {
+		var run *models.DeployRun
+		var err error
+		// Not bound to the request: the change is saved, its deploy must run even if the client goes away
+		h.Queue.Do(context.Background(), job, func() {
+			_, run, err = h.hooks().run(context.Background(), domainName, domainCfg, origin, phone, false, false)
+		})
+		return phoneDeploy{Deploy: run}, err
+	}
 
-	if len(domainCfg.DeployCommands) == 0 {
-		return nil // No deploy commands, nothing to do
+	// Domain-wide run unless the commands need the phone
+	var jobPhone *models.Phone
+	if deploy.UsesPhone(commands) {
+		p := *phone
+		jobPhone = &p
+		job.PhoneID = &p.ID
 	}
 
-	return h.executeCommands(domainCfg.DeployCommands, domainName, phone, domainCfg.Variables)
+	state := h.Queue.Enqueue(job, window, func(triggers int) {
+		o := origin
+		o.Triggers = triggers
+		// Current config at run time, it may have been reloaded while queued
+		domainCfg := h.ProvManager.Config.GetEffectiveDomainConfig(domainName)
+		if _, _, err := h.hooks().run(context.Background(), domainName, domainCfg, o, jobPhone, false, false); err != nil {
+			logger.Warn("Queued %s of domain %s failed: %v", o.Action, domainName, err)
+		}
+	})
+	return phoneDeploy{DeployQueued: &state}, nil
+}
+
+func (h *PhoneHandler) hooks() hookRunner {
+	return hookRunner{ConfigDir: h.ConfigDir, DB: h.DB, Events: h.Events, ProvManager: h.ProvManager}
+}
+
+// phoneDeploy is the deploy triggered by a phone operation: the recorded run,
+// or the queued job if the domain has deploy_debounce
+type phoneDeploy struct {
+	Deploy       *models.DeployRun `json:"deploy,omitempty"`
+	DeployQueued *deploy.JobState  `json:"deploy_queued,omitempty"`
+}
+
+// phoneResponse is a phone with the status of the deploy triggered by the operation
+type phoneResponse struct {
+	models.Phone
+	phoneDeploy
 }
 
 // GetVendors handles GET /api/vendors
@@ -513,6 +623,7 @@ func (h *PhoneHandler) GetVendors(w http.ResponseWriter, r *http.Request) {
 			"features":              v.Features,
 			"accounts":              v.Accounts,
 			"phone_config_template": v.PhoneConfigTemplate,
+			"actions":               v.Actions,
 		})
 	}
 
@@ -575,140 +686,65 @@ func (h *PhoneHandler) DeletePhone(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to delete phone: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.DB.Where("phone_id = ?", phone.ID).Delete(&models.SIPAccount{})
+	h.Events.Publish(broadcaster.TypePhoneDeleted, phone.Domain, phoneEventData(&phone))
 
 	// 3. Execute DeleteCmd (Deploy changes)
-	if err := h.executeDeleteCmd(phone.Domain, &phone); err != nil {
+	deployed, err := h.executeDeleteCmd(phone.Domain, &phone)
+	if err != nil {
 		logger.Warn("Failed to execute delete command for domain %s: %v", phone.Domain, err)
 		// We don't fail the request if the hook fails, but we log it.
 	}
 
 	// Regenerate directories
-	go func() {
-		var allPhones []models.Phone
-		if err := h.DB.Preload("Lines").Find(&allPhones).Error; err != nil {
-			logger.Error("Failed to fetch phones for directory regeneration: %v", err)
-			return
-		}
-		outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
-		if err := h.ProvManager.GenerateDirectories(outputDir, allPhones); err != nil {
-			fmt.Printf("Failed to regenerate directories: %v\n", err)
-		}
-	}()
+	h.goBackground(h.regenerateDirectories)
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status": "ok", "message": "Phone deleted successfully"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "ok",
+		"message":       "Phone deleted successfully",
+		"deploy":        deployed.Deploy,
+		"deploy_queued": deployed.DeployQueued,
+	})
 }
 
-func (h *PhoneHandler) executeDeleteCmd(domainName string, phone *models.Phone) error {
-	cfg := h.ProvManager.Config
-	domainCfg := cfg.GetEffectiveDomainConfig(domainName)
-
-	if len(domainCfg.DeleteCommands) == 0 {
-		return nil
-	}
-
-	return h.executeCommands(domainCfg.DeleteCommands, domainName, phone, domainCfg.Variables)
+// executeDeleteCmd runs the delete hooks of the domain, see scheduleHooks.
+// Targets are synced too, so the removed config disappears from them.
+func (h *PhoneHandler) executeDeleteCmd(domainName string, phone *models.Phone) (phoneDeploy, error) {
+	return h.scheduleHooks(domainName, phone, deploy.Origin{Action: models.DeployActionDelete, Trigger: models.TriggerPhoneDelete})
 }
 
-func (h *PhoneHandler) executeCommands(commands []string, domainName string, phone *models.Phone, domainVars map[string]string) error {
-	sourceDir, _ := filepath.Abs(filepath.Join(h.ConfigDir, "temp_configs", domainName))
-
-	// Data preparation: flatten the phone object to handle pointers and ensure all fields are available
-	// We use manual mapping to ensure keys match field names (PascalCase) used in templates
-	phoneMap := map[string]interface{}{
-		"ID":                    phone.ID,
-		"Domain":                phone.Domain,
-		"Vendor":                phone.Vendor,
-		"ModelID":               phone.ModelID,
-		"ExpansionModulesCount": phone.ExpansionModulesCount,
-		"ExpansionModuleModel":  phone.ExpansionModuleModel,
-		"Type":                  phone.Type,
-		"IPAddress":             phone.IPAddress,
-		"Description":           phone.Description,
-		"ModelName":             phone.ModelName,
-		"VendorName":            phone.VendorName,
-		"MacAddress":            "",
-		"PhoneNumber":           "",
-	}
-	if phone.MacAddress != nil {
-		phoneMap["MacAddress"] = *phone.MacAddress
-	}
-	if phone.PhoneNumber != nil {
-		phoneMap["PhoneNumber"] = *phone.PhoneNumber
-	}
-
-	var lines []map[string]interface{}
-	for _, l := range phone.Lines {
-		lineMap := map[string]interface{}{
-			"ID":                   l.ID,
-			"PhoneID":              l.PhoneID,
-			"Type":                 l.Type,
-			"AccountNumber":        l.AccountNumber,
-			"AdditionalInfo":       l.AdditionalInfo,
-			"KeyNumber":            nil,
-			"PanelNumber":          nil,
-			"GetAdditionalInfoMap": l.GetAdditionalInfoMap(),
-		}
-		if l.KeyNumber != nil {
-			lineMap["KeyNumber"] = *l.KeyNumber
-		}
-		if l.PanelNumber != nil {
-			lineMap["PanelNumber"] = *l.PanelNumber
-		}
-		lines = append(lines, lineMap)
+// phoneEventData is the phone summary published in phone.* events (no line credentials)
+func phoneEventData(phone *models.Phone) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           phone.ID,
+		"domain":       phone.Domain,
+		"vendor":       phone.Vendor,
+		"model_id":     phone.ModelID,
+		"mac_address":  phone.MacAddress,
+		"phone_number": phone.PhoneNumber,
+		"ip_address":   phone.IPAddress,
+		"description":  phone.Description,
 	}
-	phoneMap["Lines"] = lines
+}
 
-	// Data for template
-	data := struct {
-		Phone  map[string]interface{}
-		Domain string
-		Vars   map[string]string
-	}{
-		Phone:  phoneMap,
-		Domain: domainName,
-		Vars:   domainVars,
+// executeCommands runs deploy/delete commands of the domain for the phone (not recorded in the deploy history)
+func (h *PhoneHandler) executeCommands(commands []config.Command, domainName string, phone *models.Phone, domainVars map[string]string) (*deploy.Result, error) {
+	req := deploy.Request{
+		Domain:   domainName,
+		Commands: commands,
+		Phone:    phone,
+		Vars:     domainVars,
 	}
-
-	for _, cmdStr := range commands {
-		// 1. Parse template
-		tmpl, err := template.New("cmd").Parse(cmdStr)
+	if phone != nil && h.ProvManager != nil {
+		opened, err := h.ProvManager.OpenPhone(*phone)
 		if err != nil {
-			return fmt.Errorf("failed to parse command template '%s': %w", cmdStr, err)
+			return nil, err
 		}
-
-		var cmdBuf bytes.Buffer
-		if err := tmpl.Execute(&cmdBuf, data); err != nil {
-			return fmt.Errorf("failed to execute command template '%s': %w", cmdStr, err)
+		if req.Secrets, err = h.ProvManager.SecretValues(*phone); err != nil {
+			return nil, err
 		}
-
-		finalCmdStr := cmdBuf.String()
-
-		// 2. Execute command
-		// We use "sh -c" to allow complex commands (pipes, redirects, etc.)
-		cmd := exec.Command("sh", "-c", finalCmdStr)
-
-		// Set environment variables
-		cmd.Env = append(os.Environ(),
-			fmt.Sprintf("PROVISIONING_DOMAIN=%s", domainName),
-			fmt.Sprintf("PROVISIONING_SOURCE=%s", sourceDir),
-		)
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("command execution failed: '%s', error: %v, output: %s", finalCmdStr, err, string(output))
-		}
-	}
-
-	return nil
-}
-
-func generateRandomPassword(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	seededRand := rand.New(rand.NewSource(time.Now().UnixNano()))
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		req.Phone = &opened
 	}
-	return string(b)
+	return deploy.NewExecutor(h.ConfigDir).Run(context.Background(), req)
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"provisioning-system/internal/config"
 	"provisioning-system/internal/models"
 )
 
@@ -34,14 +35,14 @@ func TestExecuteCommands(t *testing.T) {
 	// 4. Define commands
 	// We'll use a command that writes to a file in the temp dir
 	outputFile := filepath.Join(tmpDir, "output.txt")
-	commands := []string{
-		"echo 'Domain: {{.Domain}}' > " + outputFile,
-		"echo 'MAC: {{.Phone.MacAddress}}' >> " + outputFile,
-		"echo 'Server: {{.Vars.ServerIP}}' >> " + outputFile,
+	commands := []config.Command{
+		config.ShellCommand("echo 'Domain: {{.Domain}}' > " + outputFile),
+		config.ShellCommand("echo 'MAC: {{.Phone.MacAddress}}' >> " + outputFile),
+		config.ShellCommand("echo 'Server: {{.Vars.ServerIP}}' >> " + outputFile),
 	}
 
 	// 5. Execute
-	err = h.executeCommands(commands, "test.local", phone, domainVars)
+	_, err = h.executeCommands(commands, "test.local", phone, domainVars)
 	if err != nil {
 		t.Fatalf("executeCommands failed: %v", err)
 	}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+// validatePhoneModel checks the expansion modules and the lines of the phone against the model definition:
+// panels and keys must exist on the model or its expansion module, each key is assigned once and the
+// line type must be allowed for the key type. All problems are returned at once as a *validationError.
+func (h *PhoneHandler) validatePhoneModel(phone *models.Phone, model *provisioner.DeviceModel) error {
+	ve := &validationError{}
+
+	// 1. Expansion modules
+	var expModel *provisioner.DeviceModel
+	switch {
+	case phone.ExpansionModulesCount < 0:
+		ve.add("expansion_modules_count", "Must not be negative")
+	case phone.ExpansionModulesCount > 0:
+		if phone.ExpansionModulesCount > model.MaximumExpansionModules {
+			ve.add("expansion_modules_count", "Model %s supports at most %d expansion modules", model.ID, model.MaximumExpansionModules)
+		}
+		if phone.ExpansionModuleModel == "" {
+			ve.add("expansion_module_model", "Expansion module model is required when expansion modules are set")
+			break
+		}
+		expModel = h.findModel(phone.ExpansionModuleModel)
+		if expModel == nil || expModel.Type != "expansion-module" {
+			ve.add("expansion_module_model", "Unknown expansion module %q", phone.ExpansionModuleModel)
+			expModel = nil
+		} else if !containsString(model.SupportedExpansionModules, expModel.ID) {
+			ve.add("expansion_module_model", "Expansion module %s is not supported by model %s", expModel.ID, model.ID)
+		}
+	}
+
+	// 2. Lines
+	features := make(map[string]provisioner.Feature)
+	if vendor, ok := h.phoneVendor(*phone); ok {
+		for _, f := range vendor.Features {
+			features[f.ID] = f
+		}
+	}
+
+	usedAccounts := make(map[int]int)    // account -> line index
+	usedKeys := make(map[string]int)     // "panel-key" -> line index
+	usedFeatures := make(map[string]int) // keyless feature (per account, if associated with one) -> line index
+	lineCount := 0
+	for i, l := range phone.Lines {
+		field := fmt.Sprintf("lines[%d]", i)
+
+		if l.Type == "Line" {
+			lineCount++
+			if prev, dup := usedAccounts[l.AccountNumber]; dup {
+				ve.add(field+".account_number", "Account %d is already used by lines[%d]", l.AccountNumber, prev)
+			} else {
+				usedAccounts[l.AccountNumber] = i
+			}
+		}
+
+		feature, isFeature := features[l.Type]
+		if l.Type != "Line" && !isFeature {
+			ve.add(field+".type", "Unknown feature %q for vendor %s", l.Type, phone.Vendor)
+			continue
+		}
+
+		if (l.PanelNumber == nil) != (l.KeyNumber == nil) {
+			ve.add(field+".key_number", "panel_number and key_number must be set together")
+			continue
+		}
+		if l.KeyNumber == nil {
+			if isFeature && feature.AssociatedWithButton {
+				ve.add(field+".key_number", "Feature %s must be assigned to a key", l.Type)
+			} else if isFeature {
+				// Keyless features are set once per phone, or once per account
+				featureID := l.Type
+				if feature.AssociatedWithAccount {
+					featureID = fmt.Sprintf("%s-%d", l.Type, l.AccountNumber)
+				}
+				if prev, dup := usedFeatures[featureID]; dup {
+					ve.add(field+".type", "Feature %s is already set by lines[%d]", l.Type, prev)
+				} else {
+					usedFeatures[featureID] = i
+				}
+			}
+			continue
+		}
+
+		panel, key := *l.PanelNumber, *l.KeyNumber
+		keysModel := model
+		if panel < 0 || (panel > 0 && panel > phone.ExpansionModulesCount) {
+			ve.add(field+".panel_number", "Panel %d does not exist, the phone has %d expansion modules", panel, max(phone.ExpansionModulesCount, 0))
+			continue
+		}
+		if panel > 0 {
+			if expModel == nil {
+				continue // Reported above
+			}
+			keysModel = expModel
+		}
+
+		modelKey, ok := findModelKey(keysModel, key)
+		if !ok {
+			ve.add(field+".key_number", "Key %d does not exist on %s", key, keysModel.ID)
+			continue
+		}
+		keyID := fmt.Sprintf("%d-%d", panel, key)
+		if prev, dup := usedKeys[keyID]; dup {
+			ve.add(field+".key_number", "Key %d of panel %d is already assigned by lines[%d]", key, panel, prev)
+			continue
+		}
+		usedKeys[keyID] = i
+
+		if !keyAllows(keysModel, modelKey, l.Type, isFeature && feature.AssociatedWithButton) {
+			ve.add(field+".type", "%s cannot be assigned to key %d (%s key)", l.Type, key, modelKey.Type)
+		}
+	}
+
+	if lineCount > model.MaxAccountLines {
+		ve.add("lines", "Too many account lines. Max allowed: %d", model.MaxAccountLines)
+	}
+
+	// Total: the accounts and the keys of the phone and its expansion modules (gateways: the accounts only)
+	totalLimit := model.MaxAccountLines
+	if model.Type != "gateway" {
+		totalLimit += model.OwnSoftKeys + model.OwnHardKeys
+		if expModel != nil && phone.ExpansionModulesCount > 0 {
+			totalLimit += min(phone.ExpansionModulesCount, model.MaximumExpansionModules) * expModel.OwnHardKeys
+		}
+	}
+	if len(phone.Lines) > totalLimit {
+		ve.add("lines", "Too many lines. Max allowed: %d", totalLimit)
+	}
+
+	return ve.err()
+}
+
+// keyAllows reports whether a line of the type can be assigned to the key. The key type of the model lists the
+// allowed types; without such a list accounts and features associated with a button are allowed.
+func keyAllows(model *provisioner.DeviceModel, key provisioner.ModelKey, lineType string, buttonFeature bool) bool {
+	for _, kt := range model.KeyTypes {
+		if strings.EqualFold(kt.ID, key.Type) && len(kt.Features) > 0 {
+			return containsString(kt.Features, lineType)
+		}
+	}
+	return lineType == "Line" || buttonFeature
+}
+
+func findModelKey(model *provisioner.DeviceModel, index int) (provisioner.ModelKey, bool) {
+	for _, k := range model.Keys {
+		if k.Index == index {
+			return k, true
+		}
+	}
+	return provisioner.ModelKey{}, false
+}
+
+func (h *PhoneHandler) findModel(id string) *provisioner.DeviceModel {
+	for i := range h.ProvManager.Models {
+		if h.ProvManager.Models[i].ID == id {
+			m := h.ProvManager.Models[i]
+			return &m
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
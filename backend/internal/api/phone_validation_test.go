@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func TestValidatePhoneModel(t *testing.T) {
+	phoneModel := provisioner.DeviceModel{
+		ID: "t46", Type: "phone", MaxAccountLines: 2, OwnHardKeys: 2, OwnSoftKeys: 1, MaximumExpansionModules: 2,
+		SupportedExpansionModules: []string{"exp40"},
+		Keys:                      []provisioner.ModelKey{{Index: 1, Type: "line"}, {Index: 2, Type: "line"}, {Index: 3, Type: "softkey"}},
+		KeyTypes:                  []provisioner.KeyType{{ID: "softkey", Features: []string{"sd"}}},
+	}
+	h := &PhoneHandler{ProvManager: &provisioner.Manager{
+		Vendors: []provisioner.VendorConfig{{ID: "yealink", Features: []provisioner.Feature{
+			{ID: "blf", AssociatedWithButton: true},
+			{ID: "sd", AssociatedWithButton: true},
+			{ID: "pc_port"},
+			{ID: "ring_tone", AssociatedWithAccount: true},
+		}}},
+		Models: []provisioner.DeviceModel{
+			phoneModel,
+			{ID: "exp40", Type: "expansion-module", OwnHardKeys: 1, Keys: []provisioner.ModelKey{{Index: 1, Type: "line"}}},
+			{ID: "exp50", Type: "expansion-module", Keys: []provisioner.ModelKey{{Index: 1, Type: "line"}}},
+		},
+	}}
+
+	n := func(v int) *int { return &v }
+	line := func(typ string, panel, key *int) models.PhoneLine {
+		return models.PhoneLine{Type: typ, PanelNumber: panel, KeyNumber: key, AccountNumber: 1}
+	}
+
+	valid := &models.Phone{Vendor: "yealink", ExpansionModulesCount: 1, ExpansionModuleModel: "exp40", Lines: []models.PhoneLine{
+		line("Line", n(0), n(1)),
+		line("blf", n(0), n(2)),
+		line("sd", n(0), n(3)),
+		line("blf", n(1), n(1)),
+		line("pc_port", nil, nil),
+		line("ring_tone", nil, nil),
+	}}
+	if err := h.validatePhoneModel(valid, &phoneModel); err != nil {
+		t.Fatalf("valid phone rejected: %v", err)
+	}
+
+	invalid := &models.Phone{Vendor: "yealink", ExpansionModulesCount: 3, ExpansionModuleModel: "exp50", Lines: []models.PhoneLine{
+		line("blf", n(0), n(9)),   // No such key
+		line("blf", n(0), n(3)),   // Not allowed on softkey
+		line("sd", n(0), n(1)),    // OK
+		line("blf", n(0), n(1)),   // Key taken
+		line("blf", nil, nil),     // Needs a key
+		line("unknown", nil, nil), // Not a feature of the vendor
+		line("blf", n(0), nil),    // Half a position
+		line("blf", n(4), n(1)),   // Panel out of range
+		line("pc_port", nil, nil), // OK
+		line("pc_port", nil, nil), // Set twice
+	}}
+	err := h.validatePhoneModel(invalid, &phoneModel)
+	var ve *validationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	got := map[string]bool{}
+	for _, f := range ve.Fields {
+		got[f.Field] = true
+	}
+	for _, field := range []string{
+		"expansion_modules_count", "expansion_module_model",
+		"lines[0].key_number", "lines[1].type", "lines[3].key_number", "lines[4].key_number",
+		"lines[5].type", "lines[6].key_number", "lines[7].panel_number", "lines[9].type", "lines",
+	} {
+		if !got[field] {
+			t.Errorf("missing error for %s, got %+v", field, ve.Fields)
+		}
+	}
+	if got["lines[2].type"] || got["lines[2].key_number"] {
+		t.Errorf("lines[2] is valid, got %+v", ve.Fields)
+	}
+
+	// Total limit: the accounts plus the keys of the phone and its modules (6 here), gateways the accounts only
+	tooMany := &models.Phone{Vendor: "yealink", ExpansionModulesCount: 1, ExpansionModuleModel: "exp40"}
+	for i := 1; i <= 7; i++ {
+		tooMany.Lines = append(tooMany.Lines, models.PhoneLine{Type: "ring_tone", AccountNumber: i})
+	}
+	if err := h.validatePhoneModel(tooMany, &phoneModel); err == nil || !strings.Contains(err.Error(), "Max allowed: 6") {
+		t.Errorf("expected the total limit, got %v", err)
+	}
+	gateway := phoneModel
+	gateway.Type = "gateway"
+	tooMany.Lines, tooMany.ExpansionModulesCount, tooMany.ExpansionModuleModel = tooMany.Lines[:3], 0, ""
+	if err := h.validatePhoneModel(tooMany, &gateway); err == nil || !strings.Contains(err.Error(), "Max allowed: 2") {
+		t.Errorf("expected the gateway limit, got %v", err)
+	}
+
+	// Field errors are written as JSON
+	rec := httptest.NewRecorder()
+	writeError(rec, err)
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	if rec.Code != http.StatusBadRequest || json.Unmarshal(rec.Body.Bytes(), &body) != nil || len(body.Fields) != len(ve.Fields) {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
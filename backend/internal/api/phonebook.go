@@ -0,0 +1,470 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/phonebook"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxImportSize limits contact imports (the file or the whole multipart request)
+const maxImportSize = 10 << 20
+
+// Phone numbers (+7 (495) 123-45-67, 100, *97#) or SIP URIs (sip:user@host)
+var contactNumberRe = regexp.MustCompile(`^(\+?[0-9*#()\-. ]+|(sips?:)?[^\s@]+@[^\s@]+)$`)
+
+// regenerateDirectories renders the directory/ templates of all vendors (phones and phonebooks changed)
+func (h *PhoneHandler) regenerateDirectories() {
+	var allPhones []models.Phone
+	if err := models.PreloadPhone(h.DB).Find(&allPhones).Error; err != nil {
+		logger.Error("Failed to fetch phones for directory regeneration: %v", err)
+		return
+	}
+	for i := range allPhones {
+		allPhones[i] = allPhones[i].ApplyProfile()
+	}
+	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
+	if err := h.ProvManager.GenerateDirectories(outputDir, allPhones); err != nil {
+		logger.Error("Failed to regenerate directories: %v", err)
+	}
+}
+
+// phonebookResponse is a phonebook with the number of its contacts
+type phonebookResponse struct {
+	models.Phonebook
+	ContactsCount int64 `json:"contacts_count"`
+}
+
+// GetPhonebooks handles GET /api/phonebooks
+// Query params: domain (the phonebooks of the domain and the shared ones)
+func (h *PhoneHandler) GetPhonebooks(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Order("domain, name")
+	if domain := r.URL.Query().Get("domain"); domain != "" {
+		query = query.Where("domain = ? OR domain = ''", domain)
+	}
+
+	var books []models.Phonebook
+	if err := query.Find(&books).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var counts []struct {
+		PhonebookID uint
+		Count       int64
+	}
+	if err := h.DB.Model(&models.Contact{}).Select("phonebook_id, COUNT(*) AS count").Group("phonebook_id").Scan(&counts).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contacts := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		contacts[c.PhonebookID] = c.Count
+	}
+
+	result := make([]phonebookResponse, 0, len(books))
+	for _, b := range books {
+		result = append(result, phonebookResponse{Phonebook: b, ContactsCount: contacts[b.ID]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"phonebooks": result,
+	})
+}
+
+// CreatePhonebook handles POST /api/phonebooks
+func (h *PhoneHandler) CreatePhonebook(w http.ResponseWriter, r *http.Request) {
+	var book models.Phonebook
+	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	book.ID = 0
+	book.Contacts = nil
+	if err := h.validatePhonebook(&book); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.DB.Create(&book).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create phonebook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(book)
+}
+
+// UpdatePhonebook handles PUT /api/phonebooks/{id}
+// Moving a phonebook to another domain (or making it shared) regenerates the directories.
+func (h *PhoneHandler) UpdatePhonebook(w http.ResponseWriter, r *http.Request) {
+	var existing models.Phonebook
+	if err := h.DB.First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phonebook not found", http.StatusNotFound)
+		return
+	}
+
+	var book models.Phonebook
+	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	book.ID = existing.ID
+	book.CreatedAt = existing.CreatedAt
+	book.Contacts = nil
+	if err := h.validatePhonebook(&book); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.DB.Save(&book).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update phonebook: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.goBackground(h.regenerateDirectories)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// DeletePhonebook handles DELETE /api/phonebooks/{id}, the contacts of the phonebook are deleted too
+func (h *PhoneHandler) DeletePhonebook(w http.ResponseWriter, r *http.Request) {
+	var book models.Phonebook
+	if err := h.DB.First(&book, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phonebook not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("phonebook_id = ?", book.ID).Delete(&models.Contact{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&book).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.goBackground(h.regenerateDirectories)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validatePhonebook checks the name (unique in the domain) and the domain (empty - shared)
+func (h *PhoneHandler) validatePhonebook(book *models.Phonebook) error {
+	ve := &validationError{}
+
+	book.Name = strings.TrimSpace(book.Name)
+	book.Domain = strings.TrimSpace(book.Domain)
+	if book.Name == "" {
+		ve.add("name", "Name is required")
+	}
+	if book.Domain != "" && !domainExists(h.ProvManager.Config, book.Domain) {
+		ve.add("domain", "Domain %s not found", book.Domain)
+	}
+	if err := ve.err(); err != nil {
+		return err
+	}
+
+	var count int64
+	h.DB.Model(&models.Phonebook{}).Where("domain = ? AND name = ? AND id <> ?", book.Domain, book.Name, book.ID).Count(&count)
+	if count > 0 {
+		return &httpError{Status: http.StatusConflict, Message: fmt.Sprintf("Phonebook %q already exists", book.Name)}
+	}
+	return nil
+}
+
+// validateContact normalizes the contact and adds its problems to ve, field names are prefixed (e.g. "contacts[3].")
+func validateContact(c *models.Contact, prefix string, ve *validationError) {
+	phonebook.Normalize(c)
+	if c.Name == "" {
+		ve.add(prefix+"name", "Name, first/last name or company is required")
+	}
+	if len(c.Numbers) == 0 {
+		ve.add(prefix+"numbers", "At least one number is required")
+	}
+	for i, n := range c.Numbers {
+		if !phonebook.ValidNumberType(n.Type) {
+			ve.add(fmt.Sprintf("%snumbers[%d].type", prefix, i), "Unknown number type %q (%s)", n.Type, strings.Join(models.ContactNumberTypes, ", "))
+		}
+		if !contactNumberRe.MatchString(n.Number) {
+			ve.add(fmt.Sprintf("%snumbers[%d].number", prefix, i), "Invalid number %q", n.Number)
+		}
+	}
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		ve.add(prefix+"email", "Invalid email %q", c.Email)
+	}
+}
+
+// GetContacts handles GET /api/phonebooks/{id}/contacts
+// Query params: q (name, company or number), group
+func (h *PhoneHandler) GetContacts(w http.ResponseWriter, r *http.Request) {
+	var book models.Phonebook
+	if err := h.DB.First(&book, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phonebook not found", http.StatusNotFound)
+		return
+	}
+
+	query := h.DB.Where("phonebook_id = ?", book.ID).Order("name")
+	if q := r.URL.Query().Get("q"); q != "" {
+		q = "%" + strings.ReplaceAll(q, "*", "%") + "%"
+		query = query.Where(h.DB.Where("name LIKE ?", q).Or("company LIKE ?", q).Or("numbers LIKE ?", q))
+	}
+
+	var contacts []models.Contact
+	if err := query.Find(&contacts).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Groups are stored as JSON, filtered here
+	if group := r.URL.Query().Get("group"); group != "" {
+		filtered := contacts[:0]
+		for _, c := range contacts {
+			for _, g := range c.Groups {
+				if strings.EqualFold(g, group) {
+					filtered = append(filtered, c)
+					break
+				}
+			}
+		}
+		contacts = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"phonebook": book,
+		"contacts":  contacts,
+	})
+}
+
+// CreateContact handles POST /api/phonebooks/{id}/contacts
+func (h *PhoneHandler) CreateContact(w http.ResponseWriter, r *http.Request) {
+	var book models.Phonebook
+	if err := h.DB.First(&book, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phonebook not found", http.StatusNotFound)
+		return
+	}
+
+	var contact models.Contact
+	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	contact.ID = 0
+	contact.PhonebookID = book.ID
+	ve := &validationError{}
+	validateContact(&contact, "", ve)
+	if err := ve.err(); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.DB.Create(&contact).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create contact: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.goBackground(h.regenerateDirectories)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contact)
+}
+
+// UpdateContact handles PUT /api/contacts/{id}
+// phonebook_id moves the contact to another phonebook
+func (h *PhoneHandler) UpdateContact(w http.ResponseWriter, r *http.Request) {
+	var existing models.Contact
+	if err := h.DB.First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Contact not found", http.StatusNotFound)
+		return
+	}
+
+	var contact models.Contact
+	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	contact.ID = existing.ID
+	contact.CreatedAt = existing.CreatedAt
+	if contact.PhonebookID == 0 {
+		contact.PhonebookID = existing.PhonebookID
+	}
+
+	ve := &validationError{}
+	if contact.PhonebookID != existing.PhonebookID {
+		var count int64
+		h.DB.Model(&models.Phonebook{}).Where("id = ?", contact.PhonebookID).Count(&count)
+		if count == 0 {
+			ve.add("phonebook_id", "Phonebook %d not found", contact.PhonebookID)
+		}
+	}
+	validateContact(&contact, "", ve)
+	if err := ve.err(); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.DB.Save(&contact).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update contact: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.goBackground(h.regenerateDirectories)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contact)
+}
+
+// DeleteContact handles DELETE /api/contacts/{id}
+func (h *PhoneHandler) DeleteContact(w http.ResponseWriter, r *http.Request) {
+	result := h.DB.Delete(&models.Contact{}, mux.Vars(r)["id"])
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Contact not found", http.StatusNotFound)
+		return
+	}
+	h.goBackground(h.regenerateDirectories)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportContacts handles POST /api/phonebooks/{id}/import: a CSV or vCard file, as multipart "file" or as the
+// request body. Query params: format (csv, vcard; detected by the file name or content if empty),
+// replace=true (delete the contacts of the phonebook first). Nothing is imported if a contact is invalid.
+func (h *PhoneHandler) ImportContacts(w http.ResponseWriter, r *http.Request) {
+	var book models.Phonebook
+	if err := h.DB.First(&book, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phonebook not found", http.StatusNotFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var tooLarge *http.MaxBytesError
+	var body io.Reader = r.Body
+	filename := ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("File is larger than %d MB", maxImportSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid upload: %v", err), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "File is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body, filename = file, header.Filename
+	}
+	data, err := io.ReadAll(body)
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("File is larger than %d MB", maxImportSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = phonebook.DetectFormat(filename, data)
+	}
+	contacts, err := phonebook.Parse(format, bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse contacts: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ve := &validationError{}
+	for i := range contacts {
+		contacts[i].PhonebookID = book.ID
+		validateContact(&contacts[i], fmt.Sprintf("contacts[%d].", i), ve)
+	}
+	if err := ve.err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	replace := r.URL.Query().Get("replace") == "true"
+	var replaced int64
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			result := tx.Where("phonebook_id = ?", book.ID).Delete(&models.Contact{})
+			if result.Error != nil {
+				return result.Error
+			}
+			replaced = result.RowsAffected
+		}
+		if len(contacts) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&contacts, 100).Error
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import contacts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Imported %d contacts (%s) into phonebook %s", len(contacts), format, book.Name)
+	h.goBackground(h.regenerateDirectories)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"phonebook": book.Name,
+		"format":    format,
+		"imported":  len(contacts),
+		"deleted":   replaced,
+	})
+}
+
+// GetDirectory handles GET /api/domains/{domain}/directory: the entries the directory templates get for the domain
+// (internal numbers and contacts of the domain and shared phonebooks). Query params: source (internal, external).
+func (h *PhoneHandler) GetDirectory(w http.ResponseWriter, r *http.Request) {
+	domain := mux.Vars(r)["domain"]
+	if !domainExists(h.ProvManager.Config, domain) {
+		http.Error(w, "Domain not found", http.StatusNotFound)
+		return
+	}
+
+	var phones []models.Phone
+	if err := models.PreloadPhone(h.DB).Where("domain = ?", domain).Find(&phones).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch phones: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for i := range phones {
+		phones[i] = phones[i].ApplyProfile()
+	}
+	books, err := phonebook.Loader(h.DB)()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch phonebooks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	entries := phonebook.Build(domain, phones, books)
+	if source := r.URL.Query().Get("source"); source != "" {
+		filtered := entries[:0]
+		for _, e := range entries {
+			if e.Source == source {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domain":  domain,
+		"entries": entries,
+	})
+}
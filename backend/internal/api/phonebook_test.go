@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/phonebook"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateContact(t *testing.T) {
+	c := models.Contact{Company: "Acme", Numbers: []models.ContactNumber{
+		{Type: "Mobile", Number: "+7 (900) 000-00-00"},
+		{Number: "sip:support@acme.example"},
+	}}
+	ve := &validationError{}
+	validateContact(&c, "", ve)
+	if err := ve.err(); err != nil {
+		t.Fatalf("valid contact rejected: %v", err)
+	}
+	if c.Name != "Acme" || c.Numbers[0].Type != models.NumberMobile || c.Numbers[1].Type != models.NumberWork {
+		t.Errorf("contact not normalized: %+v", c)
+	}
+
+	bad := models.Contact{Email: "nobody", Numbers: []models.ContactNumber{{Type: "pager", Number: "call me"}}}
+	ve = &validationError{}
+	validateContact(&bad, "contacts[2].", ve)
+	fields := map[string]bool{}
+	for _, f := range ve.Fields {
+		fields[f.Field] = true
+	}
+	for _, f := range []string{"contacts[2].name", "contacts[2].numbers[0].type", "contacts[2].numbers[0].number", "contacts[2].email"} {
+		if !fields[f] {
+			t.Errorf("no error for %s: %+v", f, ve.Fields)
+		}
+	}
+}
+
+func TestGetDirectory(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database, ProvManager: &provisioner.Manager{Config: &config.SystemConfig{
+		Domains: []config.DomainSettings{{Name: "office"}, {Name: "branch"}},
+	}}}
+
+	number := "100"
+	database.Create(&models.Phone{Domain: "office", PhoneNumber: &number, Description: "Reception"})
+	database.Create(&models.Phonebook{Name: "Suppliers", Contacts: []models.Contact{
+		{Name: "Acme", Numbers: []models.ContactNumber{{Type: models.NumberWork, Number: "+7 495"}}},
+	}})
+	database.Create(&models.Phonebook{Name: "Branch", Domain: "branch", Contacts: []models.Contact{
+		{Name: "Branch only", Numbers: []models.ContactNumber{{Type: models.NumberWork, Number: "200"}}},
+	}})
+
+	rec := httptest.NewRecorder()
+	h.GetDirectory(rec, mux.SetURLVars(httptest.NewRequest("GET", "/api/domains/office/directory", nil), map[string]string{"domain": "office"}))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Entries []phonebook.Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("expected the phone and the shared contact, got %+v", resp.Entries)
+	}
+	if e := resp.Entries[0]; e.Name != "Acme" || e.Source != phonebook.SourceExternal || e.Phonebook != "Suppliers" {
+		t.Errorf("unexpected contact entry %+v", e)
+	}
+	if e := resp.Entries[1]; e.Name != "Reception" || e.Number != "100" || e.Source != phonebook.SourceInternal {
+		t.Errorf("unexpected phone entry %+v", e)
+	}
+
+	rec = httptest.NewRecorder()
+	h.GetDirectory(rec, mux.SetURLVars(httptest.NewRequest("GET", "/api/domains/nope/directory", nil), map[string]string{"domain": "nope"}))
+	if rec.Code != 404 {
+		t.Errorf("unknown domain: status %d", rec.Code)
+	}
+}
+
+func TestGetPhonebooks(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database}
+
+	database.Create(&models.Phonebook{Name: "Suppliers", Contacts: []models.Contact{{Name: "Acme"}, {Name: "Globex"}}})
+	database.Create(&models.Phonebook{Name: "Empty"})
+
+	rec := httptest.NewRecorder()
+	h.GetPhonebooks(rec, httptest.NewRequest("GET", "/api/phonebooks", nil))
+	var resp struct {
+		Phonebooks []phonebookResponse `json:"phonebooks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	counts := map[string]int64{}
+	for _, b := range resp.Phonebooks {
+		counts[b.Name] = b.ContactsCount
+	}
+	if len(counts) != 2 || counts["Suppliers"] != 2 || counts["Empty"] != 0 {
+		t.Errorf("unexpected contact counts %v", counts)
+	}
+}
+
+func TestRegenerateDirectories(t *testing.T) {
+	database := newTestDB(t)
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{Name: "office"}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	pm.Phonebooks = phonebook.Loader(database)
+	configDir := t.TempDir()
+	h := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: configDir}
+
+	database.Create(&models.Phonebook{Name: "Suppliers", Contacts: []models.Contact{{
+		FirstName: "John", LastName: "Smith", Company: `Smith, Jones & "Co"`,
+		Numbers: []models.ContactNumber{{Type: models.NumberWork, Number: "+7 495"}},
+	}}})
+	h.regenerateDirectories()
+
+	data, err := os.ReadFile(filepath.Join(configDir, "temp_configs", "office", "directory.csv"))
+	if err != nil {
+		t.Fatalf("directory not generated: %v", err)
+	}
+	if want := `John,Smith,"Smith, Jones & ""Co""",`; !strings.Contains(string(data), want) {
+		t.Errorf("company not quoted, want %s in:\n%s", want, data)
+	}
+}
+
+func TestImportContacts(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database, ProvManager: provisioner.NewManager(&config.SystemConfig{}), ConfigDir: t.TempDir()}
+	t.Cleanup(h.background.Wait)
+
+	book := models.Phonebook{Name: "Suppliers"}
+	database.Create(&book)
+	post := func(body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/phonebooks/1/import?format=csv", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		h.ImportContacts(rec, mux.SetURLVars(req, map[string]string{"id": "1"}))
+		return rec
+	}
+
+	if rec := post(bytes.NewBufferString("name,number\nAcme,100\n"), "text/csv"); rec.Code != http.StatusOK {
+		t.Fatalf("import failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Larger files are rejected, not truncated
+	large := "name,number\n" + strings.Repeat("Globex,200\n", maxImportSize/11+1)
+	if rec := post(bytes.NewBufferString(large), "text/csv"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: expected 413, got %d", rec.Code)
+	}
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("file", "contacts.csv")
+	part.Write([]byte(large))
+	mw.Close()
+	if rec := post(&form, mw.FormDataContentType()); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large upload: expected 413, got %d", rec.Code)
+	}
+
+	var count int64
+	database.Model(&models.Contact{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected 1 contact, got %d", count)
+	}
+}
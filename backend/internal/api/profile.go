@@ -0,0 +1,416 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/deploy"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// profileResponse is a profile with the number of its phones
+type profileResponse struct {
+	models.Profile
+	Phones int64 `json:"phones"`
+}
+
+// GetProfiles handles GET /api/profiles
+// Query params: vendor
+func (h *PhoneHandler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("Lines").Order("name")
+	if vendor := r.URL.Query().Get("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+
+	var profiles []models.Profile
+	if err := query.Find(&profiles).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var counts []struct {
+		ProfileID uint
+		Phones    int64
+	}
+	if err := h.DB.Model(&models.Phone{}).Select("profile_id, count(*) AS phones").
+		Where("profile_id IS NOT NULL").Group("profile_id").Scan(&counts).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	phonesByProfile := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		phonesByProfile[c.ProfileID] = c.Phones
+	}
+
+	result := make([]profileResponse, 0, len(profiles))
+	for _, p := range profiles {
+		result = append(result, profileResponse{Profile: h.responseProfile(p), Phones: phonesByProfile[p.ID]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": result,
+	})
+}
+
+// GetProfile handles GET /api/profiles/{id}
+// Returns the profile with the ids of its phones
+func (h *PhoneHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.Profile
+	if err := h.DB.Preload("Lines").First(&profile, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	phoneIDs := []uint{}
+	h.DB.Model(&models.Phone{}).Where("profile_id = ?", profile.ID).Pluck("id", &phoneIDs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile":   h.responseProfile(profile),
+		"phone_ids": phoneIDs,
+	})
+}
+
+// CreateProfile handles POST /api/profiles
+func (h *PhoneHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile.ID = 0
+	if err := h.validateProfile(&profile, nil); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.sealProfileLines(&profile, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lines := profile.Lines
+	profile.Lines = nil
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&profile).Error; err != nil {
+			return err
+		}
+		return replaceProfileLines(tx, profile.ID, lines)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.DB.Preload("Lines").First(&profile, profile.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.responseProfile(profile))
+}
+
+// UpdateProfile handles PUT /api/profiles/{id}
+// The lines of the profile are replaced. All phones of the profile are regenerated and the deploy hooks
+// of their domains are scheduled.
+func (h *PhoneHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var existing models.Profile
+	if err := h.DB.Preload("Lines").First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	var profile models.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile.ID = existing.ID
+	profile.CreatedAt = existing.CreatedAt
+
+	var members []models.Phone
+	if err := h.DB.Preload("Lines").Where("profile_id = ?", profile.ID).Find(&members).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.validateProfile(&profile, members); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Masked secrets keep their stored values
+	if err := h.sealProfileLines(&profile, existing.Lines); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lines := profile.Lines
+	profile.Lines = nil
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&profile).Error; err != nil {
+			return err
+		}
+		if err := replaceProfileLines(tx, profile.ID, lines); err != nil {
+			return err
+		}
+		// The phones inherit the new account lines
+		saved := profile
+		saved.Lines = lines
+		for i := range members {
+			members[i].Profile = &saved
+			if err := models.SyncSIPAccounts(tx, &members[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.DB.Preload("Lines").First(&profile, profile.ID)
+
+	regenerated, err := h.regenerateProfile(profile.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(regenerateResult(map[string]interface{}{
+		"profile": h.responseProfile(profile),
+	}, regenerated, err))
+}
+
+// DeleteProfile handles DELETE /api/profiles/{id}
+// A profile that still has phones cannot be deleted
+func (h *PhoneHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.Profile
+	if err := h.DB.First(&profile, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	var count int64
+	h.DB.Model(&models.Phone{}).Where("profile_id = ?", profile.ID).Count(&count)
+	if count > 0 {
+		http.Error(w, fmt.Sprintf("Profile is used by %d phones", count), http.StatusConflict)
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("profile_id = ?", profile.ID).Delete(&models.ProfileLine{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&profile).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func replaceProfileLines(tx *gorm.DB, profileID uint, lines []models.ProfileLine) error {
+	if err := tx.Where("profile_id = ?", profileID).Delete(&models.ProfileLine{}).Error; err != nil {
+		return err
+	}
+	for i := range lines {
+		lines[i].ID = 0
+		lines[i].ProfileID = profileID
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return tx.Create(&lines).Error
+}
+
+// validateProfile checks the profile against the vendor and, if the profile is bound to a model, the model definition.
+// members are the phones of the profile: each of them must stay valid with the new profile.
+func (h *PhoneHandler) validateProfile(profile *models.Profile, members []models.Phone) error {
+	ve := &validationError{}
+
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		ve.add("name", "Name is required")
+	} else {
+		var count int64
+		h.DB.Model(&models.Profile{}).Where("name = ? AND id <> ?", profile.Name, profile.ID).Count(&count)
+		if count > 0 {
+			return &httpError{Status: http.StatusConflict, Message: fmt.Sprintf("Profile %q already exists", profile.Name)}
+		}
+	}
+
+	pseudo := models.Phone{
+		Vendor:                profile.Vendor,
+		ModelID:               profile.ModelID,
+		ExpansionModulesCount: profile.ExpansionModulesCount,
+		ExpansionModuleModel:  profile.ExpansionModuleModel,
+	}
+	for _, l := range profile.Lines {
+		pseudo.Lines = append(pseudo.Lines, models.PhoneLine{
+			Type:           l.Type,
+			KeyNumber:      l.KeyNumber,
+			PanelNumber:    l.PanelNumber,
+			AccountNumber:  l.AccountNumber,
+			AdditionalInfo: l.AdditionalInfo,
+		})
+	}
+
+	vendor, ok := h.phoneVendor(pseudo)
+	if !ok {
+		ve.add("vendor", "Unknown vendor %q", profile.Vendor)
+		return ve.err()
+	}
+	profile.Vendor = vendor.ID
+
+	if profile.ModelID != "" {
+		model := h.findModel(profile.ModelID)
+		if model == nil || !strings.EqualFold(model.Vendor, vendor.ID) {
+			ve.add("model_id", "Unknown %s model %q", vendor.ID, profile.ModelID)
+			return ve.err()
+		}
+		var pe *validationError
+		if err := h.validatePhoneModel(&pseudo, model); errors.As(err, &pe) {
+			ve.Fields = append(ve.Fields, pe.Fields...)
+		}
+	} else {
+		// Without a model only the feature types can be checked
+		known := map[string]bool{"Line": true}
+		for _, f := range vendor.Features {
+			known[f.ID] = true
+		}
+		for i, l := range profile.Lines {
+			if !known[l.Type] {
+				ve.add(fmt.Sprintf("lines[%d].type", i), "Unknown feature %q for vendor %s", l.Type, vendor.ID)
+			}
+			if (l.PanelNumber == nil) != (l.KeyNumber == nil) {
+				ve.add(fmt.Sprintf("lines[%d].key_number", i), "panel_number and key_number must be set together")
+			}
+		}
+	}
+
+	// Phones of the profile with the new settings
+	for _, phone := range members {
+		prefix := fmt.Sprintf("phones[%d].", phone.ID)
+		if !strings.EqualFold(phone.Vendor, profile.Vendor) || (profile.ModelID != "" && phone.ModelID != profile.ModelID) {
+			ve.add(prefix+"model_id", "Phone %d (%s) does not match the profile model", phone.ID, phone.ModelID)
+			continue
+		}
+		phone.Profile = profile
+
+		// Inherited accounts must not take the user names of other phones of the domain
+		conflicts, err := models.FindSIPAccountConflicts(h.DB, &phone)
+		if err != nil {
+			return err
+		}
+		for _, c := range conflicts {
+			if c.ProfileID != nil {
+				ve.add(prefix+profileAccountField(profile, c.AccountNumber), "%s", c.Error())
+			}
+		}
+
+		model := h.findModel(phone.ModelID)
+		if model == nil {
+			continue
+		}
+		effective := phone.ApplyProfile()
+		var pe *validationError
+		if err := h.validatePhoneModel(&effective, model); errors.As(err, &pe) {
+			for _, f := range pe.Fields {
+				ve.add(prefix+f.Field, "%s", f.Message)
+			}
+		}
+	}
+
+	return ve.err()
+}
+
+// profileAccountField returns the field of the account line of the profile
+func profileAccountField(profile *models.Profile, accountNumber int) string {
+	for i, l := range profile.Lines {
+		if l.Type == "Line" && l.AccountNumber == accountNumber {
+			return fmt.Sprintf("lines[%d].user_name", i)
+		}
+	}
+	return "lines"
+}
+
+// loadProfile sets phone.Profile from phone.ProfileID. The profile must exist and match the vendor and model of the phone.
+func (h *PhoneHandler) loadProfile(phone *models.Phone) error {
+	phone.Profile = nil
+	if phone.ProfileID == nil || *phone.ProfileID == 0 {
+		phone.ProfileID = nil
+		return nil
+	}
+
+	ve := &validationError{}
+	var profile models.Profile
+	if err := h.DB.Preload("Lines").First(&profile, *phone.ProfileID).Error; err != nil {
+		ve.add("profile_id", "Profile %d not found", *phone.ProfileID)
+		return ve.err()
+	}
+	if !strings.EqualFold(profile.Vendor, phone.Vendor) {
+		ve.add("profile_id", "Profile %s is for vendor %s", profile.Name, profile.Vendor)
+	} else if profile.ModelID != "" && profile.ModelID != phone.ModelID {
+		ve.add("profile_id", "Profile %s is for model %s", profile.Name, profile.ModelID)
+	}
+	if err := ve.err(); err != nil {
+		return err
+	}
+
+	phone.Profile = &profile
+	return nil
+}
+
+// regenerateProfile rewrites the configs of the phones of the profile and schedules the deploy hooks
+// of their domains in the background. Returns the number of phones; if a config is not generated,
+// nothing is published or deployed and the error is returned.
+func (h *PhoneHandler) regenerateProfile(profileID uint) (int, error) {
+	var phones []models.Phone
+	if err := models.PreloadPhone(h.DB).Where("profile_id = ?", profileID).Find(&phones).Error; err != nil {
+		logger.Error("Failed to fetch phones of profile %d: %v", profileID, err)
+		return 0, err
+	}
+	if len(phones) == 0 {
+		return 0, nil
+	}
+
+	outputDir := strings.TrimSuffix(h.ConfigDir, "/") + "/temp_configs"
+	if _, err := h.ProvManager.GeneratePhoneConfigs(outputDir, phones); err != nil {
+		logger.Error("Failed to regenerate configs of profile %d: %v", profileID, err)
+		return 0, err
+	}
+	h.Events.Publish(broadcaster.TypeConfigGenerated, "", map[string]interface{}{
+		"profile_id": profileID,
+		"phones":     len(phones),
+	})
+
+	byDomain := make(map[string][]models.Phone)
+	for _, p := range phones {
+		byDomain[p.Domain] = append(byDomain[p.Domain], p)
+	}
+	h.goBackground(func() {
+		for domainName, domainPhones := range byDomain {
+			h.deployPhones(domainName, domainPhones, models.TriggerProfile)
+		}
+	})
+	return len(phones), nil
+}
+
+// deployPhones runs the deploy hooks of the domain after a change of several phones:
+// once domain-wide, or for every phone if the commands need the phone
+func (h *PhoneHandler) deployPhones(domainName string, phones []models.Phone, trigger string) {
+	if !deploy.UsesPhone(h.ProvManager.Config.GetEffectiveDomainConfig(domainName).DeployCommands) {
+		if _, err := h.deployDomain(domainName, nil, trigger); err != nil {
+			logger.Warn("Failed to deploy domain %s (%s): %v", domainName, trigger, err)
+		}
+		return
+	}
+	for i := range phones {
+		if _, err := h.deployDomain(domainName, &phones[i], trigger); err != nil {
+			logger.Warn("Failed to deploy domain %s (%s): %v", domainName, trigger, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func TestApplyProfile(t *testing.T) {
+	n := func(v int) *int { return &v }
+	profile := &models.Profile{
+		ExpansionModulesCount: 1, ExpansionModuleModel: "exp40",
+		Lines: []models.ProfileLine{
+			{Type: "Line", AccountNumber: 1, PanelNumber: n(0), KeyNumber: n(1)},
+			{Type: "blf", PanelNumber: n(0), KeyNumber: n(2), AdditionalInfo: `{"value":"200"}`},
+			{Type: "blf", PanelNumber: n(1), KeyNumber: n(1)},
+			{Type: "pc_port", AdditionalInfo: `{"value":"1"}`},
+		},
+	}
+	phone := models.Phone{ID: 7, Profile: profile, Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, PanelNumber: n(0), KeyNumber: n(1)},
+		{Type: "sd", PanelNumber: n(0), KeyNumber: n(2)}, // Overrides the profile key
+		{Type: "pc_port", AdditionalInfo: `{"value":"0"}`},
+	}}
+
+	effective := phone.ApplyProfile()
+	if effective.ExpansionModulesCount != 1 || effective.ExpansionModuleModel != "exp40" {
+		t.Fatalf("expansion modules not inherited: %+v", effective)
+	}
+	if len(effective.Lines) != 4 {
+		t.Fatalf("expected 4 lines, got %+v", effective.Lines)
+	}
+	if effective.Lines[1].Type != "sd" || effective.Lines[2].Type != "pc_port" || effective.Lines[2].AdditionalInfo != `{"value":"0"}` {
+		t.Fatalf("phone lines must win, got %+v", effective.Lines)
+	}
+	if l := effective.Lines[3]; l.Type != "blf" || *l.PanelNumber != 1 || l.PhoneID != 7 {
+		t.Fatalf("profile key not inherited: %+v", l)
+	}
+	if len(phone.Lines) != 3 {
+		t.Fatal("ApplyProfile must not change the phone")
+	}
+}
+
+func TestValidateProfileMembers(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database, ProvManager: &provisioner.Manager{
+		Vendors: []provisioner.VendorConfig{{ID: "yealink", Features: []provisioner.Feature{{ID: "blf", AssociatedWithButton: true}}}},
+		Models: []provisioner.DeviceModel{{
+			ID: "t46", Vendor: "yealink", Type: "phone", MaxAccountLines: 2, OwnHardKeys: 2,
+			Keys: []provisioner.ModelKey{{Index: 1, Type: "line"}, {Index: 2, Type: "line"}},
+		}},
+	}}
+
+	n := func(v int) *int { return &v }
+	profile := models.Profile{Name: "Reception", Vendor: "yealink", ModelID: "t46", Lines: []models.ProfileLine{
+		{Type: "blf", PanelNumber: n(0), KeyNumber: n(2)},
+	}}
+	if err := h.validateProfile(&profile, nil); err != nil {
+		t.Fatalf("valid profile rejected: %v", err)
+	}
+
+	// The member assigns key 1 itself, a profile key 1 is overridden; a third account line is not
+	member := models.Phone{ID: 3, Vendor: "yealink", ModelID: "t46", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, PanelNumber: n(0), KeyNumber: n(1)},
+		{Type: "Line", AccountNumber: 2},
+	}}
+	profile.Lines = append(profile.Lines, models.ProfileLine{Type: "blf", PanelNumber: n(0), KeyNumber: n(1)})
+	if err := h.validateProfile(&profile, []models.Phone{member}); err != nil {
+		t.Fatalf("member override rejected: %v", err)
+	}
+
+	profile.Lines = append(profile.Lines, models.ProfileLine{Type: "Line", AccountNumber: 3})
+	err := h.validateProfile(&profile, []models.Phone{member})
+	var ve *validationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(ve.Fields) != 1 || ve.Fields[0].Field != "phones[3].lines" {
+		t.Fatalf("unexpected errors %+v", ve.Fields)
+	}
+}
+
+func TestGetProfiles(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database, ProvManager: &provisioner.Manager{}}
+
+	reception := models.Profile{Name: "Reception", Vendor: "yealink"}
+	empty := models.Profile{Name: "Empty", Vendor: "yealink"}
+	database.Create(&reception)
+	database.Create(&empty)
+	for i := 0; i < 3; i++ {
+		database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ProfileID: &reception.ID})
+	}
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink"})
+
+	rec := httptest.NewRecorder()
+	h.GetProfiles(rec, httptest.NewRequest("GET", "/api/profiles", nil))
+	var resp struct {
+		Profiles []profileResponse `json:"profiles"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", rec.Code, err)
+	}
+	got := map[string]int64{}
+	for _, p := range resp.Profiles {
+		got[p.Name] = p.Phones
+	}
+	if len(got) != 2 || got["Reception"] != 3 || got["Empty"] != 0 {
+		t.Errorf("unexpected phone counts %v", got)
+	}
+}
+
+func TestRegenerateProfile(t *testing.T) {
+	database := newTestDB(t)
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{
+		Name:          "office",
+		DeployTargets: []config.DeployTarget{{Name: "tftp", Type: "local", Path: t.TempDir()}},
+	}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadModels(); err != nil {
+		t.Fatal(err)
+	}
+	h := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: t.TempDir()}
+	t.Cleanup(h.background.Wait)
+
+	profile := models.Profile{Name: "Reception", Vendor: "yealink"}
+	database.Create(&profile)
+	mac := "00:15:65:aa:bb:cc"
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &mac, ProfileID: &profile.ID})
+	if n, err := h.regenerateProfile(profile.ID); n != 1 || err != nil {
+		t.Fatalf("regenerated %d phones, want 1 (%v)", n, err)
+	}
+	h.background.Wait()
+
+	// A config that cannot be generated: nothing is deployed, the error is returned
+	broken := "00:15:65:aa:bb:dd"
+	database.Create(&models.Phone{Domain: "office", Vendor: "yealink", ModelID: "yealink-SIP-T46U", MacAddress: &broken, ProfileID: &profile.ID, Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"101","password":"enc:v1:AAAA"}`},
+	}})
+	if n, err := h.regenerateProfile(profile.ID); n != 0 || err == nil {
+		t.Fatalf("expected a generation error, got %d phones (%v)", n, err)
+	}
+	h.background.Wait()
+	var count int64
+	database.Model(&models.DeployRun{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected only the first deploy run, got %d", count)
+	}
+}
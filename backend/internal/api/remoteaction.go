@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+	"provisioning-system/internal/remoteaction"
+
+	"github.com/gorilla/mux"
+)
+
+// GetRemoteActions handles GET /api/phones/{id}/remote-actions
+func (h *PhoneHandler) GetRemoteActions(w http.ResponseWriter, r *http.Request) {
+	var phone models.Phone
+	if err := h.DB.First(&phone, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phone not found", http.StatusNotFound)
+		return
+	}
+
+	actions := []provisioner.RemoteAction{}
+	if vendor, ok := h.phoneVendor(phone); ok {
+		for _, p := range remoteaction.For(vendor) {
+			actions = append(actions, p.Spec()) // Credentials are not serialized
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"address": phoneAddress(phone),
+		"actions": actions,
+	})
+}
+
+// RunRemoteAction handles POST /api/phones/{id}/remote-actions/{action}
+// Body: {"confirm": true} - required for actions marked confirm (reboot, factory reset).
+// Actions with result "file" (screenshot) return the file, the others the recorded PhoneActionLog.
+func (h *PhoneHandler) RunRemoteAction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var phone models.Phone
+	if err := h.DB.Preload("Profile").First(&phone, vars["id"]).Error; err != nil {
+		http.Error(w, "Phone not found", http.StatusNotFound)
+		return
+	}
+
+	vendor, _ := h.phoneVendor(phone)
+	plugin, ok := remoteaction.Find(vendor, vars["action"])
+	if !ok {
+		http.Error(w, fmt.Sprintf("Vendor %q has no action %q", phone.Vendor, vars["action"]), http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Confirm bool `json:"confirm"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if plugin.Spec().Confirm && !req.Confirm {
+		http.Error(w, fmt.Sprintf("Action %q must be confirmed with {\"confirm\": true}", plugin.Spec().ID), http.StatusPreconditionRequired)
+		return
+	}
+
+	entry, res := h.runRemoteAction(r.Context(), phone, plugin)
+
+	if entry.Success && plugin.Spec().Result == remoteaction.ResultFile {
+		contentType := res.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(res.Body)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", fmt.Sprintf("%s-%d", plugin.Spec().ID, phone.ID)))
+		w.Write(res.Body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !entry.Success {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+// runRemoteAction runs the action against the phone, records and publishes the result
+func (h *PhoneHandler) runRemoteAction(ctx context.Context, phone models.Phone, plugin remoteaction.Plugin) (models.PhoneActionLog, *remoteaction.Result) {
+	spec := plugin.Spec()
+
+	res, err := plugin.Run(ctx, remoteaction.Target{
+		Phone:   phone,
+		Address: phoneAddress(phone),
+		Vars:    h.ProvManager.PhoneVariables(phone).Values(),
+	})
+	if res == nil {
+		res = &remoteaction.Result{}
+	}
+
+	entry := models.PhoneActionLog{
+		PhoneID:    phone.ID,
+		Domain:     phone.Domain,
+		Action:     spec.ID,
+		Method:     "http",
+		Address:    res.URL,
+		Success:    err == nil,
+		StatusCode: res.StatusCode,
+		DurationMs: res.Duration.Milliseconds(),
+	}
+	if res.StatusCode != 0 {
+		entry.Reason = http.StatusText(res.StatusCode)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		logger.Warn("Remote action %s on phone %d failed: %v", spec.ID, phone.ID, err)
+	}
+
+	if err := h.DB.Create(&entry).Error; err != nil {
+		logger.Error("Failed to record phone action: %v", err)
+	}
+	h.Events.Publish(broadcaster.TypePhoneAction, phone.Domain, entry)
+	return entry, res
+}
+
+// phoneVendor returns the vendor config of the phone
+func (h *PhoneHandler) phoneVendor(phone models.Phone) (provisioner.VendorConfig, bool) {
+	for _, v := range h.ProvManager.Vendors {
+		if strings.EqualFold(v.ID, phone.Vendor) {
+			return v, true
+		}
+	}
+	return provisioner.VendorConfig{}, false
+}
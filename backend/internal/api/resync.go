@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+	"provisioning-system/internal/sipnotify"
+
+	"github.com/gorilla/mux"
+)
+
+// resyncConcurrency limits parallel NOTIFYs of bulk resync
+const resyncConcurrency = 16
+
+// maxPhoneActions caps the limit of GET /api/phones/{id}/actions
+const maxPhoneActions = 500
+
+type ResyncRequest struct {
+	Action string `json:"action"` // resync (default), reboot
+
+	// Bulk only: phones to notify (at least one filter is required)
+	IDs     []uint `json:"ids"`
+	Domain  string `json:"domain"`
+	Vendor  string `json:"vendor"`
+	ModelID string `json:"model_id"`
+}
+
+// ResyncPhone handles POST /api/phones/{id}/resync
+// Body (optional): {"action": "resync" | "reboot"}
+func (h *PhoneHandler) ResyncPhone(w http.ResponseWriter, r *http.Request) {
+	var phone models.Phone
+	if err := models.PreloadPhone(h.DB).First(&phone, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phone not found", http.StatusNotFound)
+		return
+	}
+
+	var req ResyncRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	action, err := h.resyncAction(req.Action)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	entry := h.notifyPhone(r.Context(), phone, action)
+
+	w.Header().Set("Content-Type", "application/json")
+	if !entry.Success {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+// ResyncPhones handles POST /api/phones/resync
+// Body: {"action": "resync", "ids": [1, 2], "domain": "...", "vendor": "...", "model_id": "..."}
+func (h *PhoneHandler) ResyncPhones(w http.ResponseWriter, r *http.Request) {
+	var req ResyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	action, err := h.resyncAction(req.Action)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(req.IDs) == 0 && req.Domain == "" && req.Vendor == "" && req.ModelID == "" {
+		http.Error(w, "At least one of ids, domain, vendor, model_id is required", http.StatusBadRequest)
+		return
+	}
+
+	query := models.PreloadPhone(h.DB)
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if req.Domain != "" {
+		query = query.Where("domain = ?", req.Domain)
+	}
+	if req.Vendor != "" {
+		query = query.Where("vendor = ?", req.Vendor)
+	}
+	if req.ModelID != "" {
+		query = query.Where("model_id = ?", req.ModelID)
+	}
+
+	var phones []models.Phone
+	if err := query.Order("id").Find(&phones).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]models.PhoneActionLog, len(phones))
+	sem := make(chan struct{}, resyncConcurrency)
+	var wg sync.WaitGroup
+	for i := range phones {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.notifyPhone(r.Context(), phones[i], action)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, res := range results {
+		if !res.Success {
+			failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":   len(results),
+		"sent":    len(results) - failed,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+// GetPhoneActions handles GET /api/phones/{id}/actions
+// Query params: limit (default 50, at most maxPhoneActions)
+func (h *PhoneHandler) GetPhoneActions(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid 'limit'", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPhoneActions)
+	}
+
+	var actions []models.PhoneActionLog
+	if err := h.DB.Where("phone_id = ?", mux.Vars(r)["id"]).Order("id desc").Limit(limit).Find(&actions).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"actions": actions,
+	})
+}
+
+func (h *PhoneHandler) resyncAction(action string) (string, error) {
+	if action == "" {
+		action = "resync"
+	}
+	if _, ok := provisioner.DefaultNotifyEvents[action]; !ok {
+		known := make([]string, 0, len(provisioner.DefaultNotifyEvents))
+		for a := range provisioner.DefaultNotifyEvents {
+			known = append(known, a)
+		}
+		sort.Strings(known)
+		return "", &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Unknown action %q, expected one of: %s", action, strings.Join(known, ", "))}
+	}
+	return action, nil
+}
+
+// notifyPhone sends the vendor's NOTIFY for the action, records and publishes the result.
+func (h *PhoneHandler) notifyPhone(ctx context.Context, phone models.Phone, action string) models.PhoneActionLog {
+	vendor, _ := h.phoneVendor(phone)
+	notify := vendor.Notify
+	event, _ := notify.NotifyEvent(action)
+
+	res, err := sipnotify.Send(ctx, sipnotify.Request{
+		Host:  phoneAddress(phone),
+		Port:  notify.Port,
+		User:  notifyUser(phone),
+		Event: event,
+	})
+
+	entry := models.PhoneActionLog{
+		PhoneID:    phone.ID,
+		Domain:     phone.Domain,
+		Action:     action,
+		Method:     "sip-notify",
+		Address:    res.Address,
+		Event:      event,
+		Success:    res.Success(),
+		StatusCode: res.StatusCode,
+		Reason:     res.Reason,
+		Error:      res.Error,
+		DurationMs: res.Duration.Milliseconds(),
+	}
+	if err != nil {
+		logger.Warn("Failed to %s phone %d (%s): %v", action, phone.ID, res.Address, err)
+	}
+
+	if err := h.DB.Create(&entry).Error; err != nil {
+		logger.Error("Failed to record phone action: %v", err)
+	}
+	h.Events.Publish(broadcaster.TypePhoneAction, phone.Domain, entry)
+	return entry
+}
+
+// phoneAddress is the address to reach the phone at: Phone.IPAddress, or the address it last fetched its config from.
+// There is no registrar here, so the registered contact of the phone is unknown: LastSeenIP is only
+// the source of its last config request and may be a NAT or proxy address the NOTIFY does not reach.
+func phoneAddress(phone models.Phone) string {
+	if phone.IPAddress != "" {
+		return phone.IPAddress
+	}
+	return phone.LastSeenIP
+}
+
+// notifyUser returns the SIP user of the phone's first account (for the Request-URI), or its number.
+// Accounts inherited from the profile count too (Profile must be loaded, see models.PreloadPhone).
+func notifyUser(phone models.Phone) string {
+	lines := append([]models.PhoneLine(nil), phone.ApplyProfile().Lines...)
+	sort.Slice(lines, func(i, j int) bool { return lines[i].AccountNumber < lines[j].AccountNumber })
+	for _, line := range lines {
+		if line.Type != "Line" || line.AdditionalInfo == "" {
+			continue
+		}
+		var info map[string]interface{}
+		if json.Unmarshal([]byte(line.AdditionalInfo), &info) == nil {
+			if user, ok := info["user_name"].(string); ok && user != "" {
+				return user
+			}
+		}
+	}
+	if phone.PhoneNumber != nil {
+		return *phone.PhoneNumber
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
+)
+
+func TestNotifyPhone(t *testing.T) {
+	database := newTestDB(t)
+
+	// Local UDP stand-in for the phone: answers every NOTIFY with 200 OK
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 65535)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		msg := string(buf[:n])
+		received <- msg
+		var headers []string
+		for _, line := range strings.Split(msg, "\r\n") {
+			if strings.HasPrefix(line, "Via:") || strings.HasPrefix(line, "CSeq:") {
+				headers = append(headers, line)
+			}
+		}
+		conn.WriteToUDP([]byte("SIP/2.0 200 OK\r\n"+strings.Join(headers, "\r\n")+"\r\n\r\n"), from)
+	}()
+
+	h := &PhoneHandler{
+		DB: database,
+		ProvManager: &provisioner.Manager{Vendors: []provisioner.VendorConfig{{
+			ID: "yealink",
+			Notify: provisioner.Notify{
+				Port:   conn.LocalAddr().(*net.UDPAddr).Port,
+				Events: map[string]string{"resync": "check-sync;reboot=false"},
+			},
+		}}},
+	}
+
+	number := "101"
+	phone := models.Phone{
+		Domain:      "office",
+		Vendor:      "yealink",
+		PhoneNumber: &number,
+		LastSeenIP:  "127.0.0.1",
+		Lines: []models.PhoneLine{
+			{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"user_name": "second"}`},
+			{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name": "first"}`},
+		},
+	}
+	if err := database.Create(&phone).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	entry := h.notifyPhone(context.Background(), phone, "resync")
+	if !entry.Success || entry.StatusCode != 200 || entry.Event != "check-sync;reboot=false" {
+		t.Fatalf("unexpected result: %+v", entry)
+	}
+	if msg := <-received; !strings.HasPrefix(msg, "NOTIFY sip:first@127.0.0.1:") {
+		t.Errorf("unexpected request line: %s", strings.SplitN(msg, "\r\n", 2)[0])
+	}
+
+	var logged []models.PhoneActionLog
+	database.Where("phone_id = ?", phone.ID).Find(&logged)
+	if len(logged) != 1 || !logged[0].Success {
+		t.Errorf("result not recorded: %+v", logged)
+	}
+
+	// The account of a profile member is inherited
+	member := models.Phone{Profile: &models.Profile{Lines: []models.ProfileLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name": "profile"}`},
+	}}}
+	if user := notifyUser(member); user != "profile" {
+		t.Errorf("expected the profile account, got %q", user)
+	}
+
+	// Without any address the action fails, and is recorded too
+	phone.LastSeenIP = ""
+	if entry := h.notifyPhone(context.Background(), phone, "reboot"); entry.Success || entry.Error == "" || entry.Event != "check-sync;reboot=true" {
+		t.Errorf("expected failure: %+v", entry)
+	}
+}
+
+func TestGetPhoneActions(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database}
+
+	for i := 0; i < maxPhoneActions+10; i++ {
+		database.Create(&models.PhoneActionLog{PhoneID: 1, Action: "resync"})
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/phones/1/actions"+query, nil), map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		h.GetPhoneActions(rr, req)
+		return rr
+	}
+
+	for query, want := range map[string]int{"": 50, "?limit=5": 5, "?limit=100000": maxPhoneActions} {
+		rr := get(query)
+		var resp struct {
+			Actions []models.PhoneActionLog `json:"actions"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusOK || len(resp.Actions) != want {
+			t.Errorf("%q: expected %d actions, got %d (%d)", query, want, len(resp.Actions), rr.Code)
+		}
+	}
+	for _, query := range []string{"?limit=abc", "?limit=0", "?limit=-1"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
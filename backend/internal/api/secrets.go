@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"gorm.io/gorm"
+)
+
+// revealSecrets reports whether the request asks for secret values in clear (?reveal_secrets=true).
+// It is only allowed if auth.allow_reveal_secrets is enabled in provisioning-system.yaml.
+func (h *PhoneHandler) revealSecrets(r *http.Request) (bool, error) {
+	if r.URL.Query().Get("reveal_secrets") != "true" {
+		return false, nil
+	}
+	if h.ProvManager.Config == nil || !h.ProvManager.Config.Auth.AllowRevealSecrets {
+		return false, &httpError{Status: http.StatusForbidden, Message: "Revealing secrets is disabled (auth.allow_reveal_secrets)"}
+	}
+	logger.Warn("Secrets revealed to %s: %s", r.RemoteAddr, r.URL.String())
+	return true, nil
+}
+
+// responsePhone prepares a phone for an API response: secrets are masked unless revealed
+func (h *PhoneHandler) responsePhone(phone models.Phone, reveal bool) models.Phone {
+	if reveal {
+		opened, err := h.ProvManager.OpenPhone(phone)
+		if err == nil {
+			return opened
+		}
+		logger.Error("Failed to reveal secrets: %v", err)
+	}
+	phone.Lines = append([]models.PhoneLine(nil), phone.Lines...)
+	h.ProvManager.MaskPhone(&phone)
+	return phone
+}
+
+// responseProfile masks the secrets of the profile lines
+func (h *PhoneHandler) responseProfile(profile models.Profile) models.Profile {
+	profile.Lines = append([]models.ProfileLine(nil), profile.Lines...)
+	for i := range profile.Lines {
+		profile.Lines[i].AdditionalInfo = h.ProvManager.MaskInfo(profile.Vendor, profile.Lines[i].Type, profile.Lines[i].AdditionalInfo)
+	}
+	return profile
+}
+
+// sealProfileLines encrypts the secret values of the profile lines, previous are the stored lines
+func (h *PhoneHandler) sealProfileLines(profile *models.Profile, previous []models.ProfileLine) error {
+	for i := range profile.Lines {
+		l := &profile.Lines[i]
+		prev := ""
+		for _, p := range previous {
+			if p.Type == l.Type && p.AccountNumber == l.AccountNumber && equalIntPtr(p.PanelNumber, l.PanelNumber) && equalIntPtr(p.KeyNumber, l.KeyNumber) {
+				prev = p.AdditionalInfo
+				break
+			}
+		}
+		sealed, err := h.ProvManager.SealInfo(profile.Vendor, l.Type, l.AdditionalInfo, prev)
+		if err != nil {
+			return err
+		}
+		l.AdditionalInfo = sealed
+	}
+	return nil
+}
+
+func equalIntPtr(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// EncryptStoredSecrets encrypts secret values stored in clear (before encryption was enabled
+// or params were marked secret). Returns the number of updated lines.
+func EncryptStoredSecrets(db *gorm.DB, pm *provisioner.Manager) (int, error) {
+	if pm.Secrets == nil {
+		return 0, nil
+	}
+	updated := 0
+
+	var phones []models.Phone
+	if err := db.Preload("Lines").Find(&phones).Error; err != nil {
+		return 0, err
+	}
+	for _, phone := range phones {
+		for _, l := range phone.Lines {
+			sealed, err := pm.SealInfo(phone.Vendor, l.Type, l.AdditionalInfo, "")
+			if err != nil {
+				return updated, err
+			}
+			if sealed == l.AdditionalInfo {
+				continue
+			}
+			if err := db.Model(&models.PhoneLine{}).Where("id = ?", l.ID).Update("additional_info", sealed).Error; err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+
+	var profiles []models.Profile
+	if err := db.Preload("Lines").Find(&profiles).Error; err != nil {
+		return updated, err
+	}
+	for _, profile := range profiles {
+		for _, l := range profile.Lines {
+			sealed, err := pm.SealInfo(profile.Vendor, l.Type, l.AdditionalInfo, "")
+			if err != nil {
+				return updated, err
+			}
+			if sealed == l.AdditionalInfo {
+				continue
+			}
+			if err := db.Model(&models.ProfileLine{}).Where("id = ?", l.ID).Update("additional_info", sealed).Error; err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"provisioning-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// checkSIPAccounts rejects account lines (and accounts inherited from the profile) whose SIP user name
+// is already used in the domain
+func (h *PhoneHandler) checkSIPAccounts(phone *models.Phone) error {
+	conflicts, err := models.FindSIPAccountConflicts(h.DB, phone)
+	if err != nil {
+		return err
+	}
+	ve := &validationError{}
+	for _, c := range conflicts {
+		field := fmt.Sprintf("lines[%d].user_name", c.Line)
+		if c.ProfileID != nil {
+			field = "profile_id"
+		}
+		if c.PhoneID == phone.ID {
+			ve.add(field, "SIP user %s is used by another line of the phone", c.UserName)
+		} else {
+			ve.add(field, "%s", c.Error())
+		}
+	}
+	return ve.err()
+}
+
+// syncSIPAccounts updates the accounts of a phone saved in the transaction, a conflict is a 409
+func syncSIPAccounts(tx *gorm.DB, phone *models.Phone) error {
+	err := models.SyncSIPAccounts(tx, phone)
+	if conflict, ok := err.(*models.SIPAccountConflict); ok {
+		return &httpError{Status: http.StatusConflict, Message: conflict.Error()}
+	}
+	return duplicateError(err)
+}
+
+// GetSIPAccounts handles GET /api/sip-accounts: which phones register an account.
+// Filters: domain, user_name, auth_name, server (* wildcards), q (user, auth or display name), phone_id.
+func (h *PhoneHandler) GetSIPAccounts(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Model(&models.SIPAccount{})
+
+	params := r.URL.Query()
+	if domain := params.Get("domain"); domain != "" {
+		query = query.Where("domain = ?", domain)
+	}
+	for _, column := range []string{"user_name", "auth_name", "server"} {
+		if v := params.Get(column); v != "" {
+			query = query.Where(column+" LIKE ?", strings.ReplaceAll(v, "*", "%"))
+		}
+	}
+	if q := params.Get("q"); q != "" {
+		q = "%" + strings.ReplaceAll(q, "*", "%") + "%"
+		query = query.Where(h.DB.Where("user_name LIKE ?", q).Or("auth_name LIKE ?", q).Or("display_name LIKE ?", q))
+	}
+	if phoneID := params.Get("phone_id"); phoneID != "" {
+		query = query.Where("phone_id = ?", phoneID)
+	}
+
+	var accounts []models.SIPAccount
+	if err := query.Preload("Phone").Order("domain, user_name, phone_id, account_number").Find(&accounts).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch SIP accounts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
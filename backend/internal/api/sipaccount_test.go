@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func TestSIPAccounts(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database}
+
+	first := models.Phone{Domain: "office", Vendor: "yealink", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"1234","display_name":"Reception","custom_sip_server":{"registrar_ip":"10.0.0.1","registrar_port":5061}}`},
+		{Type: "blf", AdditionalInfo: `{"value":"1235"}`},
+	}}
+	if err := database.Create(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := syncSIPAccounts(database, &first); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	var accounts []models.SIPAccount
+	database.Find(&accounts)
+	if len(accounts) != 1 {
+		t.Fatalf("expected 1 account, got %+v", accounts)
+	}
+	if a := accounts[0]; a.UserName != "1234" || a.DisplayName != "Reception" || a.Server != "10.0.0.1:5061" || a.PhoneLineID != first.Lines[0].ID {
+		t.Errorf("unexpected account %+v", a)
+	}
+
+	// The same user name: rejected in the domain, allowed in another one
+	second := models.Phone{Domain: "office", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"1000"}`},
+		{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"user_name":"1234"}`},
+	}}
+	err := h.checkSIPAccounts(&second)
+	ve, ok := err.(*validationError)
+	if !ok || len(ve.Fields) != 1 || ve.Fields[0].Field != "lines[1].user_name" {
+		t.Fatalf("duplicate not rejected: %v", err)
+	}
+	second.Domain = "branch"
+	if err := h.checkSIPAccounts(&second); err != nil {
+		t.Errorf("other domain rejected: %v", err)
+	}
+
+	// Updating the phone itself is not a conflict
+	if err := h.checkSIPAccounts(&first); err != nil {
+		t.Errorf("own account rejected: %v", err)
+	}
+
+	// Existing data: accounts are rebuilt from the lines, duplicates are reported
+	dup := models.Phone{Domain: "office", Lines: []models.PhoneLine{{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"1234"}`}}}
+	database.Create(&dup)
+	n, skipped, err := models.RebuildSIPAccounts(database)
+	if err != nil || n != 1 || len(skipped) != 1 || skipped[0].PhoneID != first.ID || skipped[0].LinePhoneID != dup.ID || skipped[0].Line != 0 {
+		t.Errorf("rebuild: %d %+v %v", n, skipped, err)
+	}
+
+	// Accounts inherited from a profile are indexed for every phone of it, and are not unique
+	profile := models.Profile{Name: "reception", Vendor: "yealink", Lines: []models.ProfileLine{
+		{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"user_name":"shared"}`},
+	}}
+	database.Create(&profile)
+	for _, number := range []string{"1300", "1301"} {
+		member := models.Phone{Domain: "office", ProfileID: &profile.ID, Lines: []models.PhoneLine{
+			{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"` + number + `"}`},
+		}}
+		database.Create(&member)
+		if err := syncSIPAccounts(database, &member); err != nil {
+			t.Fatalf("sync member: %v", err)
+		}
+	}
+	var inherited []models.SIPAccount
+	database.Where("user_name = ?", "shared").Find(&inherited)
+	if len(inherited) != 2 || inherited[0].ProfileID == nil || *inherited[0].ProfileID != profile.ID || inherited[0].PhoneLineID != 0 {
+		t.Errorf("inherited accounts not indexed: %+v", inherited)
+	}
+	if n, _, err := models.RebuildSIPAccounts(database); err != nil || n != 5 {
+		t.Errorf("rebuild with profiles: %d %v", n, err)
+	}
+}
+
+func TestInheritedSIPAccountConflicts(t *testing.T) {
+	database := newTestDB(t)
+	h := &PhoneHandler{DB: database, ProvManager: &provisioner.Manager{
+		Vendors: []provisioner.VendorConfig{{ID: "yealink"}},
+	}}
+
+	owner := models.Phone{Domain: "office", Vendor: "yealink", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"1234"}`},
+	}}
+	database.Create(&owner)
+	if err := syncSIPAccounts(database, &owner); err != nil {
+		t.Fatal(err)
+	}
+	profile := models.Profile{Name: "reception", Vendor: "yealink", Lines: []models.ProfileLine{
+		{Type: "Line", AccountNumber: 2, AdditionalInfo: `{"user_name":"shared"}`},
+	}}
+	database.Create(&profile)
+	member := models.Phone{Domain: "office", Vendor: "yealink", ProfileID: &profile.ID, Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"1300"}`},
+	}}
+	database.Create(&member)
+	if err := syncSIPAccounts(database, &member); err != nil {
+		t.Fatal(err)
+	}
+
+	// An own account of another phone with the inherited user name
+	other := models.Phone{Domain: "office", Vendor: "yealink", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"shared"}`},
+	}}
+	var ve *validationError
+	if err := h.checkSIPAccounts(&other); !errors.As(err, &ve) || ve.Fields[0].Field != "lines[0].user_name" {
+		t.Fatalf("own account taking an inherited user name not rejected: %v", err)
+	}
+
+	// A profile account with the user name of another phone: rejected for its members
+	profile.Lines[0].AdditionalInfo = `{"user_name":"1234"}`
+	err := h.validateProfile(&profile, []models.Phone{member})
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Field != "phones[2].lines[0].user_name" {
+		t.Fatalf("inherited account taking a used user name not rejected: %v", err)
+	}
+	database.Model(&profile.Lines[0]).Update("additional_info", profile.Lines[0].AdditionalInfo)
+	member.Profile = nil
+	var he *httpError
+	if err := syncSIPAccounts(database, &member); !errors.As(err, &he) || he.Status != http.StatusConflict {
+		t.Fatalf("expected a conflict on sync, got %v", err)
+	}
+	member.Profile = &profile
+	if err := h.checkSIPAccounts(&member); !errors.As(err, &ve) || ve.Fields[0].Field != "profile_id" {
+		t.Fatalf("expected a profile_id error, got %v", err)
+	}
+}
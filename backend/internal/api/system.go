@@ -8,14 +8,15 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"provisioning-system/internal/backup"
+	"provisioning-system/internal/broadcaster"
 	"provisioning-system/internal/config"
 	"provisioning-system/internal/db"
+	"provisioning-system/internal/deploy"
 	"provisioning-system/internal/license"
 	"provisioning-system/internal/logger"
 	"provisioning-system/internal/models"
@@ -37,6 +38,8 @@ type SystemHandler struct {
 	LicenseManager *license.Manager
 	LogFile        string
 	TFTPServer     *tftp.Server
+	Events         *broadcaster.Broadcaster // Optional: system event bus
+	Queue          *deploy.Queue            // Optional: per-domain deploy queue
 }
 
 func NewSystemHandler(configDir string, cfg **config.SystemConfig, pm *provisioner.Manager, db *gorm.DB, bm *backup.Manager, lm *license.Manager, logFile string, tftpSrv *tftp.Server) *SystemHandler {
@@ -105,7 +108,7 @@ func (h *SystemHandler) Reload(w http.ResponseWriter, r *http.Request) {
 	var phones []models.Phone
 	var warnings []string
 
-	if result := h.DB.Preload("Lines").Find(&phones); result.Error != nil {
+	if result := models.PreloadPhone(h.DB).Find(&phones); result.Error != nil {
 		log.Printf("Failed to fetch phones for config generation: %v", result.Error)
 		warnings = append(warnings, fmt.Sprintf("Failed to fetch phones: %v", result.Error))
 	}
@@ -130,6 +133,11 @@ func (h *SystemHandler) Reload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	h.Events.Publish(broadcaster.TypeConfigGenerated, "", map[string]interface{}{
+		"phones":   len(phones),
+		"warnings": warnings,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":   "ok",
@@ -169,10 +177,13 @@ func (h *SystemHandler) ApplyConfig(w http.ResponseWriter, r *http.Request) {
 	if err := os.Rename(preDir, targetDir); err != nil {
 		// Try to restore backup if move failed
 		os.Rename(backupDir, targetDir)
+		h.Events.Publish(broadcaster.TypeConfigRolledBack, "", map[string]string{"error": err.Error()})
 		http.Error(w, fmt.Sprintf(`{"error": "Failed to apply configuration: %v"}`, err), http.StatusInternalServerError)
 		return
 	}
 
+	h.Events.Publish(broadcaster.TypeConfigApplied, "", nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "Configuration applied successfully."}`))
 }
@@ -191,15 +202,25 @@ func (h *SystemHandler) GetDomains(w http.ResponseWriter, r *http.Request) {
 		detailedDomains = append(detailedDomains, d)
 	}
 
+	// Last deploy run of every domain
+	deployStatus, err := deploy.LastRuns(h.DB)
+	if err != nil {
+		logger.Warn("Failed to load deploy status: %v", err)
+		deployStatus = map[string]models.DeployRun{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"domains":          domains,
 		"detailed_domains": detailedDomains,
+		"deploy_status":    deployStatus,
 	})
 }
 
 type DeployRequest struct {
 	Domain string `json:"domain"`
+	DryRun bool   `json:"dry_run"` // Only render the commands and plan target syncs
+	Force  bool   `json:"force"`   // Upload all files to deploy targets, not only changed ones
 }
 
 func (h *SystemHandler) Deploy(w http.ResponseWriter, r *http.Request) {
@@ -224,47 +245,57 @@ func (h *SystemHandler) Deploy(w http.ResponseWriter, r *http.Request) {
 	cfg := *h.Config
 	domainCfg := cfg.GetEffectiveDomainConfig(domainName)
 
-	if domainCfg.DeployCmd == "" {
-		http.Error(w, fmt.Sprintf(`{"error": "No deploy command defined for domain '%s'"}`, domainName), http.StatusBadRequest)
+	if len(domainCfg.DeployCommands) == 0 && len(domainCfg.DeployTargets) == 0 {
+		http.Error(w, fmt.Sprintf(`{"error": "No deploy command or target defined for domain '%s'"}`, domainName), http.StatusBadRequest)
 		return
 	}
 
-	// Execute command
-	// We pass the temp_configs/<domain> path as an environment variable PROVISIONING_SOURCE
-	// and also as a simple replacement {{ source }} if we want to support simple templating later.
-	// For now, just executing the command.
-
-	cmdParts := strings.Fields(domainCfg.DeployCmd)
-	if len(cmdParts) == 0 {
-		http.Error(w, "Empty deploy command", http.StatusBadRequest)
-		return
+	// Domain-wide deploy: no phone in the template data.
+	// The temp_configs/<domain> path is passed as PROVISIONING_SOURCE.
+	origin := deploy.Origin{Action: models.DeployActionDeploy, Trigger: models.TriggerManual}
+	var result *deploy.Result
+	var run *models.DeployRun
+	var err error
+	execute := func() {
+		result, run, err = h.hooks().run(r.Context(), domainName, domainCfg, origin, nil, req.DryRun, req.Force)
+	}
+	if req.DryRun {
+		execute()
+	} else {
+		// One in-flight deploy per domain
+		if err := h.Queue.Do(r.Context(), deploy.JobState{Domain: domainName, Action: origin.Action, Trigger: origin.Trigger}, execute); err != nil {
+			http.Error(w, fmt.Sprintf("Deploy cancelled while waiting for the running deploy of %s: %v", domainName, err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	output := run.Output
+	if req.DryRun {
+		run = nil // Dry runs are not recorded
 	}
 
-	cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
-
-	// Set environment variables
-	sourceDir, _ := filepath.Abs(filepath.Join(h.ConfigDir, "temp_configs", domainName))
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("PROVISIONING_DOMAIN=%s", domainName),
-		fmt.Sprintf("PROVISIONING_SOURCE=%s", sourceDir),
-	)
-
-	output, err := cmd.CombinedOutput()
+	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		log.Printf("Deploy failed for %s: %v. Output: %s", domainName, err, string(output))
+		log.Printf("Deploy failed for %s: %v", domainName, err)
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
+		json.NewEncoder(w).Encode(map[string]interface{}{
 			"error":  fmt.Sprintf("Deploy failed: %v", err),
-			"output": string(output),
+			"output": output,
+			"run":    run,
+			"result": result,
 		})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	message := fmt.Sprintf("Deployed successfully to %s", domainName)
+	if req.DryRun {
+		message = fmt.Sprintf("Dry run for %s: commands rendered, nothing executed", domainName)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "ok",
-		"message": fmt.Sprintf("Deployed successfully to %s", domainName),
-		"output":  string(output),
+		"message": message,
+		"output":  output,
+		"run":     run,
+		"result":  result,
 	})
 }
 
@@ -279,6 +310,8 @@ func (h *SystemHandler) CreateDBBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.Events.Publish(broadcaster.TypeBackupCreated, "", map[string]string{"type": string(backup.BackupTypeDB)})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "Database backup created successfully"}`))
 }
@@ -294,6 +327,8 @@ func (h *SystemHandler) CreateConfigBackup(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	h.Events.Publish(broadcaster.TypeBackupCreated, "", map[string]string{"type": string(backup.BackupTypeConfig)})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "Configuration backup created successfully"}`))
 }
@@ -439,6 +474,8 @@ func (h *SystemHandler) RestoreDBBackup(w http.ResponseWriter, r *http.Request)
 	// Update the global DB instance
 	*h.DB = *newDB
 
+	h.Events.Publish(broadcaster.TypeBackupRestored, "", map[string]string{"type": string(backup.BackupTypeDB), "filename": req.Filename})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "Database restored successfully"}`))
 }
@@ -472,6 +509,7 @@ func (h *SystemHandler) RestoreConfigBackup(w http.ResponseWriter, r *http.Reque
 	}
 
 	logger.Info("RestoreConfig successfully completed for: %s", req.Filename)
+	h.Events.Publish(broadcaster.TypeBackupRestored, "", map[string]string{"type": string(backup.BackupTypeConfig), "filename": req.Filename})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "Configuration restored successfully. Please 'Reload' and 'Apply' to finalize."}`))
@@ -506,6 +544,13 @@ func (h *SystemHandler) UploadLicense(w http.ResponseWriter, r *http.Request) {
 
 	h.LicenseManager.Reload()
 
+	status := h.LicenseManager.GetStatus()
+	h.Events.Publish(broadcaster.TypeLicenseChanged, "", map[string]interface{}{
+		"tier":      status.Tier,
+		"issued_to": status.IssuedTo,
+		"expiry":    status.Expiry,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ok", "message": "License uploaded successfully"}`))
 }
@@ -529,16 +574,16 @@ func (h *SystemHandler) GenerateSupportBundle(w http.ResponseWriter, r *http.Req
 	zw := zip.NewWriter(outFile)
 	defer zw.Close()
 
-	// 1. Add Entire Config Dir (recursive)
-	if err := h.BackupManager.AddDirToZip(zw, h.ConfigDir, "config"); err != nil {
+	// 1. Add Config Dir (recursive): without the master key, generated configs and databases,
+	// passwords and keys of the yaml files are masked
+	backupDir := h.BackupManager.Config.Database.BackupDir
+	if err := addRedactedConfigDir(zw, h.ConfigDir, backupDir, "config"); err != nil {
 		logger.Warn("Failed to add config to support bundle: %v", err)
 	}
 
 	// 2. Add Database
-	// We should probably use a snapshot or just copy the file if it's small
-	// For support bundle, a direct copy of the DB file is usually fine if we don't care about absolute consistency
-	dbPath := (*h.Config).Database.Path
-	if err := h.BackupManager.AddFileToZip(zw, dbPath, "provisioning.db"); err != nil {
+	// Snapshot (VACUUM INTO) with masked secrets: SIP passwords and webhook secrets never leave the server
+	if err := addRedactedDatabase(zw, h.DB, h.ProvManager, "provisioning.db"); err != nil {
 		logger.Warn("Failed to add database to support bundle: %v", err)
 	}
 
@@ -581,6 +626,13 @@ type DashboardStats struct {
 	Count  int64  `json:"count"`
 }
 
+type FirmwareStats struct {
+	Vendor          string `json:"vendor"`
+	ReportedModel   string `json:"reported_model"`
+	FirmwareVersion string `json:"firmware_version"`
+	Count           int64  `json:"count"`
+}
+
 func (h *SystemHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
 	var stats []DashboardStats
 	// GORM query to group by domain and vendor
@@ -592,6 +644,20 @@ func (h *SystemHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
 	var totalPhones int64
 	h.DB.Model(&models.Phone{}).Count(&totalPhones)
 
+	// Check-in statistics
+	now := time.Now()
+	var seen24h, seen7d, neverSeen int64
+	h.DB.Model(&models.Phone{}).Where("last_seen_at >= ?", now.Add(-24*time.Hour)).Count(&seen24h)
+	h.DB.Model(&models.Phone{}).Where("last_seen_at >= ?", now.AddDate(0, 0, -7)).Count(&seen7d)
+	h.DB.Model(&models.Phone{}).Where("last_seen_at IS NULL").Count(&neverSeen)
+
+	var firmwareStats []FirmwareStats
+	h.DB.Model(&models.Phone{}).
+		Select("vendor, reported_model, firmware_version, count(*) as count").
+		Where("firmware_version <> ''").
+		Group("vendor, reported_model, firmware_version").
+		Scan(&firmwareStats)
+
 	w.Header().Set("Content-Type", "application/json")
 	
 	tftpStatus := map[string]interface{}{
@@ -608,6 +674,13 @@ func (h *SystemHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
 		"total_phones": totalPhones,
 		"license":      h.LicenseManager.GetStatus(),
 		"tftp":         tftpStatus,
+		"checkin": map[string]interface{}{
+			"seen_24h":    seen24h,
+			"seen_7d":     seen7d,
+			"not_seen_7d": totalPhones - seen7d,
+			"never_seen":  neverSeen,
+			"firmware":    firmwareStats,
+		},
 	})
 }
 
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"path/filepath"
+	"testing"
+
+	"provisioning-system/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a migrated database in the temp dir of the test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+	return database
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/models"
+)
+
+// GetUnprovisioned handles GET /api/unprovisioned
+// Query params: vendor
+func (h *PhoneHandler) GetUnprovisioned(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Model(&models.UnprovisionedDevice{})
+	if vendor := r.URL.Query().Get("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+
+	var devices []models.UnprovisionedDevice
+	if err := query.Order("last_seen desc").Find(&devices).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch unprovisioned devices: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices": devices,
+	})
+}
+
+type ClaimRequest struct {
+	Domain      string `json:"domain"`
+	ModelID     string `json:"model_id"`
+	PhoneNumber string `json:"phone_number"`
+	Description string `json:"description"`
+	AutoNumber  bool   `json:"auto_number"` // Take the next free number from the domain number_pool
+}
+
+// ClaimUnprovisioned handles POST /api/unprovisioned/{id}/claim
+// Creates a phone from an unknown device with the chosen domain and model.
+func (h *PhoneHandler) ClaimUnprovisioned(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var device models.UnprovisionedDevice
+	if err := h.DB.First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	var req ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Domain == "" || req.ModelID == "" {
+		http.Error(w, "Domain and model_id are required", http.StatusBadRequest)
+		return
+	}
+
+	var vendor string
+	for _, m := range h.ProvManager.Models {
+		if m.ID == req.ModelID {
+			vendor = m.Vendor
+			break
+		}
+	}
+	if vendor == "" {
+		http.Error(w, "Model not found", http.StatusBadRequest)
+		return
+	}
+
+	number := req.PhoneNumber
+	if number == "" && req.AutoNumber {
+		next, err := h.nextFreeNumber(req.Domain)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		number = next
+	}
+
+	mac := macaddr.Colon(device.MacAddress)
+	phone := models.Phone{
+		Domain:      req.Domain,
+		Vendor:      vendor,
+		ModelID:     req.ModelID,
+		MacAddress:  &mac,
+		IPAddress:   device.IPAddress,
+		Description: req.Description,
+	}
+
+	if number != "" {
+		phone.PhoneNumber = &number
+
+		// First account registers the assigned number
+		info, _ := json.Marshal(map[string]interface{}{
+			"user_name":    number,
+			"auth_name":    number,
+			"display_name": number,
+		})
+		keyNum, panelNum := 1, 0
+		phone.Lines = []models.PhoneLine{
+			{
+				Type:           "Line",
+				KeyNumber:      &keyNum,
+				PanelNumber:    &panelNum,
+				AccountNumber:  1,
+				AdditionalInfo: string(info),
+			},
+		}
+	}
+
+	deployed, err := h.createPhone(&phone)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(phoneResponse{Phone: h.responsePhone(phone, false), phoneDeploy: deployed})
+}
+
+// DeleteUnprovisioned handles DELETE /api/unprovisioned/{id}
+func (h *PhoneHandler) DeleteUnprovisioned(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := h.DB.Delete(&models.UnprovisionedDevice{}, id).Error; err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete device: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "ok", "message": "Device removed from inbox"}`))
+}
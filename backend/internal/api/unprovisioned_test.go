@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/gorilla/mux"
+)
+
+func TestClaimUnprovisioned(t *testing.T) {
+	database := newTestDB(t)
+	pm := provisioner.NewManager(&config.SystemConfig{Domains: []config.DomainSettings{{Name: "office"}}})
+	if err := pm.LoadVendors("../../../conf/vendors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.LoadModels(); err != nil {
+		t.Fatal(err)
+	}
+	h := &PhoneHandler{DB: database, ProvManager: pm, ConfigDir: t.TempDir()}
+	t.Cleanup(h.background.Wait)
+
+	device := models.UnprovisionedDevice{MacAddress: "001565aabbcc", Vendor: "yealink", IPAddress: "10.0.0.7", RequestCount: 3}
+	database.Create(&device)
+
+	claim := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/unprovisioned/1/claim", strings.NewReader(body))
+		h.ClaimUnprovisioned(rec, mux.SetURLVars(req, map[string]string{"id": "1"}))
+		return rec
+	}
+
+	if rec := claim(`{"domain":"office","model_id":"no-such-model"}`); rec.Code != 400 {
+		t.Errorf("unknown model: status %d", rec.Code)
+	}
+
+	rec := claim(`{"domain":"office","model_id":"yealink-SIP-T46U","phone_number":"101","description":"Reception"}`)
+	if rec.Code != 201 {
+		t.Fatalf("claim: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var phone models.Phone
+	if err := json.Unmarshal(rec.Body.Bytes(), &phone); err != nil {
+		t.Fatal(err)
+	}
+	if phone.MacAddress == nil || *phone.MacAddress != "00:15:65:aa:bb:cc" || phone.IPAddress != "10.0.0.7" || phone.Vendor != "yealink" {
+		t.Errorf("unexpected phone %+v", phone)
+	}
+	if len(phone.Lines) != 1 || !strings.Contains(phone.Lines[0].AdditionalInfo, `"user_name":"101"`) {
+		t.Errorf("first account not created: %+v", phone.Lines)
+	}
+
+	var count int64
+	database.Model(&models.UnprovisionedDevice{}).Count(&count)
+	if count != 0 {
+		t.Error("claimed device left in the inbox")
+	}
+	if rec := claim(`{"domain":"office","model_id":"yealink-SIP-T46U"}`); rec.Code != 404 {
+		t.Errorf("second claim: status %d", rec.Code)
+	}
+}
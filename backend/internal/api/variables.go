@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/variables"
+
+	"github.com/gorilla/mux"
+)
+
+// GetPhoneVariables handles GET /api/phones/{id}/variables
+// Returns the effective template variables of the phone, where each value comes from and the values it overrides
+func (h *PhoneHandler) GetPhoneVariables(w http.ResponseWriter, r *http.Request) {
+	var phone models.Phone
+	if err := h.DB.Preload("Profile").First(&phone, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Phone not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"phone_id":   phone.ID,
+		"precedence": variables.Precedence,
+		"variables":  h.ProvManager.PhoneVariables(phone),
+	})
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/webhook"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	DB         *gorm.DB
+	Dispatcher *webhook.Dispatcher
+}
+
+func NewWebhookHandler(db *gorm.DB, d *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		DB:         db,
+		Dispatcher: d,
+	}
+}
+
+// webhookResponse hides the secret, only tells whether one is set
+type webhookResponse struct {
+	models.Webhook
+	Secret    string `json:"secret,omitempty"`
+	HasSecret bool   `json:"has_secret"`
+}
+
+func toWebhookResponse(hook models.Webhook) webhookResponse {
+	return webhookResponse{Webhook: hook, HasSecret: hook.Secret != ""}
+}
+
+func validateWebhook(hook *models.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &httpError{Status: http.StatusBadRequest, Message: "Webhook URL must be an absolute http(s) URL"}
+	}
+	return nil
+}
+
+// GetWebhooks handles GET /api/webhooks
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	var hooks []models.Webhook
+	if err := h.DB.Order("id").Find(&hooks).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]webhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		result = append(result, toWebhookResponse(hook))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": result,
+	})
+}
+
+// CreateWebhook handles POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	hook.ID = 0
+	if err := validateWebhook(&hook); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.DB.Create(&hook).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.Dispatcher.Reload()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toWebhookResponse(hook))
+}
+
+// UpdateWebhook handles PUT /api/webhooks/{id}
+// An empty secret keeps the current one.
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var existing models.Webhook
+	if err := h.DB.First(&existing, id).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhook(&req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	existing.Name = req.Name
+	existing.URL = req.URL
+	existing.Events = req.Events
+	existing.Domain = req.Domain
+	existing.Enabled = req.Enabled
+	if req.Secret != "" {
+		existing.Secret = req.Secret
+	}
+
+	if err := h.DB.Save(&existing).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.Dispatcher.Reload()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toWebhookResponse(existing))
+}
+
+// DeleteWebhook handles DELETE /api/webhooks/{id}
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	result := h.DB.Delete(&models.Webhook{}, id)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	h.DB.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{})
+	h.Dispatcher.Reload()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "ok", "message": "Webhook deleted successfully"}`))
+}
+
+// GetDeliveries handles GET /api/webhooks/{id}/deliveries
+// Query params: status, page, limit
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	page, limit := 1, 50
+	if p := r.URL.Query().Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	query := h.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", id)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id desc").Limit(limit).Offset((page - 1) * limit).Find(&deliveries).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// Redeliver handles POST /api/webhooks/deliveries/{id}/redeliver
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	var id uint
+	if _, err := fmt.Sscanf(mux.Vars(r)["id"], "%d", &id); err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.Dispatcher.Redeliver(id)
+	if err == gorm.ErrRecordNotFound {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -1,11 +1,46 @@
 package broadcaster
 
 import (
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// HistorySize is the number of recent events kept for Last-Event-ID resumption
+const HistorySize = 1000
+
+// Event types published on the bus
+const (
+	TypeDeviceAccess      = "device.access" // Data: LogEvent
+	TypeDeviceFirstSeen   = "device.first_seen"
+	TypeDeviceFetchFailed = "device.fetch_failed" // Data: LogEvent
+	TypePhoneCreated      = "phone.created"
+	TypePhoneUpdated      = "phone.updated"
+	TypePhoneDeleted      = "phone.deleted"
+	TypePhoneAction       = "phone.action" // Data: models.PhoneActionLog
+	TypeConfigGenerated   = "config.generated"
+	TypeConfigApplied     = "config.applied"
+	TypeConfigRolledBack  = "config.rolled_back"
+	TypeDeployResult      = "deploy.result"
+	TypeBackupCreated     = "backup.created"
+	TypeBackupRestored    = "backup.restored"
+	TypeLicenseChanged    = "license.changed"
+)
+
+// Event is a system event. Data is type specific and must be JSON serializable.
+type Event struct {
+	ID     uint64      `json:"id"`
+	Type   string      `json:"type"`
+	Time   time.Time   `json:"time"`
+	Domain string      `json:"domain,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// LogEvent is the payload of device.access events
 type LogEvent struct {
+	ID            uint64    `json:"id,omitempty"`
 	Time          time.Time `json:"time"`
 	SourceIP      string    `json:"source_ip"`
 	StatusCode    int       `json:"status_code"`
@@ -15,45 +50,198 @@ type LogEvent struct {
 	Message       string    `json:"message,omitempty"`
 }
 
+// Subscription is a single consumer of the event stream
+type Subscription struct {
+	C       chan Event
+	types   []string
+	dropped atomic.Int64
+}
+
+// Dropped returns how many events were not delivered because the subscriber was too slow
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Wants reports whether the subscription is interested in the event type
+func (s *Subscription) Wants(eventType string) bool {
+	return MatchTypes(s.types, eventType)
+}
+
+// MatchTypes reports whether eventType matches one of the patterns.
+// Patterns are exact types, "*" or a prefix wildcard like "phone.*". No patterns match everything.
+func MatchTypes(patterns []string, eventType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*" || p == eventType {
+			return true
+		}
+		if strings.HasSuffix(p, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
 type Broadcaster struct {
-	subscribers []chan LogEvent
+	subscribers []*Subscription
 	mu          sync.Mutex
+
+	// Кольцевой буфер последних событий
+	history []Event
+	next    int
+	lastID  uint64
+
+	// Epoch отличает ID событий этого процесса: после перезапуска ID снова начинаются с 1
+	epoch string
 }
 
 func New() *Broadcaster {
 	return &Broadcaster{
-		subscribers: make([]chan LogEvent, 0),
+		subscribers: make([]*Subscription, 0),
+		history:     make([]Event, 0, HistorySize),
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// EventID returns the external (SSE) form of an event ID: "<epoch>-<id>"
+func (b *Broadcaster) EventID(id uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// ParseEventID parses an ID returned by EventID. ok is false if the ID is malformed or comes from
+// another process (before a restart): the client cannot resume and has to resync its state.
+func (b *Broadcaster) ParseEventID(s string) (id uint64, ok bool) {
+	epoch, n, found := strings.Cut(s, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || id > b.lastEventID() {
+		return 0, false
 	}
+	return id, true
+}
+
+func (b *Broadcaster) lastEventID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Subscribe subscribes to events of the given types (all events if none given)
+func (b *Broadcaster) Subscribe(types ...string) *Subscription {
+	sub, _, _ := b.SubscribeFrom(0, types...)
+	return sub
+}
+
+// SubscribeSink subscribes an in-process consumer (file sink, DB store, webhooks).
+// Sinks get a larger buffer than network clients.
+func (b *Broadcaster) SubscribeSink(types ...string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribe(4096, types)
 }
 
-func (b *Broadcaster) Subscribe() chan LogEvent {
+// SubscribeFrom subscribes and atomically returns buffered events with ID > lastID,
+// so that nothing is lost or duplicated between the replay and the live stream.
+// missed is the number of events after lastID that are no longer in the buffer
+// (of any type, so for a filtered subscription it is an upper bound).
+// With lastID == 0 no history is returned.
+func (b *Broadcaster) SubscribeFrom(lastID uint64, types ...string) (sub *Subscription, history []Event, missed int64) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	ch := make(chan LogEvent, 100) // Buffer to prevent blocking
-	b.subscribers = append(b.subscribers, ch)
-	return ch
+
+	sub = b.subscribe(100, types) // Buffer to prevent blocking
+	if lastID == 0 || len(b.history) == 0 {
+		return sub, nil, 0
+	}
+	if oldest := b.history[b.next%len(b.history)].ID; oldest > lastID+1 {
+		missed = int64(oldest - lastID - 1)
+	}
+	return sub, b.since(lastID, sub), missed
 }
 
-func (b *Broadcaster) Unsubscribe(ch chan LogEvent) {
+func (b *Broadcaster) subscribe(size int, types []string) *Subscription {
+	sub := &Subscription{C: make(chan Event, size), types: types}
+	b.subscribers = append(b.subscribers, sub)
+	return sub
+}
+
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	for i, sub := range b.subscribers {
-		if sub == ch {
-			close(sub)
+	for i, s := range b.subscribers {
+		if s == sub {
+			close(s.C)
 			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
 			return
 		}
 	}
 }
 
+// Publish sends a new event to the bus. Safe to call on a nil Broadcaster (no-op).
+func (b *Broadcaster) Publish(eventType, domain string, data interface{}) {
+	if b == nil {
+		return
+	}
+	b.publish(Event{
+		Type:   eventType,
+		Time:   time.Now(),
+		Domain: domain,
+		Data:   data,
+	})
+}
+
+// Broadcast publishes a device access event
 func (b *Broadcaster) Broadcast(event LogEvent) {
+	if b == nil {
+		return
+	}
+	t := event.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	b.publish(Event{Type: TypeDeviceAccess, Time: t, Data: event})
+}
+
+// publish assigns the next event ID, stores the event in the history buffer and sends it to subscribers
+func (b *Broadcaster) publish(event Event) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	for _, ch := range b.subscribers {
+
+	b.lastID++
+	event.ID = b.lastID
+
+	if len(b.history) < HistorySize {
+		b.history = append(b.history, event)
+	} else {
+		b.history[b.next] = event
+		b.next = (b.next + 1) % HistorySize
+	}
+
+	for _, sub := range b.subscribers {
+		if !sub.Wants(event.Type) {
+			continue
+		}
 		select {
-		case ch <- event:
+		case sub.C <- event:
 		default:
-			// Drop event if subscriber is too slow
+			// Subscriber is too slow
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// since returns buffered events with ID > lastID wanted by sub, in order. Caller must hold the lock.
+func (b *Broadcaster) since(lastID uint64, sub *Subscription) []Event {
+	var events []Event
+	for i := 0; i < len(b.history); i++ {
+		event := b.history[(b.next+i)%len(b.history)]
+		if event.ID > lastID && sub.Wants(event.Type) {
+			events = append(events, event)
 		}
 	}
+	return events
 }
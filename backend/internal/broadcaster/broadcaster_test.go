@@ -0,0 +1,80 @@
+package broadcaster
+
+import "testing"
+
+func TestSubscribeFrom(t *testing.T) {
+	b := New()
+	for i := 0; i < HistorySize+10; i++ {
+		b.Broadcast(LogEvent{RequestedFile: "/test.cfg"})
+	}
+
+	sub, history, missed := b.SubscribeFrom(HistorySize + 5)
+	defer b.Unsubscribe(sub)
+	if len(history) != 5 || history[0].ID != HistorySize+6 || history[4].ID != HistorySize+10 || missed != 0 {
+		t.Fatalf("unexpected history: %d events, %d missed", len(history), missed)
+	}
+
+	// Events older than the buffer are gone
+	old, history, missed := b.SubscribeFrom(1)
+	b.Unsubscribe(old)
+	if len(history) != HistorySize || history[0].ID != 11 || missed != 9 {
+		t.Fatalf("expected %d events starting at 11 and 9 missed, got %d events, %d missed", HistorySize, len(history), missed)
+	}
+
+	// A subscriber that does not read loses events, and they are counted
+	for i := 0; i < cap(sub.C)+3; i++ {
+		b.Broadcast(LogEvent{})
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("expected 3 dropped events, got %d", sub.Dropped())
+	}
+}
+
+func TestTypeFilter(t *testing.T) {
+	b := New()
+	sub := b.Subscribe("phone.*", TypeDeployResult)
+	defer b.Unsubscribe(sub)
+
+	b.Publish(TypePhoneCreated, "office", nil)
+	b.Broadcast(LogEvent{})
+	b.Publish(TypeDeployResult, "office", nil)
+	b.Publish(TypeBackupCreated, "", nil)
+
+	if len(sub.C) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(sub.C))
+	}
+	if e := <-sub.C; e.Type != TypePhoneCreated || e.Domain != "office" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e := <-sub.C; e.Type != TypeDeployResult {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	_, history, _ := b.SubscribeFrom(1, TypeBackupCreated)
+	if len(history) != 1 || history[0].ID != 4 {
+		t.Errorf("unexpected filtered history %+v", history)
+	}
+
+	// Publishing to a nil bus is a no-op
+	var nilBus *Broadcaster
+	nilBus.Publish(TypePhoneDeleted, "", nil)
+}
+
+func TestEventID(t *testing.T) {
+	b := New()
+	b.Publish(TypePhoneCreated, "", nil)
+
+	id := b.EventID(1)
+	if got, ok := b.ParseEventID(id); !ok || got != 1 {
+		t.Errorf("ParseEventID(%q) = %d, %v", id, got, ok)
+	}
+
+	// IDs of another process (before a restart), not issued yet, or malformed are unknown
+	restarted := New()
+	restarted.epoch = "other"
+	for _, s := range []string{restarted.EventID(1), b.EventID(2), "1", "abc", b.epoch + "-x"} {
+		if _, ok := b.ParseEventID(s); ok {
+			t.Errorf("ParseEventID(%q) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package checkin
+
+import (
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/useragent"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tracker stores the last check-in of a device (time, IP, model, firmware, file) on its phone record
+type Tracker struct {
+	DB     *gorm.DB
+	Events *broadcaster.Broadcaster // Optional: device.first_seen events
+
+	// MaxUnprovisioned caps the unprovisioned devices inbox, the least recently seen devices are removed (0 - no limit)
+	MaxUnprovisioned int
+}
+
+// DefaultMaxUnprovisioned is the inbox size of NewTracker
+const DefaultMaxUnprovisioned = 1000
+
+func NewTracker(database *gorm.DB) *Tracker {
+	return &Tracker{DB: database, MaxUnprovisioned: DefaultMaxUnprovisioned}
+}
+
+// Track records a device request.
+// Requests for a known phone update its check-in (successful requests only).
+// Requests for a MAC file that matches no phone go to the unprovisioned devices inbox.
+func (t *Tracker) Track(event broadcaster.LogEvent) {
+	ua := useragent.Parse(event.UserAgent)
+
+	if fileMAC := macaddr.FromFilename(event.RequestedFile); fileMAC != "" {
+		phone, err := db.FindPhoneByMAC(t.DB, fileMAC)
+		if err != nil {
+			t.recordUnprovisioned(fileMAC, event, ua)
+			return
+		}
+		t.checkIn(phone, event, ua)
+		return
+	}
+
+	if phone := t.matchPhone(event, ua); phone != nil {
+		t.checkIn(phone, event, ua)
+	}
+}
+
+func (t *Tracker) checkIn(phone *models.Phone, event broadcaster.LogEvent, ua useragent.Info) {
+	if event.StatusCode >= 400 {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"last_seen_at":     eventTime(event),
+		"last_seen_ip":     event.SourceIP,
+		"last_served_file": event.RequestedFile,
+	}
+	if ua.Model != "" {
+		updates["reported_model"] = ua.Model
+	}
+	if ua.Firmware != "" {
+		updates["firmware_version"] = ua.Firmware
+	}
+
+	// UpdateColumns: check-ins must not bump updated_at
+	if err := t.DB.Model(&models.Phone{}).Where("id = ?", phone.ID).UpdateColumns(updates).Error; err != nil {
+		logger.Warn("Failed to store check-in for phone %d: %v", phone.ID, err)
+		return
+	}
+
+	if phone.LastSeenAt == nil {
+		t.Events.Publish(broadcaster.TypeDeviceFirstSeen, phone.Domain, map[string]interface{}{
+			"provisioned":    true,
+			"phone_id":       phone.ID,
+			"mac_address":    phone.MacAddress,
+			"ip_address":     event.SourceIP,
+			"requested_file": event.RequestedFile,
+		})
+	}
+}
+
+// matchPhone finds the phone for a request without a MAC in the file name:
+// by MAC in the User-Agent, then by source IP
+func (t *Tracker) matchPhone(event broadcaster.LogEvent, ua useragent.Info) *models.Phone {
+	if ua.MAC != "" {
+		if phone, err := db.FindPhoneByMAC(t.DB, ua.MAC); err == nil {
+			return phone
+		}
+	}
+
+	// IP match only if it is unambiguous
+	if event.SourceIP != "" {
+		var phones []models.Phone
+		t.DB.Where("ip_address = ?", event.SourceIP).Limit(2).Find(&phones)
+		if len(phones) == 1 {
+			return &phones[0]
+		}
+	}
+
+	return nil
+}
+
+func (t *Tracker) recordUnprovisioned(mac string, event broadcaster.LogEvent, ua useragent.Info) {
+	seenAt := eventTime(event)
+
+	device := models.UnprovisionedDevice{
+		MacAddress:    mac,
+		Vendor:        ua.Vendor,
+		Model:         ua.Model,
+		Firmware:      ua.Firmware,
+		IPAddress:     event.SourceIP,
+		UserAgent:     event.UserAgent,
+		RequestedFile: event.RequestedFile,
+		RequestCount:  1,
+		FirstSeen:     seenAt,
+		LastSeen:      seenAt,
+	}
+	if device.Vendor == "" {
+		device.Vendor = macaddr.Vendor(mac)
+	}
+
+	// Upsert: concurrent requests of the same device must neither hit the unique index nor lose a count
+	updates := map[string]interface{}{
+		"last_seen":      seenAt,
+		"ip_address":     device.IPAddress,
+		"user_agent":     device.UserAgent,
+		"requested_file": device.RequestedFile,
+		"request_count":  gorm.Expr("request_count + 1"),
+	}
+	if device.Vendor != "" {
+		updates["vendor"] = device.Vendor
+	}
+	if device.Model != "" {
+		updates["model"] = device.Model
+	}
+	if device.Firmware != "" {
+		updates["firmware"] = device.Firmware
+	}
+	err := t.DB.Clauses(
+		clause.OnConflict{Columns: []clause.Column{{Name: "mac_address"}}, DoUpdates: clause.Assignments(updates)},
+		clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "request_count"}}},
+	).Create(&device).Error
+	if err != nil {
+		logger.Warn("Failed to record unprovisioned device %s: %v", mac, err)
+		return
+	}
+
+	if device.RequestCount == 1 {
+		t.pruneUnprovisioned()
+		t.Events.Publish(broadcaster.TypeDeviceFirstSeen, "", map[string]interface{}{
+			"provisioned":    false,
+			"mac_address":    mac,
+			"vendor":         device.Vendor,
+			"model":          device.Model,
+			"ip_address":     event.SourceIP,
+			"requested_file": event.RequestedFile,
+		})
+	}
+}
+
+// pruneUnprovisioned keeps the MaxUnprovisioned most recently seen devices: any client can add MACs to the inbox
+func (t *Tracker) pruneUnprovisioned() {
+	if t.MaxUnprovisioned <= 0 {
+		return
+	}
+	keep := t.DB.Model(&models.UnprovisionedDevice{}).Select("id").Order("last_seen desc, id desc").Limit(t.MaxUnprovisioned)
+	result := t.DB.Where("id NOT IN (?)", keep).Delete(&models.UnprovisionedDevice{})
+	if result.Error != nil {
+		logger.Warn("Failed to prune unprovisioned devices: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		logger.Info("Unprovisioned devices inbox is full (%d), removed %d oldest", t.MaxUnprovisioned, result.RowsAffected)
+	}
+}
+
+func eventTime(event broadcaster.LogEvent) time.Time {
+	if event.Time.IsZero() {
+		return time.Now()
+	}
+	return event.Time
+}
@@ -0,0 +1,111 @@
+package checkin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func newTracker(t *testing.T) *Tracker {
+	t.Helper()
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+	return NewTracker(database)
+}
+
+func TestCheckIn(t *testing.T) {
+	tr := newTracker(t)
+	mac := "00:15:65:aa:bb:cc"
+	phone := models.Phone{Domain: "office", MacAddress: &mac, IPAddress: "10.0.0.5"}
+	tr.DB.Create(&phone)
+
+	seen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tr.Track(broadcaster.LogEvent{
+		Time:          seen,
+		SourceIP:      "10.0.0.5",
+		StatusCode:    200,
+		RequestedFile: "/001565aabbcc.cfg",
+		UserAgent:     "Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc",
+	})
+
+	var got models.Phone
+	tr.DB.First(&got, phone.ID)
+	if got.LastSeenAt == nil || !got.LastSeenAt.Equal(seen) {
+		t.Errorf("last_seen_at = %v, want %v", got.LastSeenAt, seen)
+	}
+	if got.LastSeenIP != "10.0.0.5" || got.ReportedModel != "T46U" || got.FirmwareVersion != "108.86.0.45" || got.LastServedFile != "/001565aabbcc.cfg" {
+		t.Errorf("unexpected check-in %+v", got)
+	}
+
+	// Failed requests are not check-ins
+	tr.Track(broadcaster.LogEvent{Time: seen.Add(time.Hour), SourceIP: "10.0.0.9", StatusCode: 404, RequestedFile: "/001565aabbcc.cfg"})
+	tr.DB.First(&got, phone.ID)
+	if got.LastSeenIP != "10.0.0.5" {
+		t.Errorf("failed request updated the check-in: %+v", got)
+	}
+
+	// Requests without a MAC are matched by the phone IP
+	tr.Track(broadcaster.LogEvent{Time: seen.Add(2 * time.Hour), SourceIP: "10.0.0.5", StatusCode: 200, RequestedFile: "/y000000000108.cfg"})
+	tr.DB.First(&got, phone.ID)
+	if got.LastServedFile != "/y000000000108.cfg" {
+		t.Errorf("request by IP not matched: %+v", got)
+	}
+
+	var count int64
+	tr.DB.Model(&models.UnprovisionedDevice{}).Count(&count)
+	if count != 0 {
+		t.Errorf("known phone recorded as unprovisioned")
+	}
+}
+
+func TestUnprovisionedInbox(t *testing.T) {
+	tr := newTracker(t)
+	tr.MaxUnprovisioned = 2
+
+	seen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := broadcaster.LogEvent{
+		Time:          seen,
+		SourceIP:      "10.0.0.7",
+		StatusCode:    404,
+		RequestedFile: "/001565aabbcc.cfg",
+		UserAgent:     "Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc",
+	}
+
+	// Concurrent requests of one device share a single row
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		go func() {
+			tr.Track(event)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+
+	var devices []models.UnprovisionedDevice
+	tr.DB.Find(&devices)
+	if len(devices) != 1 {
+		t.Fatalf("expected one device, got %+v", devices)
+	}
+	d := devices[0]
+	if d.MacAddress != "001565aabbcc" || d.RequestCount != 5 || d.Vendor != "yealink" || d.Model != "T46U" || d.IPAddress != "10.0.0.7" {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	// The inbox keeps the most recently seen devices
+	for i, file := range []string{"/001565000001.cfg", "/001565000002.cfg"} {
+		tr.Track(broadcaster.LogEvent{Time: seen.Add(time.Duration(i+1) * time.Minute), StatusCode: 404, RequestedFile: file})
+	}
+	devices = nil
+	tr.DB.Order("mac_address").Find(&devices)
+	if len(devices) != 2 || devices[0].MacAddress != "001565000001" || devices[1].MacAddress != "001565000002" {
+		t.Errorf("inbox not pruned: %+v", devices)
+	}
+}
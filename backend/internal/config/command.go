@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Command — команда деплоя/удаления домена.
+// В YAML задается строкой (выполняется через "sh -c", как раньше) или объектом:
+//
+//	deploy_commands:
+//	  - "rsync -a $PROVISIONING_SOURCE/ pbx:/tftpboot/"
+//	  - argv: ["/opt/pbx/provision", "-n", "{{.Phone.PhoneNumber}}", "-f", "{{.Phone.Description}}"]
+//	    timeout: 30s
+//	    dir: /opt/pbx
+//	    env:
+//	      PBX_HOST: "{{.Vars.sip_server}}"
+//
+// Argv-команды запускаются без shell: каждый аргумент — отдельный шаблон,
+// поэтому данные телефона не могут "сломать" команду.
+type Command struct {
+	Shell   string            `yaml:"shell,omitempty" json:"shell,omitempty"`     // Template, run with "sh -c"
+	Argv    []string          `yaml:"argv,omitempty" json:"argv,omitempty"`       // Templates, run directly
+	Timeout string            `yaml:"timeout,omitempty" json:"timeout,omitempty"` // Go duration ("30s"), default 60s
+	Dir     string            `yaml:"dir,omitempty" json:"dir,omitempty"`         // Working directory
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`         // Extra environment, values are templates
+}
+
+// ShellCommand makes a Command from a plain shell string (legacy format)
+func ShellCommand(s string) Command {
+	return Command{Shell: s}
+}
+
+// isPlainShell reports whether the command is a plain shell string without options
+func (c Command) isPlainShell() bool {
+	return c.Shell != "" && len(c.Argv) == 0 && c.Timeout == "" && c.Dir == "" && len(c.Env) == 0
+}
+
+// String returns a human readable form of the command (for logs and errors)
+func (c Command) String() string {
+	if len(c.Argv) > 0 {
+		return strings.Join(c.Argv, " ")
+	}
+	return c.Shell
+}
+
+// Validate checks that exactly one of shell/argv is set
+func (c Command) Validate() error {
+	if c.Shell == "" && len(c.Argv) == 0 {
+		return fmt.Errorf("command must have either shell or argv")
+	}
+	if c.Shell != "" && len(c.Argv) > 0 {
+		return fmt.Errorf("command can not have both shell and argv")
+	}
+	return nil
+}
+
+// commandFields avoids recursion in (Un)Marshal*
+type commandFields Command
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Shell = node.Value
+		return nil
+	}
+	var f commandFields
+	if err := node.Decode(&f); err != nil {
+		return err
+	}
+	*c = Command(f)
+	return nil
+}
+
+func (c Command) MarshalYAML() (interface{}, error) {
+	if c.isPlainShell() {
+		return c.Shell, nil
+	}
+	return commandFields(c), nil
+}
+
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = Command{Shell: s}
+		return nil
+	}
+	var f commandFields
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*c = Command(f)
+	return nil
+}
+
+func (c Command) MarshalJSON() ([]byte, error) {
+	if c.isPlainShell() {
+		return json.Marshal(c.Shell)
+	}
+	return json.Marshal(commandFields(c))
+}
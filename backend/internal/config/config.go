@@ -4,18 +4,63 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	"provisioning-system/internal/numberpool"
 
 	"gopkg.in/yaml.v3"
 )
 
 type DomainSettings struct {
 	Name                   string            `yaml:"name" json:"name"`
-	DeployCmd              string            `yaml:"deploy_cmd" json:"deploy_cmd"`                           // Legacy: single command
-	DeleteCmd              string            `yaml:"delete_cmd" json:"delete_cmd"`                           // Legacy: single command
-	DeployCommands         []string          `yaml:"deploy_commands" json:"deploy_commands"`                // New: list of commands
-	DeleteCommands         []string          `yaml:"delete_commands" json:"delete_commands"`                // New: list of commands
+	DeployCmd              string            `yaml:"deploy_cmd" json:"deploy_cmd"`                             // Legacy: single command
+	DeleteCmd              string            `yaml:"delete_cmd" json:"delete_cmd"`                             // Legacy: single command
+	DeployCommands         []Command         `yaml:"deploy_commands" json:"deploy_commands"`                   // New: list of commands (string or argv object)
+	DeleteCommands         []Command         `yaml:"delete_commands" json:"delete_commands"`                   // New: list of commands (string or argv object)
 	GenerateRandomPassword bool              `yaml:"generate_random_password" json:"generate_random_password"` // If true, generate random password for new phones
+	PasswordPolicy         PasswordPolicy    `yaml:"password_policy" json:"password_policy"`
 	Variables              map[string]string `yaml:"variables" json:"variables"`
+	AccessPolicy           AccessPolicy      `yaml:"access_policy" json:"access_policy"`
+	NumberPool             NumberPool        `yaml:"number_pool" json:"number_pool"`
+	DeployTargets          []DeployTarget    `yaml:"deploy_targets" json:"deploy_targets"`
+	DeployDebounce         string            `yaml:"deploy_debounce" json:"deploy_debounce"` // Go duration: coalesce phone change deploys within this window. Empty - deploy right away
+	FirmwareURL            string            `yaml:"firmware_url" json:"firmware_url"`       // Base URL phones download firmware from (e.g. http://10.0.0.1:8080/firmware)
+}
+
+// DeployTarget — встроенная доставка temp_configs/<domain> (вместо scp/rsync-скриптов).
+// Синхронизация инкрементальная: выгружаются только измененные файлы, удаленные телефоны удаляются на цели.
+type DeployTarget struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type" json:"type"` // local, ftp, sftp, webdav
+	Path        string `yaml:"path" json:"path"` // local: target dir; ftp/sftp: remote base dir
+	Host        string `yaml:"host" json:"host"` // ftp/sftp: host[:port]
+	URL         string `yaml:"url" json:"url"`   // webdav: base URL
+	Username    string `yaml:"username" json:"username"`
+	Password    string `yaml:"password" json:"password"`
+	PrivateKey  string `yaml:"private_key" json:"private_key"`   // sftp: path to private key file
+	HostKey     string `yaml:"host_key" json:"host_key"`         // sftp: expected host key (authorized_keys format)
+	KnownHosts  string `yaml:"known_hosts" json:"known_hosts"`   // sftp: path to a known_hosts file, if host_key is not set
+	Timeout     string `yaml:"timeout" json:"timeout"`           // Go duration, default 60s
+	KeepRemoved bool   `yaml:"keep_removed" json:"keep_removed"` // Do not delete files removed locally
+}
+
+// PasswordPolicy — требования к SIP-паролям домена: генерация паролей и проверка введенных вручную
+type PasswordPolicy struct {
+	Length           int      `yaml:"length" json:"length"`                       // Generated length and minimum length of entered passwords, default 12
+	Classes          []string `yaml:"classes" json:"classes"`                     // lower, upper, digits, symbols. Default: lower, upper, digits
+	ExcludeAmbiguous bool     `yaml:"exclude_ambiguous" json:"exclude_ambiguous"` // No look-alike characters (0 O 1 l I |)
+	Enforce          bool     `yaml:"enforce" json:"enforce"`                     // Reject entered passwords that do not match the policy
+}
+
+// NumberPool — диапазоны внутренних номеров домена для автоматического назначения (см. numberpool.Config)
+type NumberPool = numberpool.Config
+
+// AccessPolicy ограничивает выдачу <mac>.cfg только устройству-владельцу
+type AccessPolicy struct {
+	Mode                string `yaml:"mode" json:"mode"`                                     // off (default), alert, reject
+	CheckUserAgent      bool   `yaml:"check_user_agent" json:"check_user_agent"`             // MAC in User-Agent must match the requested file
+	RequireUserAgentMAC bool   `yaml:"require_user_agent_mac" json:"require_user_agent_mac"` // Treat a User-Agent without MAC as a mismatch
+	CheckIP             bool   `yaml:"check_ip" json:"check_ip"`                             // Source IP must match Phone.IPAddress (if set)
 }
 
 type SystemConfig struct {
@@ -25,19 +70,25 @@ type SystemConfig struct {
 		ServeConfigs    bool   `yaml:"serve_configs" json:"serve_configs"`
 		LogDeviceAccess string `yaml:"log_device_access" json:"log_device_access"` // none, access, error, full
 		LogFilePath     string `yaml:"log_file_path" json:"log_file_path"`
-		TFTPServer      bool   `yaml:"tftp_server" json:"tftp_server"`
-		TFTPPort        string `yaml:"tftp_port" json:"tftp_port"`
+		// Device access log in DB: days to keep (0 = default 30, -1 = forever) and max rows (0 = default 100000, -1 = unlimited)
+		DeviceLogRetentionDays int    `yaml:"device_log_retention_days" json:"device_log_retention_days"`
+		DeviceLogMaxRows       int    `yaml:"device_log_max_rows" json:"device_log_max_rows"`
+		TFTPServer             bool   `yaml:"tftp_server" json:"tftp_server"`
+		TFTPPort               string `yaml:"tftp_port" json:"tftp_port"`
 	} `yaml:"server" json:"server"`
 	Auth struct {
 		AdminUser     string `yaml:"admin_user" json:"admin_user"`
 		AdminPassword string `yaml:"admin_password" json:"admin_password"`
 		SecretKey     string `yaml:"secret_key" json:"secret_key"`
+		// Allow GET /api/phones?reveal_secrets=true to return SIP passwords in clear (masked otherwise)
+		AllowRevealSecrets bool `yaml:"allow_reveal_secrets" json:"allow_reveal_secrets"`
 	} `yaml:"auth" json:"auth"`
 	Database struct {
 		Path      string `yaml:"path" json:"path"`
 		BackupDir string `yaml:"backup_dir" json:"backup_dir"`
 	} `yaml:"database" json:"database"`
-	Domains []DomainSettings `yaml:"domains" json:"domains"`
+	Domains   []DomainSettings  `yaml:"domains" json:"domains"`
+	Variables map[string]string `yaml:"variables" json:"variables"` // Global template variables, overridden by domain variables
 }
 
 func LoadConfig(configDir string) (*SystemConfig, error) {
@@ -77,9 +128,34 @@ func LoadConfig(configDir string) (*SystemConfig, error) {
 		cfg.Server.TFTPPort = "69"
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+// validate rejects settings that would otherwise be silently ignored
+func (cfg *SystemConfig) validate() error {
+	for _, d := range cfg.Domains {
+		if d.DeployDebounce != "" {
+			window, err := time.ParseDuration(d.DeployDebounce)
+			if err != nil || window < 0 {
+				return fmt.Errorf("domain %s: invalid deploy_debounce %q, expected a duration such as 10s", d.Name, d.DeployDebounce)
+			}
+		}
+		switch d.AccessPolicy.Mode {
+		case "", "off", "alert", "reject":
+		default:
+			return fmt.Errorf("domain %s: invalid access_policy mode %q, expected off, alert or reject", d.Name, d.AccessPolicy.Mode)
+		}
+		if _, err := numberpool.New(d.NumberPool); err != nil {
+			return fmt.Errorf("domain %s: invalid number_pool: %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
 // GetEffectiveDomainConfig возвращает настройки для указанного домена.
 // Если домен не найден, возвращает настройки первого домена (дефолтного).
 func (cfg *SystemConfig) GetEffectiveDomainConfig(domainName string) DomainSettings {
@@ -107,20 +183,30 @@ func (cfg *SystemConfig) GetEffectiveDomainConfig(domainName string) DomainSetti
 		Name:                   targetDomain.Name,
 		DeployCmd:              targetDomain.DeployCmd,
 		DeleteCmd:              targetDomain.DeleteCmd,
-		DeployCommands:         make([]string, len(targetDomain.DeployCommands)),
-		DeleteCommands:         make([]string, len(targetDomain.DeleteCommands)),
+		DeployCommands:         make([]Command, len(targetDomain.DeployCommands)),
+		DeleteCommands:         make([]Command, len(targetDomain.DeleteCommands)),
 		GenerateRandomPassword: targetDomain.GenerateRandomPassword,
+		PasswordPolicy:         targetDomain.PasswordPolicy,
 		Variables:              make(map[string]string),
+		AccessPolicy:           targetDomain.AccessPolicy,
+		NumberPool:             targetDomain.NumberPool,
+		DeployTargets:          append([]DeployTarget(nil), targetDomain.DeployTargets...),
+		DeployDebounce:         targetDomain.DeployDebounce,
+		FirmwareURL:            targetDomain.FirmwareURL,
 	}
 	copy(effective.DeployCommands, targetDomain.DeployCommands)
 	copy(effective.DeleteCommands, targetDomain.DeleteCommands)
+	effective.PasswordPolicy.Classes = append([]string(nil), targetDomain.PasswordPolicy.Classes...)
+	effective.NumberPool.Ranges = append([]string(nil), targetDomain.NumberPool.Ranges...)
+	effective.NumberPool.Reserved = append([]string(nil), targetDomain.NumberPool.Reserved...)
+	effective.NumberPool.Excluded = append([]string(nil), targetDomain.NumberPool.Excluded...)
 
 	// Backward compatibility: if new list is empty but old string is set, use it
 	if len(effective.DeployCommands) == 0 && effective.DeployCmd != "" {
-		effective.DeployCommands = []string{effective.DeployCmd}
+		effective.DeployCommands = []Command{ShellCommand(effective.DeployCmd)}
 	}
 	if len(effective.DeleteCommands) == 0 && effective.DeleteCmd != "" {
-		effective.DeleteCommands = []string{effective.DeleteCmd}
+		effective.DeleteCommands = []Command{ShellCommand(effective.DeleteCmd)}
 	}
 
 	for k, v := range targetDomain.Variables {
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigDeployDebounce(t *testing.T) {
+	load := func(debounce string) error {
+		dir := t.TempDir()
+		data := "domains:\n  - name: office\n    deploy_debounce: \"" + debounce + "\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "provisioning-system.yaml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(dir)
+		return err
+	}
+
+	for _, ok := range []string{"", "10s", "1m30s"} {
+		if err := load(ok); err != nil {
+			t.Errorf("deploy_debounce %q rejected: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"10", "ten seconds", "-5s"} {
+		if err := load(bad); err == nil || !strings.Contains(err.Error(), "deploy_debounce") {
+			t.Errorf("deploy_debounce %q: expected an error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigAccessPolicyMode(t *testing.T) {
+	load := func(mode string) error {
+		dir := t.TempDir()
+		data := "domains:\n  - name: office\n    access_policy:\n      mode: \"" + mode + "\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "provisioning-system.yaml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(dir)
+		return err
+	}
+
+	for _, ok := range []string{"", "off", "alert", "reject"} {
+		if err := load(ok); err != nil {
+			t.Errorf("mode %q rejected: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"rejct", "Reject", "on"} {
+		if err := load(bad); err == nil || !strings.Contains(err.Error(), "access_policy") {
+			t.Errorf("mode %q: expected an error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfigNumberPool(t *testing.T) {
+	load := func(pool string) error {
+		dir := t.TempDir()
+		data := "domains:\n  - name: office\n    number_pool:\n" + pool
+		if err := os.WriteFile(filepath.Join(dir, "provisioning-system.yaml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(dir)
+		return err
+	}
+
+	if err := load("      start: 200\n      end: 299\n      ranges: [\"5000\"]\n"); err != nil {
+		t.Errorf("valid pool rejected: %v", err)
+	}
+	for _, bad := range []string{
+		"      start: 299\n      end: 200\n",
+		"      ranges: [\"2x0-299\"]\n",
+		"      reserved: [\"300-200\"]\n",
+		"      ranges: [\"1-1000000\"]\n",
+	} {
+		if err := load(bad); err == nil || !strings.Contains(err.Error(), "number_pool") {
+			t.Errorf("pool %q: expected an error, got %v", bad, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 
+	"provisioning-system/internal/macaddr"
 	"provisioning-system/internal/models"
 
 	"github.com/glebarez/sqlite"
@@ -10,15 +11,108 @@ import (
 )
 
 func Init(dbPath string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// Unique index violations are gorm.ErrDuplicatedKey (concurrent saves of the same number, MAC, SIP user)
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if err := migrateIndexes(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
 	// Auto Migrate
-	if err := db.AutoMigrate(&models.Phone{}, &models.PhoneLine{}); err != nil {
+	if err := db.AutoMigrate(&models.Phone{}, &models.PhoneLine{}, &models.UnprovisionedDevice{}, &models.DeviceAccessLog{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.DeployRun{}, &models.PhoneActionLog{}, &models.Firmware{}, &models.FirmwarePolicy{}, &models.Profile{}, &models.ProfileLine{}, &models.SIPAccount{}, &models.Phonebook{}, &models.Contact{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return db, nil
 }
+
+// migrateIndexes drops indexes replaced by other ones (AutoMigrate only creates indexes)
+func migrateIndexes(db *gorm.DB) error {
+	// Phone numbers were unique system-wide, now they are unique within a domain (idx_phones_domain_number)
+	if db.Migrator().HasTable(&models.Phone{}) && db.Migrator().HasIndex(&models.Phone{}, "idx_phones_phone_number") {
+		if err := db.Migrator().DropIndex(&models.Phone{}, "idx_phones_phone_number"); err != nil {
+			return err
+		}
+	}
+	// SIP user names are unique among own accounts, accounts inherited from a profile are shared (idx_sip_accounts_domain_own_user)
+	if db.Migrator().HasTable(&models.SIPAccount{}) && db.Migrator().HasIndex(&models.SIPAccount{}, "idx_sip_accounts_domain_user") {
+		if err := db.Migrator().DropIndex(&models.SIPAccount{}, "idx_sip_accounts_domain_user"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindPhoneByMAC ищет телефон по нормализованному MAC (12 hex в нижнем регистре),
+// независимо от того, в каком формате адрес был введен
+func FindPhoneByMAC(database *gorm.DB, mac string) (*models.Phone, error) {
+	var phone models.Phone
+	err := database.
+		Where("LOWER(REPLACE(REPLACE(REPLACE(mac_address, ':', ''), '-', ''), '.', '')) = ?", mac).
+		First(&phone).Error
+	if err != nil {
+		return nil, err
+	}
+	return &phone, nil
+}
+
+// MACChange — MAC телефона, приведенный к каноническому виду
+type MACChange struct {
+	PhoneID uint
+	Old     string
+	New     string
+}
+
+// CanonicalizeMACs stores the MAC addresses of phones in the canonical form (00:15:65:aa:bb:cc), so that
+// the same device written differently is found by exact match. Invalid addresses and addresses of
+// another phone are left as they are and returned as problems.
+func CanonicalizeMACs(database *gorm.DB) ([]MACChange, []string, error) {
+	var phones []models.Phone
+	if err := database.Select("id", "mac_address").Where("mac_address IS NOT NULL AND mac_address <> ''").Order("id").Find(&phones).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// Phones already stored in the canonical form keep their MAC
+	owners := make(map[string]uint) // canonical MAC -> phone keeping it
+	for _, p := range phones {
+		if m, err := macaddr.Parse(*p.MacAddress); err == nil && m.String() == *p.MacAddress {
+			owners[*p.MacAddress] = p.ID
+		}
+	}
+
+	var pending []MACChange
+	var problems []string
+	for _, p := range phones {
+		m, err := macaddr.Parse(*p.MacAddress)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("phone %d: %v", p.ID, err))
+			continue
+		}
+		canonical := m.String()
+		if canonical == *p.MacAddress {
+			continue
+		}
+		if owner, dup := owners[canonical]; dup {
+			problems = append(problems, fmt.Sprintf("phone %d: MAC %s is the same device as phone %d", p.ID, *p.MacAddress, owner))
+			continue
+		}
+		owners[canonical] = p.ID
+		pending = append(pending, MACChange{PhoneID: p.ID, Old: *p.MacAddress, New: canonical})
+	}
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		for _, c := range pending {
+			if err := tx.Model(&models.Phone{}).Where("id = ?", c.PhoneID).UpdateColumn("mac_address", c.New).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, problems, err
+	}
+	return pending, problems, nil
+}
@@ -0,0 +1,74 @@
+package deploy
+
+import (
+	"provisioning-system/internal/models"
+)
+
+// templateData builds the data available in command templates:
+// .Phone (fields in PascalCase, pointers flattened), .Domain and .Vars
+func templateData(req Request) interface{} {
+	phoneMap := map[string]interface{}{}
+	if req.Phone != nil {
+		phoneMap = PhoneData(req.Phone)
+	}
+
+	return struct {
+		Phone  map[string]interface{}
+		Domain string
+		Vars   map[string]string
+	}{
+		Phone:  phoneMap,
+		Domain: req.Domain,
+		Vars:   req.Vars,
+	}
+}
+
+// PhoneData flattens the phone object to handle pointers and ensure all fields are available.
+// We use manual mapping to ensure keys match field names (PascalCase) used in templates.
+func PhoneData(phone *models.Phone) map[string]interface{} {
+	phoneMap := map[string]interface{}{
+		"ID":                    phone.ID,
+		"Domain":                phone.Domain,
+		"Vendor":                phone.Vendor,
+		"ModelID":               phone.ModelID,
+		"ExpansionModulesCount": phone.ExpansionModulesCount,
+		"ExpansionModuleModel":  phone.ExpansionModuleModel,
+		"Type":                  phone.Type,
+		"IPAddress":             phone.IPAddress,
+		"Description":           phone.Description,
+		"ModelName":             phone.ModelName,
+		"VendorName":            phone.VendorName,
+		"MacAddress":            "",
+		"PhoneNumber":           "",
+	}
+	if phone.MacAddress != nil {
+		phoneMap["MacAddress"] = *phone.MacAddress
+	}
+	if phone.PhoneNumber != nil {
+		phoneMap["PhoneNumber"] = *phone.PhoneNumber
+	}
+
+	var lines []map[string]interface{}
+	for _, l := range phone.Lines {
+		lineMap := map[string]interface{}{
+			"ID":                   l.ID,
+			"PhoneID":              l.PhoneID,
+			"Type":                 l.Type,
+			"AccountNumber":        l.AccountNumber,
+			"AdditionalInfo":       l.AdditionalInfo,
+			"KeyNumber":            nil,
+			"PanelNumber":          nil,
+			"GetAdditionalInfoMap": l.GetAdditionalInfoMap(),
+		}
+		if l.KeyNumber != nil {
+			lineMap["KeyNumber"] = *l.KeyNumber
+		}
+		if l.PanelNumber != nil {
+			lineMap["PanelNumber"] = *l.PanelNumber
+		}
+		lines = append(lines, lineMap)
+	}
+	phoneMap["Lines"] = lines
+
+	return phoneMap
+}
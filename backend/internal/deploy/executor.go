@@ -0,0 +1,341 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/secrets"
+)
+
+// DefaultTimeout applies to commands without an explicit timeout
+const DefaultTimeout = 60 * time.Second
+
+// maxOutput limits captured stdout/stderr per command
+const maxOutput = 64 * 1024
+
+// Request describes one execution of a domain's deploy or delete hooks
+type Request struct {
+	Domain   string
+	Targets  []config.DeployTarget // Synced before the commands run
+	Commands []config.Command
+	Phone    *models.Phone // Optional: nil for domain-wide deploys
+	Vars     map[string]string
+	DryRun   bool     // Render commands and plan target syncs without running them
+	Force    bool     // Upload all files to targets, not only changed ones
+	Secrets  []string // Plain secret values of the phone, masked in the result and the error
+}
+
+// CommandResult is the outcome of a single command
+type CommandResult struct {
+	Command  string        `json:"command"`        // Rendered shell string or argv joined for display
+	Argv     []string      `json:"argv,omitempty"` // Rendered argv (argv commands only)
+	Dir      string        `json:"dir,omitempty"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	TimedOut bool          `json:"timed_out,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Result of a run. Commands stop at the first failure and do not run if a target failed.
+type Result struct {
+	Domain     string          `json:"domain"`
+	DryRun     bool            `json:"dry_run"`
+	Success    bool            `json:"success"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Targets    []TargetResult  `json:"targets,omitempty"`
+	Commands   []CommandResult `json:"commands"`
+}
+
+// Executor renders and runs deploy commands of a domain
+type Executor struct {
+	ConfigDir string
+}
+
+func NewExecutor(configDir string) *Executor {
+	return &Executor{ConfigDir: configDir}
+}
+
+// Run syncs the targets, then executes the commands in order, and returns the result of every step.
+// The returned error describes the first failure. Secrets of the request are masked in both.
+func (e *Executor) Run(ctx context.Context, req Request) (*Result, error) {
+	result, err := e.run(ctx, req)
+	if len(req.Secrets) == 0 {
+		return result, err
+	}
+	mask := secretMasker(req.Secrets)
+	maskResult(result, mask)
+	if err != nil {
+		err = errors.New(mask.Replace(err.Error()))
+	}
+	return result, err
+}
+
+func (e *Executor) run(ctx context.Context, req Request) (*Result, error) {
+	result := &Result{
+		Domain:    req.Domain,
+		DryRun:    req.DryRun,
+		StartedAt: time.Now(),
+	}
+	defer func() { result.FinishedAt = time.Now() }()
+
+	var targetErr error
+	for _, target := range req.Targets {
+		tr := e.SyncTarget(ctx, req, target)
+		result.Targets = append(result.Targets, tr)
+		if !tr.Success && targetErr == nil {
+			targetErr = fmt.Errorf("deploy target %s (%s) failed: %s", tr.Name, tr.Type, tr.Error)
+		}
+	}
+	if targetErr != nil {
+		return result, targetErr
+	}
+
+	data := templateData(req)
+	env := e.environment(req)
+
+	for _, command := range req.Commands {
+		cr, err := e.runCommand(ctx, command, data, env, req.DryRun)
+		result.Commands = append(result.Commands, cr)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// secretMasker replaces the secret values with secrets.Mask, longer values first
+func secretMasker(values []string) *strings.Replacer {
+	sorted := append([]string(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	var pairs []string
+	for _, v := range sorted {
+		if v != "" {
+			pairs = append(pairs, v, secrets.Mask)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// maskResult masks the secrets in the rendered commands, their output and errors
+func maskResult(result *Result, mask *strings.Replacer) {
+	for i := range result.Targets {
+		result.Targets[i].Error = mask.Replace(result.Targets[i].Error)
+	}
+	for i := range result.Commands {
+		c := &result.Commands[i]
+		c.Command = mask.Replace(c.Command)
+		for j := range c.Argv {
+			c.Argv[j] = mask.Replace(c.Argv[j])
+		}
+		c.Stdout = mask.Replace(c.Stdout)
+		c.Stderr = mask.Replace(c.Stderr)
+		c.Error = mask.Replace(c.Error)
+	}
+}
+
+func (e *Executor) runCommand(ctx context.Context, command config.Command, data interface{}, env []string, dryRun bool) (CommandResult, error) {
+	var cr CommandResult
+
+	fail := func(err error) (CommandResult, error) {
+		cr.ExitCode = -1
+		cr.Error = err.Error()
+		return cr, err
+	}
+
+	if err := command.Validate(); err != nil {
+		return fail(err)
+	}
+
+	timeout := DefaultTimeout
+	if command.Timeout != "" {
+		d, err := time.ParseDuration(command.Timeout)
+		if err != nil {
+			return fail(fmt.Errorf("invalid timeout %q: %w", command.Timeout, err))
+		}
+		timeout = d
+	}
+
+	// Render templates
+	var argv []string
+	if len(command.Argv) > 0 {
+		for _, arg := range command.Argv {
+			rendered, err := render(arg, data)
+			if err != nil {
+				return fail(err)
+			}
+			argv = append(argv, rendered)
+		}
+		cr.Argv = argv
+		cr.Command = strings.Join(argv, " ")
+	} else {
+		rendered, err := render(command.Shell, data)
+		if err != nil {
+			return fail(err)
+		}
+		// We use "sh -c" to allow complex commands (pipes, redirects, etc.)
+		argv = []string{"sh", "-c", rendered}
+		cr.Command = rendered
+	}
+
+	cmdEnv := append([]string{}, env...)
+	for k, v := range command.Env {
+		rendered, err := render(v, data)
+		if err != nil {
+			return fail(err)
+		}
+		cmdEnv = append(cmdEnv, fmt.Sprintf("%s=%s", k, rendered))
+	}
+
+	cr.Dir = command.Dir
+	if dryRun {
+		return cr, nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, argv[0], argv[1:]...)
+	cmd.Dir = command.Dir
+	cmd.Env = cmdEnv
+	// Do not wait forever for orphaned children holding stdout open
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr limitedBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	cr.Duration = time.Since(start)
+	cr.Stdout = stdout.String()
+	cr.Stderr = stderr.String()
+
+	if err == nil {
+		return cr, nil
+	}
+
+	cr.ExitCode = -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cr.ExitCode = exitErr.ExitCode()
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		cr.TimedOut = true
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	cr.Error = err.Error()
+
+	output := strings.TrimSpace(cr.Stdout + cr.Stderr)
+	return cr, fmt.Errorf("command execution failed: '%s', error: %v, output: %s", cr.Command, err, output)
+}
+
+// environment returns the process environment for commands:
+// PROVISIONING_DOMAIN, PROVISIONING_SOURCE, phone fields and domain variables as PROVISIONING_VAR_<NAME>
+func (e *Executor) environment(req Request) []string {
+	sourceDir, _ := filepath.Abs(filepath.Join(e.ConfigDir, "temp_configs", req.Domain))
+
+	env := append(os.Environ(),
+		fmt.Sprintf("PROVISIONING_DOMAIN=%s", req.Domain),
+		fmt.Sprintf("PROVISIONING_SOURCE=%s", sourceDir),
+	)
+
+	if phone := req.Phone; phone != nil {
+		env = append(env,
+			fmt.Sprintf("PROVISIONING_PHONE_ID=%d", phone.ID),
+			fmt.Sprintf("PROVISIONING_PHONE_VENDOR=%s", phone.Vendor),
+			fmt.Sprintf("PROVISIONING_PHONE_MODEL=%s", phone.ModelID),
+			fmt.Sprintf("PROVISIONING_PHONE_DESCRIPTION=%s", phone.Description),
+		)
+		if phone.MacAddress != nil {
+			env = append(env, fmt.Sprintf("PROVISIONING_PHONE_MAC=%s", *phone.MacAddress))
+		}
+		if phone.PhoneNumber != nil {
+			env = append(env, fmt.Sprintf("PROVISIONING_PHONE_NUMBER=%s", *phone.PhoneNumber))
+		}
+	}
+
+	for k, v := range req.Vars {
+		env = append(env, fmt.Sprintf("PROVISIONING_VAR_%s=%s", EnvName(k), v))
+	}
+	return env
+}
+
+var envNameRe = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// EnvName converts a variable name to an environment variable name ("sip-server" -> "SIP_SERVER")
+func EnvName(name string) string {
+	return envNameRe.ReplaceAllString(strings.ToUpper(name), "_")
+}
+
+// Funcs are the template functions available in commands
+var Funcs = template.FuncMap{
+	"shellquote": ShellQuote,
+}
+
+func render(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("cmd").Funcs(Funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse command template '%s': %w", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute command template '%s': %w", text, err)
+	}
+	return buf.String(), nil
+}
+
+// ShellQuote quotes a value for safe use as a single word in "sh -c" commands:
+//
+//	{{ shellquote .Phone.Description }}
+func ShellQuote(v interface{}) string {
+	s := fmt.Sprint(v)
+	if v == nil {
+		s = ""
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// limitedBuffer keeps the first maxOutput bytes and discards the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n...(truncated)"
+	}
+	return b.buf.String()
+}
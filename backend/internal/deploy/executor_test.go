@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRun(t *testing.T) {
+	e := NewExecutor(t.TempDir())
+
+	number := "101"
+	phone := &models.Phone{Description: "O'Brien; rm -rf /", PhoneNumber: &number}
+	dir := t.TempDir()
+
+	result, err := e.Run(context.Background(), Request{
+		Domain: "office",
+		Phone:  phone,
+		Vars:   map[string]string{"sip-server": "10.0.0.1"},
+		Commands: []config.Command{
+			config.ShellCommand("echo {{ shellquote .Phone.Description }}"),
+			{Argv: []string{"printf", "%s|%s", "{{.Phone.Description}}", "{{.Phone.PhoneNumber}}"}},
+			{Shell: "pwd; echo $PROVISIONING_VAR_SIP_SERVER $PBX", Dir: dir, Env: map[string]string{"PBX": `{{index .Vars "sip-server"}}`}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Commands) != 3 || !result.Success {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if got := result.Commands[0].Stdout; got != "O'Brien; rm -rf /\n" {
+		t.Errorf("shellquote: unexpected output %q", got)
+	}
+	if got := result.Commands[1].Stdout; got != "O'Brien; rm -rf /|101" {
+		t.Errorf("argv: unexpected output %q", got)
+	}
+	if got := result.Commands[2].Stdout; got != dir+"\n10.0.0.1 10.0.0.1\n" {
+		t.Errorf("dir/env: unexpected output %q", got)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	e := NewExecutor(t.TempDir())
+
+	result, err := e.Run(context.Background(), Request{
+		Commands: []config.Command{
+			config.ShellCommand("echo out; echo err >&2; exit 3"),
+			config.ShellCommand("echo never"),
+		},
+	})
+	if err == nil || len(result.Commands) != 1 {
+		t.Fatalf("expected failure on first command, got %v, %+v", err, result)
+	}
+	if c := result.Commands[0]; c.ExitCode != 3 || c.Stdout != "out\n" || c.Stderr != "err\n" {
+		t.Errorf("unexpected command result %+v", c)
+	}
+
+	result, err = e.Run(context.Background(), Request{
+		Commands: []config.Command{{Argv: []string{"sleep", "5"}, Timeout: "100ms"}},
+	})
+	if err == nil || !result.Commands[0].TimedOut {
+		t.Errorf("expected timeout, got %v, %+v", err, result.Commands)
+	}
+
+	// Dry run renders but does not execute
+	result, err = e.Run(context.Background(), Request{
+		Domain:   "office",
+		Commands: []config.Command{config.ShellCommand("exit 1 # {{.Domain}}")},
+		DryRun:   true,
+	})
+	if err != nil || !result.Success || result.Commands[0].Command != "exit 1 # office" {
+		t.Errorf("unexpected dry run result %v, %+v", err, result)
+	}
+}
+
+func TestCommandYAML(t *testing.T) {
+	src := `
+- "echo {{.Domain}}"
+- argv: ["/bin/true", "{{.Phone.ID}}"]
+  timeout: 5s
+`
+	var commands []config.Command
+	if err := yaml.Unmarshal([]byte(src), &commands); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(commands) != 2 || commands[0].Shell != "echo {{.Domain}}" || len(commands[1].Argv) != 2 || commands[1].Timeout != "5s" {
+		t.Fatalf("unexpected commands %+v", commands)
+	}
+
+	out, err := yaml.Marshal(commands)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "- echo {{.Domain}}\n") {
+		t.Errorf("plain shell command should stay a string:\n%s", out)
+	}
+}
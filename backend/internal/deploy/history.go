@@ -0,0 +1,115 @@
+package deploy
+
+import (
+	"encoding/json"
+	"strings"
+
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// historyPerDomain is how many runs are kept per domain, older ones are pruned on record
+const historyPerDomain = 500
+
+// Origin tells why hooks were run, stored with the run
+type Origin struct {
+	Action   string // models.DeployActionDeploy, models.DeployActionDelete
+	Trigger  string // models.Trigger*
+	RetryOf  *uint
+	Triggers int // Number of coalesced triggers (queued deploys only)
+}
+
+// NewRun builds the history record of a finished run
+func NewRun(origin Origin, req Request, result *Result, runErr error) *models.DeployRun {
+	run := &models.DeployRun{
+		Domain:   req.Domain,
+		Action:   origin.Action,
+		Trigger:  origin.Trigger,
+		RetryOf:  origin.RetryOf,
+		Triggers: origin.Triggers,
+		Success:  runErr == nil,
+		Commands: []string{},
+	}
+
+	if phone := req.Phone; phone != nil {
+		if phone.ID != 0 {
+			id := phone.ID
+			run.PhoneID = &id
+		}
+		if phone.MacAddress != nil {
+			run.PhoneMAC = *phone.MacAddress
+		}
+		if phone.PhoneNumber != nil {
+			run.PhoneNumber = *phone.PhoneNumber
+		}
+	}
+
+	if runErr != nil {
+		run.Error = runErr.Error()
+		run.ExitCode = -1
+	}
+
+	if result != nil {
+		run.DurationMs = result.FinishedAt.Sub(result.StartedAt).Milliseconds()
+		run.Output = CombinedOutput(result)
+		for _, c := range result.Commands {
+			run.Commands = append(run.Commands, c.Command)
+			run.ExitCode = c.ExitCode
+		}
+		if data, err := json.Marshal(result); err == nil {
+			run.Result = string(data)
+		}
+	}
+	return run
+}
+
+// Record stores a finished run in the deploy history and prunes old runs of the domain.
+// Dry runs are not stored. A storage failure is only logged: the run itself has already happened.
+func Record(database *gorm.DB, origin Origin, req Request, result *Result, runErr error) *models.DeployRun {
+	run := NewRun(origin, req, result, runErr)
+	if req.DryRun || database == nil {
+		return run
+	}
+
+	if err := database.Create(run).Error; err != nil {
+		logger.Error("Failed to record deploy run for %s: %v", req.Domain, err)
+		return run
+	}
+
+	var cutoff models.DeployRun
+	err := database.Select("id").Where("domain = ?", req.Domain).Order("id desc").Offset(historyPerDomain).Limit(1).Find(&cutoff).Error
+	if err == nil && cutoff.ID != 0 {
+		database.Where("domain = ? AND id <= ?", req.Domain, cutoff.ID).Delete(&models.DeployRun{})
+	}
+	return run
+}
+
+// LastRuns returns the latest recorded run of every domain
+func LastRuns(database *gorm.DB) (map[string]models.DeployRun, error) {
+	var runs []models.DeployRun
+	err := database.Where("id IN (?)", database.Model(&models.DeployRun{}).Select("MAX(id)").Group("domain")).Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]models.DeployRun, len(runs))
+	for _, run := range runs {
+		result[run.Domain] = run
+	}
+	return result, nil
+}
+
+// CombinedOutput joins stdout and stderr of all commands
+func CombinedOutput(result *Result) string {
+	if result == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, c := range result.Commands {
+		sb.WriteString(c.Stdout)
+		sb.WriteString(c.Stderr)
+	}
+	return sb.String()
+}
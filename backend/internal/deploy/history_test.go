@@ -0,0 +1,62 @@
+package deploy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"provisioning-system/internal/config"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestRecord(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	e := NewExecutor(t.TempDir())
+	mac := "00:15:65:aa:bb:cc"
+	phone := &models.Phone{ID: 7, MacAddress: &mac}
+	deployOrigin := Origin{Action: models.DeployActionDeploy, Trigger: models.TriggerPhoneUpdate}
+
+	run := func(domain, shell string, dryRun bool) *models.DeployRun {
+		req := Request{Domain: domain, Commands: []config.Command{config.ShellCommand(shell)}, Phone: phone, DryRun: dryRun}
+		result, err := e.Run(context.Background(), req)
+		return Record(database, deployOrigin, req, result, err)
+	}
+
+	ok := run("office", "echo ok", false)
+	if !ok.Success || ok.ID == 0 || ok.Output != "ok\n" || ok.PhoneID == nil || *ok.PhoneID != 7 || ok.PhoneMAC != mac {
+		t.Fatalf("unexpected run: %+v", ok)
+	}
+
+	failed := run("office", "echo oops >&2; exit 3", false)
+	if failed.Success || failed.ExitCode != 3 || failed.Error == "" || failed.Output != "oops\n" {
+		t.Fatalf("unexpected failed run: %+v", failed)
+	}
+
+	if dry := run("office", "echo dry", true); dry.ID != 0 {
+		t.Errorf("dry run must not be recorded")
+	}
+	run("branch", "true", false)
+
+	last, err := LastRuns(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 || last["office"].ID != failed.ID || !last["branch"].Success {
+		t.Errorf("unexpected last runs: %+v", last)
+	}
+
+	// History is capped per domain
+	for i := 0; i < historyPerDomain; i++ {
+		Record(database, deployOrigin, Request{Domain: "office"}, nil, nil)
+	}
+	var count int64
+	database.Model(&models.DeployRun{}).Where("domain = ?", "office").Count(&count)
+	if count != historyPerDomain {
+		t.Errorf("expected %d runs kept, got %d", historyPerDomain, count)
+	}
+}
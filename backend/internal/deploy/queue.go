@@ -0,0 +1,282 @@
+package deploy
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"provisioning-system/internal/config"
+)
+
+// maxDelayWindows limits how long a busy domain can postpone its deploy: at most this many debounce windows
+const maxDelayWindows = 10
+
+// JobState describes a queued or running deploy
+type JobState struct {
+	Key       string     `json:"key"`
+	Domain    string     `json:"domain"`
+	Action    string     `json:"action"`
+	Trigger   string     `json:"trigger"`            // Of the latest trigger
+	PhoneID   *uint      `json:"phone_id,omitempty"` // Per-phone jobs only
+	Triggers  int        `json:"triggers"`           // Number of coalesced triggers
+	FirstAt   time.Time  `json:"first_at"`
+	DueAt     time.Time  `json:"due_at"`
+	Waiting   bool       `json:"waiting"` // Due, waiting for the in-flight deploy of the domain
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// QueueState is a snapshot of the deploy queue
+type QueueState struct {
+	Pending []JobState `json:"pending"`
+	Running []JobState `json:"running"`
+}
+
+type queuedJob struct {
+	state JobState
+	run   func(triggers int)
+	timer timer
+}
+
+// clock is the time source of the Queue, replaced in tests
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) timer
+}
+
+type timer interface {
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) timer { return time.AfterFunc(d, f) }
+
+// Queue serializes deploys per domain and coalesces triggers.
+// At most one deploy of a domain runs at a time. Triggers with the same key arriving within the debounce
+// window are merged into a single run. Queued jobs live in memory only and are lost on restart.
+// A nil Queue runs everything right away.
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string]*queuedJob
+	running map[string]JobState      // By domain
+	locks   map[string]chan struct{} // By domain, one in-flight deploy
+	clock   clock
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		pending: make(map[string]*queuedJob),
+		running: make(map[string]JobState),
+		locks:   make(map[string]chan struct{}),
+		clock:   realClock{},
+	}
+}
+
+// JobKey identifies jobs that may be coalesced: same domain and action, and the same phone for per-phone jobs
+func JobKey(domain, action string, phoneID *uint) string {
+	key := domain + "|" + action
+	if phoneID != nil {
+		key += "|" + strconv.FormatUint(uint64(*phoneID), 10)
+	}
+	return key
+}
+
+// Enqueue schedules run after window. If a job with the same key is pending, it is merged instead:
+// the latest run func replaces the earlier one and the window restarts (up to maxDelayWindows after the first trigger).
+// Returns the state of the (merged) job.
+func (q *Queue) Enqueue(job JobState, window time.Duration, run func(triggers int)) JobState {
+	if q == nil {
+		run(1)
+		return job
+	}
+
+	now := q.clock.Now()
+	job.Key = JobKey(job.Domain, job.Action, job.PhoneID)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if existing := q.pending[job.Key]; existing != nil {
+		existing.run = run
+		existing.state.Triggers++
+		existing.state.Trigger = job.Trigger
+		if !existing.state.Waiting {
+			due := now.Add(window)
+			if limit := existing.state.FirstAt.Add(window * maxDelayWindows); due.After(limit) {
+				due = limit
+			}
+			existing.state.DueAt = due
+			existing.timer.Reset(due.Sub(now))
+		}
+		return existing.state
+	}
+
+	job.Triggers = 1
+	job.FirstAt = now
+	job.DueAt = now.Add(window)
+	job.Waiting = false
+	job.StartedAt = nil
+
+	queued := &queuedJob{state: job, run: run}
+	queued.timer = q.clock.AfterFunc(window, func() { q.fire(queued) })
+	q.pending[job.Key] = queued
+	return job
+}
+
+// fire starts a due job once the domain is free
+func (q *Queue) fire(job *queuedJob) {
+	q.mu.Lock()
+	if q.pending[job.state.Key] != job || job.state.Waiting {
+		q.mu.Unlock()
+		return
+	}
+	job.state.Waiting = true
+	q.mu.Unlock()
+
+	unlock, _ := q.lock(context.Background(), job.state.Domain)
+	defer unlock()
+
+	q.mu.Lock()
+	delete(q.pending, job.state.Key)
+	state := job.state
+	run := job.run
+	q.mu.Unlock()
+
+	q.execute(state, func() { run(state.Triggers) })
+}
+
+// Do runs fn right away (blocking), after the in-flight deploy of the domain if there is one.
+// If ctx is done while waiting for the domain, fn is not run and the ctx error is returned.
+func (q *Queue) Do(ctx context.Context, job JobState, fn func()) error {
+	if q == nil {
+		fn()
+		return nil
+	}
+
+	job.Key = JobKey(job.Domain, job.Action, job.PhoneID)
+	job.Triggers = 1
+	job.FirstAt = q.clock.Now()
+	job.DueAt = job.FirstAt
+
+	unlock, err := q.lock(ctx, job.Domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	q.execute(job, fn)
+	return nil
+}
+
+// execute runs fn as the in-flight deploy of the domain. The domain lock must be held.
+func (q *Queue) execute(job JobState, fn func()) {
+	started := q.clock.Now()
+	job.Waiting = false
+	job.StartedAt = &started
+
+	q.mu.Lock()
+	q.running[job.Domain] = job
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.Domain)
+		q.mu.Unlock()
+	}()
+	fn()
+}
+
+// lock waits until the domain has no in-flight deploy (or ctx is done) and takes it
+func (q *Queue) lock(ctx context.Context, domain string) (func(), error) {
+	q.mu.Lock()
+	ch := q.locks[domain]
+	if ch == nil {
+		ch = make(chan struct{}, 1)
+		q.locks[domain] = ch
+	}
+	q.mu.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Flush makes pending jobs of the domain (all domains if empty) due right away
+func (q *Queue) Flush(domain string) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	now := q.clock.Now()
+	for _, job := range q.pending {
+		if (domain == "" || job.state.Domain == domain) && !job.state.Waiting {
+			job.state.DueAt = now
+			job.timer.Reset(0)
+			n++
+		}
+	}
+	return n
+}
+
+// State returns pending jobs ordered by due time and running deploys
+func (q *Queue) State() QueueState {
+	state := QueueState{Pending: []JobState{}, Running: []JobState{}}
+	if q == nil {
+		return state
+	}
+
+	q.mu.Lock()
+	for _, job := range q.pending {
+		state.Pending = append(state.Pending, job.state)
+	}
+	for _, job := range q.running {
+		state.Running = append(state.Running, job)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(state.Pending, func(i, j int) bool { return state.Pending[i].DueAt.Before(state.Pending[j].DueAt) })
+	sort.Slice(state.Running, func(i, j int) bool { return state.Running[i].Domain < state.Running[j].Domain })
+	return state
+}
+
+// DebounceWindow returns the deploy_debounce of the domain, 0 if not set (invalid values are rejected by config.LoadConfig)
+func DebounceWindow(domainCfg config.DomainSettings) time.Duration {
+	if d, err := time.ParseDuration(domainCfg.DeployDebounce); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// UsesPhone reports whether any command references phone data ({{.Phone...}} or $PROVISIONING_PHONE_*).
+// Such commands must run once per phone, they can not be merged into a domain-wide run.
+func UsesPhone(commands []config.Command) bool {
+	uses := func(s string) bool {
+		return strings.Contains(s, ".Phone") || strings.Contains(s, "PROVISIONING_PHONE_")
+	}
+	for _, c := range commands {
+		if uses(c.Shell) {
+			return true
+		}
+		for _, arg := range c.Argv {
+			if uses(arg) {
+				return true
+			}
+		}
+		for _, v := range c.Env {
+			if uses(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package deploy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"provisioning-system/internal/config"
+)
+
+// fakeClock fires timers only when advanced
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c      *fakeClock
+	at     time.Time
+	f      func()
+	active bool
+}
+
+func newFakeQueue() (*Queue, *fakeClock) {
+	c := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	q := NewQueue()
+	q.clock = c
+	return q, c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	t := &fakeTimer{c: c, f: f}
+	c.mu.Lock()
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	t.Reset(d)
+	return t
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	wasActive := t.active
+	t.at = t.c.now.Add(d)
+	t.active = true
+	t.c.mu.Unlock()
+	if d <= 0 {
+		t.c.Advance(0)
+	}
+	return wasActive
+}
+
+// Advance moves the clock and runs the timers that became due, each in its own goroutine like time.AfterFunc
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	for _, t := range c.timers {
+		if t.active && !t.at.After(c.now) {
+			t.active = false
+			due = append(due, t.f)
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range due {
+		go f()
+	}
+}
+
+func TestQueueCoalesce(t *testing.T) {
+	q, clock := newFakeQueue()
+	window := 10 * time.Second
+
+	runs := make(chan int, 10)
+	job := JobState{Domain: "office", Action: "deploy", Trigger: "phone_update"}
+	for i := 0; i < 5; i++ {
+		state := q.Enqueue(job, window, func(triggers int) { runs <- triggers })
+		if state.Triggers != i+1 {
+			t.Fatalf("expected %d triggers, got %d", i+1, state.Triggers)
+		}
+		clock.Advance(window - time.Second) // Every trigger restarts the window
+	}
+
+	if s := q.State(); len(s.Pending) != 1 || s.Pending[0].Key != "office|deploy" {
+		t.Fatalf("unexpected queue state: %+v", s)
+	}
+
+	clock.Advance(time.Second)
+	if triggers := <-runs; triggers != 5 {
+		t.Errorf("expected one run of 5 triggers, got %d", triggers)
+	}
+	if s := q.State(); len(s.Pending) != 0 {
+		t.Errorf("queue not empty: %+v", s)
+	}
+
+	// A busy domain is deployed at the latest maxDelayWindows after the first trigger,
+	// although every trigger would move the deploy half a window further
+	for i := 0; i < maxDelayWindows*2; i++ {
+		q.Enqueue(job, window, func(triggers int) { runs <- triggers })
+		clock.Advance(window / 2)
+	}
+	if triggers := <-runs; triggers != maxDelayWindows*2 {
+		t.Errorf("expected a run after %d windows with %d triggers, got %d", maxDelayWindows, maxDelayWindows*2, triggers)
+	}
+	select {
+	case n := <-runs:
+		t.Errorf("unexpected second run of %d triggers", n)
+	default:
+	}
+}
+
+func TestQueueOneInFlight(t *testing.T) {
+	q, clock := newFakeQueue()
+
+	var inFlight, maxInFlight atomic.Int32
+	work := func() {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond) // Let the others try to start
+		inFlight.Add(-1)
+	}
+
+	var wg sync.WaitGroup
+	// Per-phone jobs of the same domain and a manual deploy must not overlap
+	for i := uint(1); i <= 3; i++ {
+		id := i
+		wg.Add(1)
+		q.Enqueue(JobState{Domain: "office", Action: "deploy", PhoneID: &id}, time.Second, func(int) {
+			work()
+			wg.Done()
+		})
+	}
+	wg.Add(1)
+	go func() {
+		q.Do(context.Background(), JobState{Domain: "office", Action: "deploy", Trigger: "manual"}, work)
+		wg.Done()
+	}()
+
+	// Other domains are independent
+	wg.Add(1)
+	q.Enqueue(JobState{Domain: "branch", Action: "deploy"}, time.Second, func(int) { wg.Done() })
+
+	clock.Advance(time.Second)
+	wg.Wait()
+	if maxInFlight.Load() != 1 {
+		t.Errorf("expected one in-flight deploy per domain, got %d", maxInFlight.Load())
+	}
+}
+
+func TestQueueDoCancel(t *testing.T) {
+	q := NewQueue()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go q.Do(context.Background(), JobState{Domain: "office", Action: "deploy"}, func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	// A request waiting for the in-flight deploy gives up when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	if err := q.Do(ctx, JobState{Domain: "office", Action: "deploy"}, func() { ran = true }); err != context.Canceled || ran {
+		t.Errorf("Do = %v, ran %v; want context.Canceled without running", err, ran)
+	}
+	close(release)
+
+	if err := q.Do(context.Background(), JobState{Domain: "office", Action: "deploy"}, func() { ran = true }); err != nil || !ran {
+		t.Errorf("Do after the deploy finished = %v, ran %v", err, ran)
+	}
+}
+
+func TestQueueFlush(t *testing.T) {
+	q := NewQueue()
+	done := make(chan struct{})
+	q.Enqueue(JobState{Domain: "office", Action: "deploy"}, time.Hour, func(int) { close(done) })
+
+	if n := q.Flush("branch"); n != 0 {
+		t.Errorf("flushed %d jobs of another domain", n)
+	}
+	if n := q.Flush("office"); n != 1 {
+		t.Errorf("expected 1 flushed job, got %d", n)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flushed job did not run")
+	}
+}
+
+func TestUsesPhone(t *testing.T) {
+	tests := []struct {
+		commands []config.Command
+		want     bool
+	}{
+		{[]config.Command{config.ShellCommand("rsync -a $PROVISIONING_SOURCE/ pbx:/tftp/")}, false},
+		{[]config.Command{config.ShellCommand("notify {{ shellquote .Phone.Description }}")}, true},
+		{[]config.Command{config.ShellCommand("echo $PROVISIONING_PHONE_MAC")}, true},
+		{[]config.Command{{Argv: []string{"/opt/pbx", "{{.Phone.PhoneNumber}}"}}}, true},
+		{[]config.Command{{Argv: []string{"/opt/sync"}, Env: map[string]string{"NUM": "{{.Phone.PhoneNumber}}"}}}, true},
+	}
+	for i, tt := range tests {
+		if got := UsesPhone(tt.commands); got != tt.want {
+			t.Errorf("case %d: UsesPhone = %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"provisioning-system/internal/config"
+)
+
+// Target is a place the domain configs are pushed to
+type Target interface {
+	// Upload writes the file at relPath (slash separated, relative to the target base), creating directories
+	Upload(relPath string, r io.Reader) error
+	// Delete removes the file at relPath
+	Delete(relPath string) error
+	Close() error
+}
+
+// File actions in TargetResult
+const (
+	ActionUpload = "upload"
+	ActionDelete = "delete"
+)
+
+// FileResult is the outcome of one file operation on a target
+type FileResult struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TargetResult is the outcome of syncing one target
+type TargetResult struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Success   bool          `json:"success"`
+	Uploaded  int           `json:"uploaded"`
+	Deleted   int           `json:"deleted"`
+	Unchanged int           `json:"unchanged"`
+	Files     []FileResult  `json:"files,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// manifest maps relative file paths to the SHA-256 of the content last pushed to the target
+type manifest map[string]string
+
+// openTarget connects to the target described by cfg
+func openTarget(ctx context.Context, cfg config.DeployTarget) (Target, error) {
+	switch cfg.Type {
+	case "local":
+		return newLocalTarget(cfg)
+	case "ftp":
+		return newFTPTarget(ctx, cfg)
+	case "sftp":
+		return newSFTPTarget(ctx, cfg)
+	case "webdav":
+		return newWebDAVTarget(cfg)
+	default:
+		return nil, fmt.Errorf("unknown deploy target type %q", cfg.Type)
+	}
+}
+
+// targetTimeout returns the timeout of a target (DefaultTimeout if not set)
+func targetTimeout(cfg config.DeployTarget) time.Duration {
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// SyncTarget pushes changed files of temp_configs/<domain> to the target and deletes files that no longer exist locally.
+// What was pushed is remembered in a manifest under deploy_state/; with req.Force all files are uploaded
+// even if unchanged. With req.DryRun only the planned operations are returned.
+func (e *Executor) SyncTarget(ctx context.Context, req Request, cfg config.DeployTarget) TargetResult {
+	domain := req.Domain
+	start := time.Now()
+	res := TargetResult{Name: cfg.Name, Type: cfg.Type}
+	defer func() { res.Duration = time.Since(start) }()
+
+	fail := func(err error) TargetResult {
+		res.Error = err.Error()
+		return res
+	}
+
+	sourceDir := filepath.Join(e.ConfigDir, "temp_configs", domain)
+	local, err := checksumDir(sourceDir)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read %s: %w", sourceDir, err))
+	}
+
+	statePath := e.manifestPath(domain, cfg)
+	pushed, err := loadManifest(statePath)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Plan
+	var uploads, deletes []string
+	for path, sum := range local {
+		if !req.Force && pushed[path] == sum {
+			res.Unchanged++
+			continue
+		}
+		uploads = append(uploads, path)
+	}
+	if !cfg.KeepRemoved {
+		for path := range pushed {
+			if _, ok := local[path]; !ok {
+				deletes = append(deletes, path)
+			}
+		}
+	}
+	sort.Strings(uploads)
+	sort.Strings(deletes)
+
+	if len(uploads) == 0 && len(deletes) == 0 {
+		res.Success = true
+		return res
+	}
+
+	if req.DryRun {
+		for _, path := range uploads {
+			res.Files = append(res.Files, FileResult{Path: path, Action: ActionUpload})
+		}
+		for _, path := range deletes {
+			res.Files = append(res.Files, FileResult{Path: path, Action: ActionDelete})
+		}
+		res.Success = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, targetTimeout(cfg))
+	defer cancel()
+
+	target, err := openTarget(ctx, cfg)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect: %w", err))
+	}
+	defer target.Close()
+
+	failed := 0
+	for _, path := range uploads {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("sync interrupted: %w", ctx.Err()))
+		}
+		fr := FileResult{Path: path, Action: ActionUpload}
+		if err := uploadFile(target, sourceDir, path); err != nil {
+			fr.Error = err.Error()
+			failed++
+		} else {
+			pushed[path] = local[path]
+			res.Uploaded++
+		}
+		res.Files = append(res.Files, fr)
+	}
+	for _, path := range deletes {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("sync interrupted: %w", ctx.Err()))
+		}
+		fr := FileResult{Path: path, Action: ActionDelete}
+		if err := target.Delete(path); err != nil {
+			fr.Error = err.Error()
+			failed++
+		} else {
+			delete(pushed, path)
+			res.Deleted++
+		}
+		res.Files = append(res.Files, fr)
+	}
+
+	// Only successful operations are recorded, failed ones are retried on the next sync
+	if err := saveManifest(statePath, pushed); err != nil {
+		return fail(err)
+	}
+
+	if failed > 0 {
+		return fail(fmt.Errorf("%d file operation(s) failed", failed))
+	}
+	res.Success = true
+	return res
+}
+
+func uploadFile(target Target, sourceDir, relPath string) error {
+	f, err := os.Open(filepath.Join(sourceDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return target.Upload(relPath, f)
+}
+
+// manifestPath is <config dir>/deploy_state/<domain>/<target>.json
+func (e *Executor) manifestPath(domain string, cfg config.DeployTarget) string {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type + "-" + cfg.Host + cfg.URL + cfg.Path
+	}
+	return filepath.Join(e.ConfigDir, "deploy_state", url.PathEscape(domain), url.PathEscape(name)+".json")
+}
+
+// checksumDir returns SHA-256 of every file under dir, keyed by slash separated relative path.
+// A missing dir means there is nothing to push (all remote files will be deleted).
+func checksumDir(dir string) (manifest, error) {
+	sums := manifest{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	return sums, err
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadManifest(path string) (manifest, error) {
+	m := manifest{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deploy state: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse deploy state %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func saveManifest(path string, m manifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save deploy state: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save deploy state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
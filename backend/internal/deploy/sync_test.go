@@ -0,0 +1,416 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"provisioning-system/internal/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func writeConfig(t *testing.T, configDir, domain, name, content string) {
+	t.Helper()
+	path := filepath.Join(configDir, "temp_configs", domain, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncSteps runs the same scenario against any target and checks what the target reports
+func syncSteps(t *testing.T, target config.DeployTarget, exists func(string) bool) {
+	configDir := t.TempDir()
+	e := NewExecutor(configDir)
+	req := Request{Domain: "office"}
+
+	writeConfig(t, configDir, "office", "001565aabbcc.cfg", "a")
+	writeConfig(t, configDir, "office", "001565aabbdd.cfg", "b")
+	writeConfig(t, configDir, "office", "yealink/y000000000108.cfg", "common")
+
+	res := e.SyncTarget(context.Background(), req, target)
+	if !res.Success || res.Uploaded != 3 || res.Deleted != 0 {
+		t.Fatalf("first sync: %+v", res)
+	}
+
+	// Nothing changed
+	res = e.SyncTarget(context.Background(), req, target)
+	if !res.Success || res.Uploaded != 0 || res.Unchanged != 3 {
+		t.Fatalf("second sync: %+v", res)
+	}
+
+	// One phone changed, one removed
+	writeConfig(t, configDir, "office", "001565aabbcc.cfg", "a2")
+	os.Remove(filepath.Join(configDir, "temp_configs", "office", "001565aabbdd.cfg"))
+
+	dry := req
+	dry.DryRun = true
+	res = e.SyncTarget(context.Background(), dry, target)
+	if !res.Success || len(res.Files) != 2 || res.Uploaded != 0 {
+		t.Fatalf("dry run: %+v", res)
+	}
+
+	res = e.SyncTarget(context.Background(), req, target)
+	if !res.Success || res.Uploaded != 1 || res.Deleted != 1 || res.Unchanged != 1 {
+		t.Fatalf("third sync: %+v", res)
+	}
+	if !exists("001565aabbcc.cfg") || exists("001565aabbdd.cfg") || !exists("yealink/y000000000108.cfg") {
+		t.Errorf("unexpected target contents")
+	}
+}
+
+func TestSyncLocal(t *testing.T) {
+	dest := t.TempDir()
+	syncSteps(t, config.DeployTarget{Name: "tftp-root", Type: "local", Path: dest}, func(p string) bool {
+		_, err := os.Stat(filepath.Join(dest, filepath.FromSlash(p)))
+		return err == nil
+	})
+
+	data, _ := os.ReadFile(filepath.Join(dest, "001565aabbcc.cfg"))
+	if string(data) != "a2" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
+
+func TestSyncWebDAV(t *testing.T) {
+	var mu sync.Mutex
+	files := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "prov" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/dav/")
+		switch r.Method {
+		case "MKCOL":
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			files[name] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if _, ok := files[name]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(files, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	target := config.DeployTarget{Name: "dav", Type: "webdav", URL: srv.URL + "/dav", Username: "prov", Password: "secret"}
+	syncSteps(t, target, func(p string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := files[p]
+		return ok
+	})
+}
+
+// startFTPServer runs a minimal passive-mode FTP server keeping uploaded files in files.
+// It accepts the user "prov" with the password "secret".
+func startFTPServer(t *testing.T, mu *sync.Mutex, files map[string]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFTP(conn, mu, files)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFTP(conn net.Conn, mu *sync.Mutex, files map[string]string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 ready")
+	var user string
+	var loggedIn bool
+	var data net.Listener
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		name := strings.TrimPrefix(arg, "/")
+		if !loggedIn && cmd != "USER" && cmd != "PASS" && cmd != "QUIT" {
+			reply("530 not logged in")
+			continue
+		}
+		switch cmd {
+		case "USER":
+			user = arg
+			reply("331 password required")
+		case "PASS":
+			if user != "prov" || arg != "secret" {
+				reply("530 login incorrect")
+				continue
+			}
+			loggedIn = true
+			reply("230 logged in")
+		case "FEAT":
+			reply("211 no features")
+		case "TYPE":
+			reply("200 ok")
+		case "MKD":
+			reply("257 created")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 no data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "STOR":
+			if data == nil {
+				reply("425 use EPSV first")
+				continue
+			}
+			reply("150 ok")
+			dc, err := data.Accept()
+			data.Close()
+			data = nil
+			if err != nil {
+				reply("425 no data connection")
+				continue
+			}
+			body, _ := io.ReadAll(dc)
+			dc.Close()
+			mu.Lock()
+			files[name] = string(body)
+			mu.Unlock()
+			reply("226 transfer complete")
+		case "DELE":
+			mu.Lock()
+			_, ok := files[name]
+			delete(files, name)
+			mu.Unlock()
+			if !ok {
+				reply("550 no such file")
+				continue
+			}
+			reply("250 deleted")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSyncFTP(t *testing.T) {
+	var mu sync.Mutex
+	files := map[string]string{}
+	addr := startFTPServer(t, &mu, files)
+
+	target := config.DeployTarget{Name: "ftp", Type: "ftp", Host: addr, Path: "/tftpboot", Username: "prov", Password: "secret", Timeout: "5s"}
+	syncSteps(t, target, func(p string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := files["tftpboot/"+p]
+		return ok
+	})
+	mu.Lock()
+	if files["tftpboot/001565aabbcc.cfg"] != "a2" {
+		t.Errorf("unexpected content %q", files["tftpboot/001565aabbcc.cfg"])
+	}
+	mu.Unlock()
+
+	target.Password = "wrong"
+	if _, err := newFTPTarget(context.Background(), target); err == nil {
+		t.Error("login with a wrong password succeeded")
+	}
+}
+
+// startSFTPServer serves root over SFTP on a local port. Clients log in as "prov" with the password
+// "secret" or with clientKey. Returns the address and the host key of the server.
+func startSFTPServer(t *testing.T, root string, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "prov" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "prov" && clientKey != nil && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, serverConfig, root)
+		}
+	}()
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveSFTP(conn net.Conn, serverConfig *ssh.ServerConfig, root string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(root))
+					if err == nil {
+						server.Serve()
+					}
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSyncSFTP(t *testing.T) {
+	root := t.TempDir()
+	addr, hostKey := startSFTPServer(t, root, nil)
+
+	target := config.DeployTarget{
+		Name:     "pbx",
+		Type:     "sftp",
+		Host:     addr,
+		Path:     "tftpboot",
+		Username: "prov",
+		Password: "secret",
+		HostKey:  string(ssh.MarshalAuthorizedKey(hostKey)),
+	}
+	syncSteps(t, target, func(p string) bool {
+		_, err := os.Stat(filepath.Join(root, "tftpboot", filepath.FromSlash(p)))
+		return err == nil
+	})
+}
+
+func TestSFTPAuth(t *testing.T) {
+	dir := t.TempDir()
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshClientPub, _ := ssh.NewPublicKey(clientPub)
+	pemBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyFile, pem.EncodeToMemory(pemBlock), 0600)
+
+	addr, hostKey := startSFTPServer(t, t.TempDir(), sshClientPub)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"), 0644)
+
+	_, otherHost, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherHost)
+
+	base := config.DeployTarget{Type: "sftp", Host: addr, Username: "prov", Timeout: "5s"}
+	tests := []struct {
+		name   string
+		modify func(*config.DeployTarget)
+		ok     bool
+	}{
+		{"password and host key", func(c *config.DeployTarget) {
+			c.Password = "secret"
+			c.HostKey = string(ssh.MarshalAuthorizedKey(hostKey))
+		}, true},
+		{"private key and known_hosts", func(c *config.DeployTarget) {
+			c.PrivateKey = keyFile
+			c.KnownHosts = knownHosts
+		}, true},
+		{"wrong password", func(c *config.DeployTarget) {
+			c.Password = "wrong"
+			c.HostKey = string(ssh.MarshalAuthorizedKey(hostKey))
+		}, false},
+		{"host key mismatch", func(c *config.DeployTarget) {
+			c.Password = "secret"
+			c.HostKey = string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey()))
+		}, false},
+		{"host key not set", func(c *config.DeployTarget) {
+			c.Password = "secret"
+		}, false},
+	}
+	for _, tt := range tests {
+		cfg := base
+		tt.modify(&cfg)
+		target, err := newSFTPTarget(context.Background(), cfg)
+		if err == nil {
+			target.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+
+	"provisioning-system/internal/config"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// ftpTarget uploads configs to an FTP server
+type ftpTarget struct {
+	conn *ftp.ServerConn
+	base string
+	dirs map[string]bool // Directories already created in this session
+}
+
+func newFTPTarget(ctx context.Context, cfg config.DeployTarget) (*ftpTarget, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("host is required for ftp target")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "21")
+	}
+
+	conn, err := ftp.Dial(addr, ftp.DialWithContext(ctx), ftp.DialWithTimeout(targetTimeout(cfg)))
+	if err != nil {
+		return nil, err
+	}
+
+	user := cfg.Username
+	if user == "" {
+		user = "anonymous"
+	}
+	if err := conn.Login(user, cfg.Password); err != nil {
+		conn.Quit()
+		return nil, err
+	}
+
+	return &ftpTarget{conn: conn, base: cfg.Path, dirs: map[string]bool{}}, nil
+}
+
+func (t *ftpTarget) remote(relPath string) string {
+	return path.Join(t.base, relPath)
+}
+
+// mkdirAll creates the parent directories of p. Errors are ignored: the directory usually exists already,
+// and a real problem shows up in the following STOR.
+func (t *ftpTarget) mkdirAll(dir string) {
+	if dir == "" || dir == "." || dir == "/" || t.dirs[dir] {
+		return
+	}
+	t.mkdirAll(path.Dir(dir))
+	t.conn.MakeDir(dir)
+	t.dirs[dir] = true
+}
+
+func (t *ftpTarget) Upload(relPath string, r io.Reader) error {
+	remote := t.remote(relPath)
+	t.mkdirAll(path.Dir(remote))
+	return t.conn.Stor(remote, r)
+}
+
+func (t *ftpTarget) Delete(relPath string) error {
+	err := t.conn.Delete(t.remote(relPath))
+	if err != nil && strings.HasPrefix(err.Error(), "550") {
+		return nil // Already gone
+	}
+	return err
+}
+
+func (t *ftpTarget) Close() error {
+	return t.conn.Quit()
+}
@@ -0,0 +1,63 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"provisioning-system/internal/config"
+)
+
+// localTarget mirrors the configs into a local directory (e.g. a TFTP root or an NFS mount)
+type localTarget struct {
+	base string
+}
+
+func newLocalTarget(cfg config.DeployTarget) (*localTarget, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is required for local target")
+	}
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, err
+	}
+	return &localTarget{base: cfg.Path}, nil
+}
+
+func (t *localTarget) Upload(relPath string, r io.Reader) error {
+	dest := filepath.Join(t.base, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename, so devices never read a half-written config
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (t *localTarget) Delete(relPath string) error {
+	err := os.Remove(filepath.Join(t.base, filepath.FromSlash(relPath)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *localTarget) Close() error {
+	return nil
+}
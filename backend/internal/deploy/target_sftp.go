@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+
+	"provisioning-system/internal/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpTarget uploads configs over SFTP
+type sftpTarget struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	base   string
+}
+
+func newSFTPTarget(ctx context.Context, cfg config.DeployTarget) (*sftpTarget, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("host is required for sftp target")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	sshConfig, err := sftpClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, sshConfig)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	return &sftpTarget{ssh: sshClient, client: client, base: cfg.Path}, nil
+}
+
+// sftpClientConfig builds the SSH client config of a target. The server key is always verified
+// (host_key or known_hosts): the target gets the deploy credentials.
+func sftpClientConfig(cfg config.DeployTarget) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		key, err := os.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host_key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(key)
+	case cfg.KnownHosts != "":
+		callback, err := knownhosts.New(cfg.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	default:
+		return nil, fmt.Errorf("host_key or known_hosts is required for sftp target")
+	}
+
+	return &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         targetTimeout(cfg),
+	}, nil
+}
+
+func (t *sftpTarget) remote(relPath string) string {
+	return path.Join(t.base, relPath)
+}
+
+func (t *sftpTarget) Upload(relPath string, r io.Reader) error {
+	remote := t.remote(relPath)
+	if err := t.client.MkdirAll(path.Dir(remote)); err != nil {
+		return err
+	}
+
+	// Upload under a temp name and rename, so devices never read a half-written config
+	tmp := remote + ".upload"
+	f, err := t.client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		t.client.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		t.client.Remove(tmp)
+		return err
+	}
+	return t.client.PosixRename(tmp, remote)
+}
+
+func (t *sftpTarget) Delete(relPath string) error {
+	err := t.client.Remove(t.remote(relPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *sftpTarget) Close() error {
+	t.client.Close()
+	return t.ssh.Close()
+}
@@ -0,0 +1,112 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"provisioning-system/internal/config"
+)
+
+// webdavTarget uploads configs with HTTP PUT (WebDAV, or any server accepting PUT/DELETE)
+type webdavTarget struct {
+	base   *url.URL
+	cfg    config.DeployTarget
+	client *http.Client
+	dirs   map[string]bool // Collections already created in this session
+}
+
+func newWebDAVTarget(cfg config.DeployTarget) (*webdavTarget, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("url is required for webdav target")
+	}
+	base, err := url.Parse(cfg.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid webdav url %q", cfg.URL)
+	}
+	return &webdavTarget{
+		base:   base,
+		cfg:    cfg,
+		client: &http.Client{Timeout: targetTimeout(cfg)},
+		dirs:   map[string]bool{},
+	}, nil
+}
+
+func (t *webdavTarget) url(relPath string) string {
+	u := *t.base
+	u.Path = path.Join("/", u.Path, relPath)
+	return u.String()
+}
+
+func (t *webdavTarget) do(method, relPath string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, t.url(relPath), body)
+	if err != nil {
+		return nil, err
+	}
+	if t.cfg.Username != "" {
+		req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp, nil
+}
+
+// mkcol creates the parent collections of relPath. 405 means the collection exists.
+func (t *webdavTarget) mkcol(dir string) error {
+	if dir == "" || dir == "." || t.dirs[dir] {
+		return nil
+	}
+	if err := t.mkcol(path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := t.do("MKCOL", dir, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("MKCOL %s: %s", dir, resp.Status)
+	}
+	t.dirs[dir] = true
+	return nil
+}
+
+func (t *webdavTarget) Upload(relPath string, r io.Reader) error {
+	if strings.Contains(relPath, "/") {
+		if err := t.mkcol(path.Dir(relPath)); err != nil {
+			return err
+		}
+	}
+	resp, err := t.do(http.MethodPut, relPath, r)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s: %s", relPath, resp.Status)
+	}
+	return nil
+}
+
+func (t *webdavTarget) Delete(relPath string) error {
+	resp, err := t.do(http.MethodDelete, relPath, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("DELETE %s: %s", relPath, resp.Status)
+	}
+	return nil
+}
+
+func (t *webdavTarget) Close() error {
+	return nil
+}
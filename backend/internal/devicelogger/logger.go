@@ -6,16 +6,36 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"provisioning-system/internal/accesslog"
 	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/checkin"
 	"provisioning-system/internal/config"
+	"provisioning-system/internal/logger"
 )
 
+// Pseudo status codes for access policy events.
+// They never reach the device, but make policy hits easy to spot (and filter) in the debug stream.
+const (
+	StatusAccessAlert  = 460 // Mismatch detected, file was still served
+	StatusAccessDenied = 461 // Mismatch detected, request rejected with 403
+)
+
+// dropReportInterval is how often dropped events are reported in the log
+const dropReportInterval = time.Minute
+
 type DeviceLogger struct {
 	Config      *config.SystemConfig
 	Broadcaster *broadcaster.Broadcaster
+	Tracker     *checkin.Tracker // Optional: stores check-ins on phone records
+	Store       *accesslog.Store // Optional: persistent, queryable access log
 	mu          sync.Mutex
+	file        *os.File // Access log file, kept open between events
+	filePath    string
+	started     atomic.Bool
+	sub         *broadcaster.Subscription // Bus subscription of the sinks, set by Start
 }
 
 func NewDeviceLogger(cfg *config.SystemConfig, b *broadcaster.Broadcaster) *DeviceLogger {
@@ -38,65 +58,132 @@ func (w *responseWriterWrapper) WriteHeader(code int) {
 
 func (l *DeviceLogger) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if logging is enabled
-		logLevel := l.Config.Server.LogDeviceAccess
-		if logLevel == "" || logLevel == "none" {
-			next.ServeHTTP(w, r)
-			return
-		}
-
 		wrapper := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
 		start := time.Now()
 
 		next.ServeHTTP(wrapper, r)
 
-		// Determine if we should log based on level
-		shouldLog := false
-		if logLevel == "full" || logLevel == "access" {
-			shouldLog = true
-		} else if logLevel == "error" && wrapper.statusCode >= 400 {
-			shouldLog = true
+		// Extract IP (handle X-Forwarded-For if behind proxy, but simple RemoteAddr for now)
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
 		}
 
-		if shouldLog {
-			// Extract IP (handle X-Forwarded-For if behind proxy, but simple RemoteAddr for now)
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				ip = r.RemoteAddr
-			}
+		l.handle(broadcaster.LogEvent{
+			Time:          start,
+			SourceIP:      ip,
+			StatusCode:    wrapper.statusCode,
+			RequestedFile: r.URL.Path,
+			Method:        r.Method,
+			UserAgent:     r.UserAgent(),
+		})
+	})
+}
 
-			event := broadcaster.LogEvent{
-				Time:          start,
-				SourceIP:      ip,
-				StatusCode:    wrapper.statusCode,
-				RequestedFile: r.URL.Path,
-				Method:        r.Method,
-				UserAgent:     r.UserAgent(),
-			}
+// handle tracks the device check-in and logs the event according to log_device_access
+func (l *DeviceLogger) handle(event broadcaster.LogEvent) {
+	// Check-ins and unknown devices are tracked regardless of the logging level
+	if l.Tracker != nil {
+		go l.Tracker.Track(event)
+	}
 
-			// Broadcast
-			if l.Broadcaster != nil {
-				l.Broadcaster.Broadcast(event)
-			}
+	// Failed fetches are system events (webhooks etc.), also regardless of the logging level.
+	// Policy alerts are not failures: the file was served.
+	if event.StatusCode >= 400 && event.StatusCode != StatusAccessAlert {
+		l.Broadcaster.Publish(broadcaster.TypeDeviceFetchFailed, "", event)
+	}
 
-			// Log to file
-			if l.Config.Server.LogFilePath != "" {
-				l.logToFile(event)
+	// Determine if we should log based on level
+	logLevel := l.Config.Server.LogDeviceAccess
+	if logLevel == "" || logLevel == "none" {
+		return
+	}
+	if logLevel == "error" && event.StatusCode < 400 {
+		return
+	}
+
+	// Publish to the event bus. Once Start is called the DB store and the file sink consume it from there
+	l.Broadcaster.Broadcast(event)
+	if !l.started.Load() {
+		l.sink(event)
+	}
+}
+
+// Start subscribes the DB store and the file sink to device access events on the bus
+func (l *DeviceLogger) Start() {
+	if l.Broadcaster == nil {
+		return
+	}
+	sub := l.Broadcaster.SubscribeSink(broadcaster.TypeDeviceAccess)
+	l.sub = sub
+	l.started.Store(true)
+
+	go func() {
+		report := time.NewTicker(dropReportInterval)
+		defer report.Stop()
+
+		var reported int64
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if logEvent, ok := event.Data.(broadcaster.LogEvent); ok {
+					l.sink(logEvent)
+				}
+			case <-report.C:
+				// Events the sinks could not keep up with never reach the DB or the file
+				if dropped := sub.Dropped(); dropped > reported {
+					logger.Warn("Device access log is too slow: %d events dropped in the last %v (%d since start)", dropped-reported, dropReportInterval, dropped)
+					reported = dropped
+				}
 			}
 		}
-	})
+	}()
+}
+
+// Dropped returns the number of device access events that were not stored because the sinks were too slow
+func (l *DeviceLogger) Dropped() int64 {
+	var dropped int64
+	if l.started.Load() {
+		dropped = l.sub.Dropped()
+	}
+	if l.Store != nil {
+		dropped += l.Store.Dropped()
+	}
+	return dropped
+}
+
+// sink stores the event in the DB and in the log file
+func (l *DeviceLogger) sink(event broadcaster.LogEvent) {
+	if l.Store != nil {
+		l.Store.Save(event)
+	}
+	if l.Config.Server.LogFilePath != "" {
+		l.logToFile(event)
+	}
 }
 
 func (l *DeviceLogger) logToFile(event broadcaster.LogEvent) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	f, err := os.OpenFile(l.Config.Server.LogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Printf("Error opening log file: %v\n", err)
-		return
+	// (Re)open the file only when the path changes
+	path := l.Config.Server.LogFilePath
+	if l.file == nil || l.filePath != path {
+		if l.file != nil {
+			l.file.Close()
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			l.file = nil
+			fmt.Printf("Error opening log file: %v\n", err)
+			return
+		}
+		l.file = f
+		l.filePath = path
 	}
-	defer f.Close()
 
 	logLine := fmt.Sprintf("%s | %s | %d | %s | %s | %s | %s\n",
 		event.Time.Format(time.RFC3339),
@@ -108,23 +195,13 @@ func (l *DeviceLogger) logToFile(event broadcaster.LogEvent) {
 		event.Message,
 	)
 
-	if _, err := f.WriteString(logLine); err != nil {
+	if _, err := l.file.WriteString(logLine); err != nil {
 		fmt.Printf("Error writing to log file: %v\n", err)
 	}
 }
 
 func (l *DeviceLogger) LogAccess(sourceIP string, statusCode int, method string, requestedFile string, userAgent string, message string) {
-	logLevel := l.Config.Server.LogDeviceAccess
-	if logLevel == "" || logLevel == "none" {
-		return
-	}
-
-	// Filter based on level
-	if logLevel == "error" && statusCode < 400 {
-		return
-	}
-
-	event := broadcaster.LogEvent{
+	l.handle(broadcaster.LogEvent{
 		Time:          time.Now(),
 		SourceIP:      sourceIP,
 		StatusCode:    statusCode,
@@ -132,15 +209,7 @@ func (l *DeviceLogger) LogAccess(sourceIP string, statusCode int, method string,
 		Method:        method,
 		UserAgent:     userAgent,
 		Message:       message,
-	}
-
-	if l.Broadcaster != nil {
-		l.Broadcaster.Broadcast(event)
-	}
-
-	if l.Config.Server.LogFilePath != "" {
-		l.logToFile(event)
-	}
+	})
 }
 
 func (l *DeviceLogger) LogCustom(r *http.Request, statusCode int, message string) {
@@ -0,0 +1,190 @@
+// Package firmware keeps the firmware repository (files under <config-dir>/firmware/<vendor>/)
+// and resolves the firmware a phone should run according to the firmware policies.
+package firmware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+
+	"gorm.io/gorm"
+)
+
+// Repository stores firmware files
+type Repository struct {
+	Dir string
+}
+
+func NewRepository(configDir string) *Repository {
+	return &Repository{Dir: filepath.Join(configDir, "firmware")}
+}
+
+// ValidName reports whether name can be used as a vendor id or file name in the repository
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+// Path returns the relative path of a firmware file, also its path under /firmware/
+func Path(fw models.Firmware) string {
+	return fw.Vendor + "/" + fw.FileName
+}
+
+// Save writes the file and returns its size and SHA-256. An existing file is not overwritten.
+func (r *Repository) Save(vendor, fileName string, src io.Reader) (int64, string, error) {
+	if !ValidName(vendor) || !ValidName(fileName) {
+		return 0, "", fmt.Errorf("invalid firmware file name %q", fileName)
+	}
+	dir := filepath.Join(r.Dir, vendor)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, "", err
+	}
+	target := filepath.Join(dir, fileName)
+	if _, err := os.Stat(target); err == nil {
+		return 0, "", os.ErrExist
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Remove deletes the file of the firmware
+func (r *Repository) Remove(fw models.Firmware) error {
+	if !ValidName(fw.Vendor) || !ValidName(fw.FileName) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(r.Dir, fw.Vendor, fw.FileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Resolver picks the firmware policy of a phone and the firmware of its rollout stage
+type Resolver struct {
+	DB *gorm.DB
+}
+
+func NewResolver(db *gorm.DB) *Resolver {
+	return &Resolver{DB: db}
+}
+
+// Policies are the enabled firmware policies with their firmware, loaded once to resolve many phones
+type Policies []models.FirmwarePolicy
+
+// Load returns the enabled policies
+func (r *Resolver) Load() (Policies, error) {
+	var policies Policies
+	err := r.DB.Preload("Firmware").Preload("PreviousFirmware").Where("enabled = ?", true).Order("id").Find(&policies).Error
+	return policies, err
+}
+
+// Loader returns the firmware resolver of one config generation run (provisioner.Manager.Firmware):
+// the policies are loaded once for all phones of the run
+func (r *Resolver) Loader() (provisioner.FirmwareResolver, error) {
+	policies, err := r.Load()
+	if err != nil {
+		return nil, err
+	}
+	return policies.Resolve, nil
+}
+
+// Policy returns the most specific policy for the phone: domain and model, domain, model, vendor-wide.
+// Model-wide policies whose firmware does not apply to the phone's model are skipped.
+func (ps Policies) Policy(phone models.Phone) *models.FirmwarePolicy {
+	var best *models.FirmwarePolicy
+	bestScore := -1
+	for i := range ps {
+		p := &ps[i]
+		if p.Vendor != phone.Vendor || (p.Domain != "" && p.Domain != phone.Domain) || (p.ModelID != "" && p.ModelID != phone.ModelID) {
+			continue
+		}
+		if p.Firmware == nil || !p.Firmware.AppliesTo(phone.ModelID) {
+			continue
+		}
+		score := 0
+		if p.Domain != "" {
+			score += 2
+		}
+		if p.ModelID != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// Resolve returns the firmware the phone should run, nil if no policy applies.
+// It has the signature of provisioner.FirmwareResolver.
+func (ps Policies) Resolve(phone models.Phone) *models.Firmware {
+	policy := ps.Policy(phone)
+	if policy == nil {
+		return nil
+	}
+	return Target(*policy, phone)
+}
+
+// Target returns the firmware of the policy for the phone: the target one if the phone is in the rollout,
+// otherwise the previous one (nil if not set or not applicable to the model)
+func Target(policy models.FirmwarePolicy, phone models.Phone) *models.Firmware {
+	if InRollout(policy, phone) {
+		return policy.Firmware
+	}
+	if policy.PreviousFirmware != nil && policy.PreviousFirmware.AppliesTo(phone.ModelID) {
+		return policy.PreviousFirmware
+	}
+	return nil
+}
+
+// InRollout reports whether the phone is in the current stage of the policy: listed explicitly
+// or within the percentage. Phones are bucketed by a hash of the policy and phone ids,
+// so raising the percentage only adds phones.
+func InRollout(policy models.FirmwarePolicy, phone models.Phone) bool {
+	for _, id := range policy.PhoneIDs {
+		if id == phone.ID {
+			return true
+		}
+	}
+	if policy.RolloutPercent >= 100 {
+		return true
+	}
+	if policy.RolloutPercent <= 0 {
+		return false
+	}
+	return bucket(policy.ID, phone.ID) < policy.RolloutPercent
+}
+
+func bucket(policyID, phoneID uint) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatUint(uint64(policyID), 10) + ":" + strconv.FormatUint(uint64(phoneID), 10)))
+	return int(h.Sum32() % 100)
+}
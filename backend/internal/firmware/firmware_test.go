@@ -0,0 +1,119 @@
+package firmware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestInRollout(t *testing.T) {
+	policy := models.FirmwarePolicy{ID: 3, RolloutPercent: 10, PhoneIDs: []uint{500}}
+
+	stage := func(percent int) map[uint]bool {
+		policy.RolloutPercent = percent
+		in := map[uint]bool{}
+		for id := uint(1); id <= 1000; id++ {
+			if InRollout(policy, models.Phone{ID: id}) {
+				in[id] = true
+			}
+		}
+		return in
+	}
+
+	small, large := stage(10), stage(50)
+	if len(small) < 50 || len(small) > 150 {
+		t.Fatalf("10%% of 1000 phones selected %d", len(small))
+	}
+	for id := range small {
+		if !large[id] {
+			t.Fatalf("phone %d left the rollout when the percentage was raised", id)
+		}
+	}
+	if paused := stage(0); len(paused) != 1 || !paused[500] {
+		t.Fatalf("only the listed phone must be in a 0%% rollout, got %d", len(paused))
+	}
+	if all := stage(100); len(all) != 1000 {
+		t.Fatalf("100%% selected %d", len(all))
+	}
+}
+
+func TestResolver(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	fw := func(version string, modelIDs ...string) models.Firmware {
+		f := models.Firmware{Vendor: "yealink", FileName: version + ".rom", Version: version, Models: modelIDs}
+		if err := database.Create(&f).Error; err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	base, t46, t54 := fw("66.86.0.1"), fw("66.86.0.15", "yealink-t46s"), fw("70.86.0.5", "yealink-t54w")
+
+	prev := base.ID
+	policies := []models.FirmwarePolicy{
+		{Vendor: "yealink", FirmwareID: base.ID, RolloutPercent: 100, Enabled: true},
+		{Vendor: "yealink", ModelID: "yealink-t46s", FirmwareID: t46.ID, RolloutPercent: 100, Enabled: true},
+		{Domain: "office", Vendor: "yealink", ModelID: "yealink-t46s", FirmwareID: t46.ID, PreviousFirmwareID: &prev, RolloutPercent: 0, PhoneIDs: []uint{1}, Enabled: true},
+		{Domain: "lab", Vendor: "yealink", FirmwareID: t54.ID, RolloutPercent: 100, Enabled: false},
+	}
+	for i := range policies {
+		if err := database.Create(&policies[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolve, err := NewResolver(database).Loader()
+	if err != nil {
+		t.Fatalf("Loader: %v", err)
+	}
+	cases := []struct {
+		phone models.Phone
+		want  string
+	}{
+		{models.Phone{ID: 1, Domain: "office", Vendor: "yealink", ModelID: "yealink-t46s"}, "66.86.0.15"}, // Listed in the staged policy
+		{models.Phone{ID: 2, Domain: "office", Vendor: "yealink", ModelID: "yealink-t46s"}, "66.86.0.1"},  // Outside the stage: previous firmware
+		{models.Phone{ID: 3, Domain: "hq", Vendor: "yealink", ModelID: "yealink-t46s"}, "66.86.0.15"},     // Model-wide policy
+		{models.Phone{ID: 4, Domain: "lab", Vendor: "yealink", ModelID: "yealink-t54w"}, "66.86.0.1"},     // Disabled domain policy, vendor-wide one applies
+		{models.Phone{ID: 5, Domain: "hq", Vendor: "snom", ModelID: "snom-d785"}, ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if fw := resolve(c.phone); fw != nil {
+			got = fw.Version
+		}
+		if got != c.want {
+			t.Errorf("phone %d: got firmware %q, want %q", c.phone.ID, got, c.want)
+		}
+	}
+}
+
+func TestRepositorySave(t *testing.T) {
+	repo := &Repository{Dir: t.TempDir()}
+
+	size, sum, err := repo.Save("yealink", "T46S.rom", strings.NewReader("firmware"))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	expected := sha256.Sum256([]byte("firmware"))
+	if size != 8 || sum != hex.EncodeToString(expected[:]) {
+		t.Fatalf("unexpected size %d or checksum %s", size, sum)
+	}
+	if data, err := os.ReadFile(filepath.Join(repo.Dir, "yealink", "T46S.rom")); err != nil || string(data) != "firmware" {
+		t.Fatalf("file not saved: %v", err)
+	}
+	if _, _, err := repo.Save("yealink", "T46S.rom", strings.NewReader("other")); !os.IsExist(err) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+	if _, _, err := repo.Save("yealink", "../evil", strings.NewReader("x")); err == nil {
+		t.Fatal("path traversal must be rejected")
+	}
+}
@@ -0,0 +1,124 @@
+package macaddr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MAC is a device MAC address in canonical form: 12 lowercase hex digits ("001565aabbcc").
+// Phones store it as String() ("00:15:65:aa:bb:cc"), the other tables store the canonical form.
+type MAC string
+
+// Output formats of Format (and the "mac" template filter)
+const (
+	FormatPlain = "plain" // 001565aabbcc
+	FormatColon = "colon" // 00:15:65:aa:bb:cc
+	FormatDash  = "dash"  // 00-15-65-aa-bb-cc
+	FormatDot   = "dot"   // 0015.65aa.bbcc (Cisco)
+)
+
+// Formats lists the names accepted by Format
+var Formats = []string{FormatPlain, FormatColon, FormatDash, FormatDot}
+
+// ParseError describes why a string is not a device MAC address
+type ParseError struct {
+	Input  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid MAC address %q: %s", e.Input, e.Reason)
+}
+
+// Parse reads a MAC address written as 00:15:65:AA:BB:CC, 00-15-65-aa-bb-cc, 0015.65aa.bbcc,
+// 0015-65aa-bbcc or 001565aabbcc (any case). Multicast, broadcast and all-zero addresses are rejected:
+// they never belong to a device.
+func Parse(s string) (MAC, error) {
+	input := s
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", &ParseError{input, "empty"}
+	}
+
+	hex, ok := "", false
+	switch {
+	case len(s) == 12:
+		hex, ok = s, true
+	case len(s) == 17:
+		hex, ok = joinGroups(s, s[2:3], 2)
+	case len(s) == 14:
+		hex, ok = joinGroups(s, s[4:5], 4)
+	}
+	if !ok || !isHex(hex) {
+		return "", &ParseError{input, "expected 00:11:22:33:44:55, 00-11-22-33-44-55, 0011.2233.4455 or 001122334455"}
+	}
+
+	switch {
+	case hex == "000000000000":
+		return "", &ParseError{input, "all-zero address"}
+	case strings.ContainsAny(hex[1:2], "13579bdf"):
+		// Least significant bit of the first octet: group address (multicast, broadcast)
+		return "", &ParseError{input, "multicast address"}
+	}
+	return MAC(hex), nil
+}
+
+// joinGroups removes the separator of groups of size n, the separator must be the same everywhere
+func joinGroups(s, sep string, n int) (string, bool) {
+	if sep != ":" && sep != "-" && sep != "." {
+		return "", false
+	}
+	if (n == 2 && sep == ".") || (n == 4 && sep == ":") {
+		return "", false
+	}
+	groups := strings.Split(s, sep)
+	if len(groups)*n != 12 {
+		return "", false
+	}
+	for _, g := range groups {
+		if len(g) != n {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the address as stored for phones: 00:15:65:aa:bb:cc
+func (m MAC) String() string {
+	return Colon(string(m))
+}
+
+// Format renders the address in a vendor format (see Formats)
+func (m MAC) Format(format string) (string, error) {
+	s := string(m)
+	switch format {
+	case FormatPlain, "":
+		return s, nil
+	case FormatColon:
+		return Colon(s), nil
+	case FormatDash:
+		return strings.ReplaceAll(Colon(s), ":", "-"), nil
+	case FormatDot:
+		return s[0:4] + "." + s[4:8] + "." + s[8:12], nil
+	}
+	return "", fmt.Errorf("unknown MAC format %q (%s)", format, strings.Join(Formats, ", "))
+}
+
+// OUI returns the vendor prefix (the first three octets)
+func (m MAC) OUI() string {
+	return string(m)[:6]
+}
+
+// Vendor guesses the device vendor by the OUI, "" if unknown
+func (m MAC) Vendor() string {
+	return Vendor(string(m))
+}
@@ -0,0 +1,67 @@
+package macaddr
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"00:15:65:aa:bb:cc",
+		"00:15:65:AA:BB:CC",
+		"00-15-65-aa-bb-cc",
+		"0015.65aa.bbcc",
+		"0015-65AA-BBCC",
+		"001565AABBCC",
+		" 001565aabbcc ",
+	}
+	for _, s := range valid {
+		m, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", s, err)
+			continue
+		}
+		if m != "001565aabbcc" {
+			t.Errorf("Parse(%q) = %q", s, m)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"00:15:65:aa:bb",
+		"00:15:65-aa:bb:cc",   // mixed separators
+		"0015:65aa:bbcc",      // colon between groups of 4
+		"00.15.65.aa.bb.cc",   // dot between octets
+		"00:15:65:aa:bb:cg",   // not hex
+		"000000000000",        // all zero
+		"ff:ff:ff:ff:ff:ff",   // broadcast
+		"01:00:5e:00:00:01",   // multicast
+		"001565aabbcc001565a", // too long
+	}
+	for _, s := range invalid {
+		if m, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %q, want error", s, m)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	m := MAC("001565aabbcc")
+	want := map[string]string{
+		FormatPlain: "001565aabbcc",
+		FormatColon: "00:15:65:aa:bb:cc",
+		FormatDash:  "00-15-65-aa-bb-cc",
+		FormatDot:   "0015.65aa.bbcc",
+	}
+	for format, w := range want {
+		if got, err := m.Format(format); err != nil || got != w {
+			t.Errorf("Format(%s) = %q, %v; want %q", format, got, err, w)
+		}
+	}
+	if _, err := m.Format("cisco"); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if m.String() != "00:15:65:aa:bb:cc" || m.OUI() != "001565" || m.Vendor() != "yealink" {
+		t.Errorf("unexpected String/OUI/Vendor: %s %s %s", m, m.OUI(), m.Vendor())
+	}
+	if got := Plain("00:15:65:XX:BB:CC"); got != "001565XXBBCC" {
+		t.Errorf("Plain of an invalid MAC = %q", got)
+	}
+}
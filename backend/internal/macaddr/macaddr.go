@@ -0,0 +1,75 @@
+package macaddr
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	separatedRe = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{2}[:-]){5}[0-9a-f]{2}\b`)
+	plainRe     = regexp.MustCompile(`(?i)\b[0-9a-f]{12}\b`)
+	hexRunRe    = regexp.MustCompile(`(?i)[0-9a-f]+`)
+)
+
+// Prefixes some vendors put in front of the MAC in config file names
+// (Cisco "SEP001122334455.cnf.xml", "spa001122334455.xml", etc.)
+var filenamePrefixes = []string{"sep", "spa", "cfg", "mac"}
+
+// Normalize returns the canonical form of a MAC address (see Parse).
+// Returns an empty string if s is not a device MAC address.
+func Normalize(s string) string {
+	m, err := Parse(s)
+	if err != nil {
+		return ""
+	}
+	return string(m)
+}
+
+// Plain returns the canonical form of a stored MAC address for file names and templates.
+// Addresses that cannot be parsed (stored before validation) are only stripped of separators.
+func Plain(s string) string {
+	if m := Normalize(s); m != "" {
+		return m
+	}
+	return strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(s))
+}
+
+// Find returns the first MAC address found in free text (e.g. a User-Agent), normalized.
+func Find(s string) string {
+	if m := separatedRe.FindString(s); m != "" {
+		return Normalize(m)
+	}
+	if m := plainRe.FindString(s); m != "" {
+		return Normalize(m)
+	}
+	return ""
+}
+
+// FromFilename extracts a MAC address from a requested config file name
+// such as "/001565aabbcc.cfg" or "SEP001122334455.cnf.xml".
+// Generic files like "y000000000108.cfg" are not treated as MAC files.
+func FromFilename(p string) string {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(p, "\\", "/")))
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	for _, prefix := range filenamePrefixes {
+		if strings.HasPrefix(base, prefix) && len(base) >= len(prefix)+12 {
+			base = strings.TrimPrefix(base, prefix)
+			break
+		}
+	}
+
+	for _, run := range hexRunRe.FindAllString(base, -1) {
+		if len(run) != 12 {
+			continue
+		}
+		// 000000xxxxxx is used by vendors for model-wide files, not devices
+		if strings.HasPrefix(run, "000000") {
+			continue
+		}
+		return run
+	}
+	return ""
+}
@@ -0,0 +1,18 @@
+package macaddr
+
+import "testing"
+
+func TestFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"/001565aabbcc.cfg":        "001565aabbcc",
+		"/SEP0011223344AA.cnf.xml": "0011223344aa",
+		"/spa001122aabbcc.xml":     "001122aabbcc",
+		"/y000000000108.cfg":       "",
+		"/directory.xml":           "",
+	}
+	for in, want := range tests {
+		if got := FromFilename(in); got != want {
+			t.Errorf("FromFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package macaddr
+
+// Known OUI prefixes of IP phone vendors -> vendor ID (as in vendors/<id>/vendor.yaml)
+var ouiVendors = map[string]string{
+	// Yealink
+	"001565": "yealink",
+	"805ec0": "yealink",
+	"805e0c": "yealink",
+	"249ad8": "yealink",
+	"44dbd2": "yealink",
+	// Cisco / Linksys / Sipura (SPA)
+	"000e08": "cisco",
+	"e8edf3": "cisco",
+	"c89c1d": "cisco",
+	"0018b9": "cisco",
+	"001d45": "cisco",
+	"5475d0": "cisco",
+	// Grandstream
+	"000b82": "grandstream",
+	"c074ad": "grandstream",
+	"ec74d7": "grandstream",
+	// Polycom
+	"0004f2": "polycom",
+	"64167f": "polycom",
+	// Snom
+	"000413": "snom",
+	// Mitel / Aastra
+	"00085d": "mitel",
+	"08000f": "mitel",
+	// Fanvil
+	"0c383e": "fanvil",
+	// Eltex
+	"a8f94b": "eltex",
+	"e0d9e3": "eltex",
+	"e4c0e2": "eltex",
+	// Yeastar
+	"f4b549": "yeastar",
+}
+
+// Vendor guesses the device vendor by the OUI of a normalized MAC. Returns "" if unknown.
+func Vendor(mac string) string {
+	if len(mac) < 6 {
+		return ""
+	}
+	return ouiVendors[mac[:6]]
+}
+
+// Colon formats a normalized MAC as "00:15:65:aa:bb:cc"
+func Colon(mac string) string {
+	if len(mac) != 12 {
+		return mac
+	}
+	return mac[0:2] + ":" + mac[2:4] + ":" + mac[4:6] + ":" + mac[6:8] + ":" + mac[8:10] + ":" + mac[10:12]
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// DeviceAccessLog — запись журнала обращений устройств (HTTP/TFTP)
+type DeviceAccessLog struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Time          time.Time `gorm:"index" json:"time"`
+	SourceIP      string    `gorm:"index" json:"source_ip"`
+	MacAddress    string    `gorm:"index" json:"mac_address"` // Normalized, from file name or User-Agent
+	StatusCode    int       `gorm:"index" json:"status_code"`
+	Method        string    `json:"method"`
+	RequestedFile string    `json:"requested_file"`
+	UserAgent     string    `json:"user_agent"`
+	Message       string    `json:"message,omitempty"`
+}
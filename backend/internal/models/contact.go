@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Phonebook — телефонная книга внешних контактов домена или общая для всех доменов (Domain пустой).
+// Вместе с внутренними номерами домена (телефоны и SIP-аккаунты) попадает в файлы directory/ вендоров.
+type Phonebook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name        string    `gorm:"uniqueIndex:idx_phonebooks_domain_name" json:"name"`
+	Domain      string    `gorm:"uniqueIndex:idx_phonebooks_domain_name" json:"domain"` // Empty - shared by all domains
+	Description string    `json:"description"`
+	Contacts    []Contact `gorm:"foreignKey:PhonebookID" json:"contacts,omitempty"`
+}
+
+// Contact — внешний контакт телефонной книги (поставщик, филиал, мобильный сотрудника и т.п.)
+type Contact struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PhonebookID uint            `gorm:"index" json:"phonebook_id"`
+	Name        string          `gorm:"index" json:"name"` // Display name, "first_name last_name" if empty
+	FirstName   string          `json:"first_name"`
+	LastName    string          `json:"last_name"`
+	Company     string          `json:"company"`
+	Title       string          `json:"title"`
+	Email       string          `json:"email"`
+	Numbers     []ContactNumber `gorm:"serializer:json" json:"numbers"`
+	Groups      []string        `gorm:"serializer:json" json:"groups"`
+	Note        string          `json:"note"`
+}
+
+// Contact number types
+const (
+	NumberWork   = "work"
+	NumberMobile = "mobile"
+	NumberHome   = "home"
+	NumberFax    = "fax"
+	NumberOther  = "other"
+)
+
+// ContactNumberTypes lists the valid ContactNumber.Type values
+var ContactNumberTypes = []string{NumberWork, NumberMobile, NumberHome, NumberFax, NumberOther}
+
+// ContactNumber — номер контакта
+type ContactNumber struct {
+	Type   string `json:"type"` // work, mobile, home, fax, other
+	Number string `json:"number"`
+}
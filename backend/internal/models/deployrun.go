@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// Deploy run actions: which hooks of the domain were executed
+const (
+	DeployActionDeploy = "deploy"
+	DeployActionDelete = "delete"
+)
+
+// Deploy run triggers
+const (
+	TriggerPhoneCreate = "phone_create"
+	TriggerPhoneUpdate = "phone_update"
+	TriggerPhoneDelete = "phone_delete"
+	TriggerManual      = "manual"
+	TriggerRetry       = "retry"
+	TriggerProfile     = "profile_update"
+	TriggerPassword    = "password_rotate"
+	TriggerFirmware    = "firmware_policy"
+	TriggerMAC         = "mac_canonicalize"
+)
+
+// DeployRun — одно выполнение deploy/delete хуков домена (синхронизация целей + команды)
+type DeployRun struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Domain   string `gorm:"index" json:"domain"`
+	Action   string `json:"action"`             // deploy, delete
+	Trigger  string `json:"trigger"`            // phone_create, phone_update, phone_delete, manual, retry, profile_update, password_rotate, firmware_policy, mac_canonicalize
+	RetryOf  *uint  `json:"retry_of,omitempty"` // Run this one retries
+	Triggers int    `json:"triggers,omitempty"` // Queued deploys: number of phone changes coalesced into this run
+
+	// Phone the run was triggered for (empty for domain-wide deploys). MAC and number are kept for deleted phones.
+	PhoneID     *uint  `gorm:"index" json:"phone_id,omitempty"`
+	PhoneMAC    string `json:"phone_mac,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+
+	Success    bool     `gorm:"index" json:"success"`
+	Commands   []string `gorm:"serializer:json" json:"commands"` // Rendered commands
+	ExitCode   int      `json:"exit_code"`                       // Of the last executed command (-1 - not started, timeout or target failure)
+	Output     string   `json:"output"`                          // Combined stdout/stderr of all commands
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+	Result     string   `json:"-"` // Full deploy.Result as JSON (per target and per command details)
+}
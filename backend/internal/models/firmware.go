@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// Firmware — файл прошивки в репозитории (firmware/<vendor>/<file_name>)
+type Firmware struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Vendor   string   `gorm:"uniqueIndex:idx_firmware_file" json:"vendor"`
+	FileName string   `gorm:"uniqueIndex:idx_firmware_file" json:"file_name"`
+	Version  string   `json:"version"`
+	Models   []string `gorm:"serializer:json" json:"models"` // Applicable model ids. Empty - any model of the vendor
+	Size     int64    `json:"size"`
+	SHA256   string   `json:"sha256"`
+	Notes    string   `json:"notes"`
+}
+
+// AppliesTo reports whether the firmware can be installed on the model
+func (f Firmware) AppliesTo(modelID string) bool {
+	if len(f.Models) == 0 {
+		return true
+	}
+	for _, m := range f.Models {
+		if m == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+// FirmwarePolicy — целевая прошивка для домена и/или модели с поэтапным развертыванием.
+// Телефоны вне текущего этапа получают PreviousFirmware (если задана) или не получают прошивку вовсе.
+type FirmwarePolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Domain  string `gorm:"uniqueIndex:idx_firmware_policy_scope" json:"domain"` // Empty - all domains
+	Vendor  string `gorm:"uniqueIndex:idx_firmware_policy_scope" json:"vendor"`
+	ModelID string `gorm:"uniqueIndex:idx_firmware_policy_scope" json:"model_id"` // Empty - all models of the vendor
+
+	FirmwareID         uint      `json:"firmware_id"`
+	Firmware           *Firmware `json:"firmware,omitempty"`
+	PreviousFirmwareID *uint     `json:"previous_firmware_id"`
+	PreviousFirmware   *Firmware `json:"previous_firmware,omitempty"`
+
+	RolloutPercent int    `json:"rollout_percent"`                  // Share of phones (0-100) that get the target firmware
+	PhoneIDs       []uint `gorm:"serializer:json" json:"phone_ids"` // These phones get the target firmware regardless of the percentage
+	Enabled        bool   `json:"enabled"`
+}
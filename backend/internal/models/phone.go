@@ -9,17 +9,38 @@ type Phone struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
-	Domain                string      `gorm:"index" json:"domain"`
-	Vendor                string      `json:"vendor"`
-	ModelID               string      `json:"model_id"` // ID модели телефона (например, "yealink-t46s")
-	ExpansionModulesCount int         `json:"expansion_modules_count"`
-	ExpansionModuleModel  string      `json:"expansion_module_model"` // Модель модуля расширения (например, "M680")
-	Type                  string      `json:"type"`                   // "phone" or "gateway"
-	MacAddress            *string     `gorm:"uniqueIndex" json:"mac_address"`
-	PhoneNumber           *string     `gorm:"uniqueIndex" json:"phone_number"` // Used for search
-	IPAddress             string      `json:"ip_address"`
-	Description           string      `json:"description"`
-	ModelName             string      `gorm:"-" json:"model_name"`
-	VendorName            string      `gorm:"-" json:"vendor_name"`
-	Lines                 []PhoneLine `gorm:"foreignKey:PhoneID" json:"lines"`
+	Domain                string  `gorm:"index;uniqueIndex:idx_phones_domain_number,priority:1" json:"domain"`
+	Vendor                string  `json:"vendor"`
+	ModelID               string  `json:"model_id"` // ID модели телефона (например, "yealink-t46s")
+	ExpansionModulesCount int     `json:"expansion_modules_count"`
+	ExpansionModuleModel  string  `json:"expansion_module_model"` // Модель модуля расширения (например, "M680")
+	Type                  string  `json:"type"`                   // "phone" or "gateway"
+	MacAddress            *string `gorm:"uniqueIndex" json:"mac_address"`
+	PhoneNumber           *string `gorm:"uniqueIndex:idx_phones_domain_number,priority:2" json:"phone_number"` // Unique within the domain, used for search
+	IPAddress             string  `json:"ip_address"`
+	Description           string  `json:"description"`
+
+	// Check-in tracking (filled from device requests over HTTP/TFTP)
+	LastSeenAt      *time.Time `gorm:"index" json:"last_seen_at"`
+	LastSeenIP      string     `json:"last_seen_ip"`
+	ReportedModel   string     `json:"reported_model"`
+	FirmwareVersion string     `json:"firmware_version"`
+	LastServedFile  string     `json:"last_served_file"`
+
+	// Профиль: кнопки, функции и переменные, наследуемые телефоном
+	ProfileID *uint    `gorm:"index" json:"profile_id"`
+	Profile   *Profile `json:"profile,omitempty"`
+
+	// Переменные шаблонов телефона, переопределяют переменные всех остальных уровней (см. internal/variables)
+	Variables map[string]string `gorm:"serializer:json" json:"variables"`
+	// Настройки, не описанные в features.yaml: добавляются в конфиг телефона (см. raw_config в vendor.yaml)
+	RawConfig string `json:"raw_config"`
+
+	ModelName  string      `gorm:"-" json:"model_name"`
+	VendorName string      `gorm:"-" json:"vendor_name"`
+	Lines      []PhoneLine `gorm:"foreignKey:PhoneID" json:"lines"`
 }
+
+// CheckInFields are the Phone fields written by the check-in tracker only.
+// Saves of a whole phone loaded earlier must omit them to not overwrite a newer check-in.
+var CheckInFields = []string{"LastSeenAt", "LastSeenIP", "ReportedModel", "FirmwareVersion", "LastServedFile"}
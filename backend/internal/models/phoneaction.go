@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// PhoneActionLog — удаленное действие с телефоном (resync, reboot, действия вендора) и его результат
+type PhoneActionLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	PhoneID    uint   `gorm:"index" json:"phone_id"`
+	Domain     string `gorm:"index" json:"domain"`
+	Action     string `json:"action"`  // resync, reboot or the id of a vendor remote action
+	Method     string `json:"method"`  // sip-notify, http
+	Address    string `json:"address"` // host:port of the NOTIFY, URL of the HTTP action
+	Event      string `json:"event,omitempty"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code,omitempty"` // SIP or HTTP response code
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Profile — шаблон телефона (например, "Ресепшн T46 с 2x EXP"): раскладка кнопок, общие функции
+// и переопределения переменных домена. Телефоны профиля наследуют его настройки и могут переопределять отдельные кнопки.
+type Profile struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name                  string            `gorm:"uniqueIndex" json:"name"`
+	Description           string            `json:"description"`
+	Vendor                string            `json:"vendor"`
+	ModelID               string            `json:"model_id"` // Empty - any model of the vendor
+	ExpansionModulesCount int               `json:"expansion_modules_count"`
+	ExpansionModuleModel  string            `json:"expansion_module_model"`
+	Variables             map[string]string `gorm:"serializer:json" json:"variables"` // Group level, see internal/variables
+	Lines                 []ProfileLine     `gorm:"foreignKey:ProfileID" json:"lines"`
+}
+
+// ProfileLine — назначение кнопки или общая функция профиля, по формату совпадает с PhoneLine
+type ProfileLine struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ProfileID      uint   `gorm:"index" json:"profile_id"`
+	Type           string `json:"type"`
+	KeyNumber      *int   `json:"key_number"`
+	PanelNumber    *int   `json:"panel_number"`
+	AccountNumber  int    `json:"account_number"`
+	AdditionalInfo string `json:"additional_info"` // JSON string
+}
+
+// PreloadPhone loads what is needed to generate the config of a phone: its lines and its profile
+func PreloadPhone(db *gorm.DB) *gorm.DB {
+	return db.Preload("Lines").Preload("Profile.Lines")
+}
+
+// ApplyProfile returns the phone with the settings inherited from its profile (Profile must be loaded):
+//   - profile keys the phone does not assign itself;
+//   - profile general features of types the phone does not set, profile accounts the phone does not have;
+//   - the expansion modules of the profile if the phone has none.
+func (p Phone) ApplyProfile() Phone {
+	if p.Profile == nil {
+		return p
+	}
+	profile := p.Profile
+
+	if p.ExpansionModulesCount == 0 && p.ExpansionModuleModel == "" {
+		p.ExpansionModulesCount = profile.ExpansionModulesCount
+		p.ExpansionModuleModel = profile.ExpansionModuleModel
+	}
+
+	keys := make(map[string]bool)
+	generalTypes := make(map[string]bool)
+	accounts := make(map[int]bool)
+	for _, l := range p.Lines {
+		switch {
+		case l.PanelNumber != nil && l.KeyNumber != nil:
+			keys[fmt.Sprintf("%d-%d", *l.PanelNumber, *l.KeyNumber)] = true
+		case l.Type == "Line":
+			accounts[l.AccountNumber] = true
+		default:
+			generalTypes[l.Type] = true
+		}
+	}
+
+	lines := append([]PhoneLine(nil), p.Lines...)
+	for _, pl := range profile.Lines {
+		switch {
+		case pl.PanelNumber != nil && pl.KeyNumber != nil:
+			if keys[fmt.Sprintf("%d-%d", *pl.PanelNumber, *pl.KeyNumber)] {
+				continue
+			}
+		case pl.Type == "Line":
+			if accounts[pl.AccountNumber] {
+				continue
+			}
+		default:
+			if generalTypes[pl.Type] {
+				continue
+			}
+		}
+		lines = append(lines, PhoneLine{
+			PhoneID:        p.ID,
+			Type:           pl.Type,
+			KeyNumber:      pl.KeyNumber,
+			PanelNumber:    pl.PanelNumber,
+			AccountNumber:  pl.AccountNumber,
+			AdditionalInfo: pl.AdditionalInfo,
+		})
+	}
+	p.Lines = lines
+	return p
+}
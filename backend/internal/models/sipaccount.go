@@ -0,0 +1,252 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SIPAccount — SIP учетная запись телефона в типизированном виде: поиск телефонов по логину/номеру
+// и уникальность логинов в пределах домена. Записывается из линий (Type == "Line") в той же транзакции,
+// что и сами линии; учетные записи, унаследованные от профиля, тоже (с ProfileID). Параметры конкретного
+// вендора остаются в AdditionalInfo линии.
+type SIPAccount struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PhoneID       uint   `gorm:"index" json:"phone_id"`
+	PhoneLineID   uint   `gorm:"index" json:"phone_line_id"`
+	ProfileID     *uint  `gorm:"index" json:"profile_id,omitempty"` // Set for accounts inherited from the profile (PhoneLineID is 0)
+	Domain        string `gorm:"uniqueIndex:idx_sip_accounts_domain_own_user,where:user_name <> '' AND profile_id IS NULL" json:"domain"`
+	AccountNumber int    `json:"account_number"`
+	UserName      string `gorm:"uniqueIndex:idx_sip_accounts_domain_own_user,where:user_name <> '' AND profile_id IS NULL" json:"user_name"`
+	AuthName      string `gorm:"index" json:"auth_name"`
+	Password      string `json:"-"` // Encrypted like the line (enc:v1:...), never returned by the API, masked in support bundles
+	DisplayName   string `json:"display_name"`
+	Server        string `gorm:"index" json:"server"` // Registrar host[:port], empty - domain default
+	Transport     string `json:"transport"`           // udp, tcp, tls. Empty - vendor default
+
+	Phone *Phone `gorm:"foreignKey:PhoneID" json:"phone,omitempty"`
+}
+
+func (SIPAccount) TableName() string {
+	return "sip_accounts"
+}
+
+// Keys of AdditionalInfo the typed fields are taken from (the first non-empty one).
+// Nested params (e.g. yealink custom_sip_server.registrar_ip) are searched too.
+var (
+	accountUserKeys      = []string{"user_name", "username", "user"}
+	accountAuthKeys      = []string{"auth_name", "auth_user", "auth_id"}
+	accountDisplayKeys   = []string{"display_name", "screen_name", "label"}
+	accountServerKeys    = []string{"server", "sip_server", "registrar", "registrar_ip"}
+	accountPortKeys      = []string{"registrar_port", "server_port", "port"}
+	accountTransportKeys = []string{"transport"}
+)
+
+// SIPAccountFromLine builds the account of an account line, false for other lines
+func SIPAccountFromLine(phone *Phone, l PhoneLine) (SIPAccount, bool) {
+	if l.Type != "Line" {
+		return SIPAccount{}, false
+	}
+	info := l.GetAdditionalInfoMap()
+	account := SIPAccount{
+		PhoneID:       phone.ID,
+		PhoneLineID:   l.ID,
+		Domain:        phone.Domain,
+		AccountNumber: l.AccountNumber,
+		UserName:      infoString(info, accountUserKeys),
+		AuthName:      infoString(info, accountAuthKeys),
+		Password:      infoString(info, []string{"password"}),
+		DisplayName:   infoString(info, accountDisplayKeys),
+		Server:        infoString(info, accountServerKeys),
+		Transport:     strings.ToLower(infoString(info, accountTransportKeys)),
+	}
+	if port := infoString(info, accountPortKeys); account.Server != "" && port != "" && !strings.Contains(account.Server, ":") {
+		account.Server += ":" + port
+	}
+	return account, true
+}
+
+func infoString(info map[string]interface{}, keys []string) string {
+	for _, k := range keys {
+		if s := scalarString(info[k]); s != "" {
+			return s
+		}
+	}
+	for _, v := range info {
+		if nested, ok := v.(map[string]interface{}); ok {
+			if s := infoString(nested, keys); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func scalarString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case json.Number:
+		return t.String()
+	case float64, int, bool:
+		return fmt.Sprint(t)
+	}
+	return ""
+}
+
+// SIPAccountConflict — логин SIP уже используется другой линией домена
+type SIPAccountConflict struct {
+	LinePhoneID   uint  // Phone of the conflicting line
+	Line          int   // Index in Phone.Lines, -1 for an account inherited from the profile
+	ProfileID     *uint // Profile the conflicting account is inherited from
+	AccountNumber int
+	UserName      string
+	Domain        string
+	PhoneID       uint // Phone that already uses the account (the same phone for duplicate lines)
+}
+
+func (e *SIPAccountConflict) Error() string {
+	if e.ProfileID != nil {
+		return fmt.Sprintf("SIP user %s of profile %d is already used in domain %s by phone %d", e.UserName, *e.ProfileID, e.Domain, e.PhoneID)
+	}
+	return fmt.Sprintf("SIP user %s is already used in domain %s by phone %d", e.UserName, e.Domain, e.PhoneID)
+}
+
+// FindSIPAccountConflicts returns the accounts of the phone whose user name is already used in the domain
+// by another phone or by another account of the phone. Accounts inherited from the profile (Profile must be
+// loaded to check them) are shared by its phones: they conflict only with the accounts of other phones
+// that are not inherited from the same profile.
+func FindSIPAccountConflicts(db *gorm.DB, phone *Phone) ([]SIPAccountConflict, error) {
+	var conflicts []SIPAccountConflict
+	seen := make(map[string]bool)
+	for i, l := range phone.ApplyProfile().Lines {
+		account, ok := SIPAccountFromLine(phone, l)
+		if !ok || account.UserName == "" {
+			continue
+		}
+		conflict := SIPAccountConflict{LinePhoneID: phone.ID, Line: i, AccountNumber: l.AccountNumber, UserName: account.UserName, Domain: phone.Domain, PhoneID: phone.ID}
+		query := db.Where("domain = ? AND user_name = ? AND phone_id <> ?", phone.Domain, account.UserName, phone.ID)
+		if i >= len(phone.Lines) { // Appended by ApplyProfile
+			profileID := phone.Profile.ID
+			conflict.Line = -1
+			conflict.ProfileID = &profileID
+			query = query.Where("(profile_id IS NULL OR profile_id <> ?)", profileID)
+		}
+		if seen[account.UserName] {
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		seen[account.UserName] = true
+
+		var existing []SIPAccount
+		if err := query.Limit(1).Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			conflict.PhoneID = existing[0].PhoneID
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// phoneSIPAccounts returns the accounts of the phone lines and of the account lines the phone inherits
+// from its profile (Profile must be loaded, see PreloadPhone)
+func phoneSIPAccounts(phone *Phone) []SIPAccount {
+	var accounts []SIPAccount
+	for i, l := range phone.ApplyProfile().Lines {
+		account, ok := SIPAccountFromLine(phone, l)
+		if !ok {
+			continue
+		}
+		if i >= len(phone.Lines) { // Appended by ApplyProfile
+			account.ProfileID = phone.ProfileID
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// SyncSIPAccounts replaces the accounts of the phone with the ones of its lines (saved, with IDs) and of its
+// profile, which is loaded if it is not yet. Call it in the transaction that saves the lines.
+// Returns a *SIPAccountConflict if a user name is already used in the domain.
+func SyncSIPAccounts(db *gorm.DB, phone *Phone) error {
+	if phone.ProfileID != nil && phone.Profile == nil {
+		var profile Profile
+		if err := db.Preload("Lines").First(&profile, *phone.ProfileID).Error; err != nil {
+			return err
+		}
+		phone.Profile = &profile
+	}
+	conflicts, err := FindSIPAccountConflicts(db, phone)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &conflicts[0]
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("phone_id = ?", phone.ID).Delete(&SIPAccount{}).Error; err != nil {
+			return err
+		}
+		for _, account := range phoneSIPAccounts(phone) {
+			if err := tx.Create(&account).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RebuildSIPAccounts builds the accounts of all phones from their lines and profiles (existing data, lines changed
+// outside the API). Accounts whose user name is already used in the domain are skipped and returned.
+func RebuildSIPAccounts(db *gorm.DB) (int, []SIPAccountConflict, error) {
+	var phones []Phone
+	if err := PreloadPhone(db).Order("id").Find(&phones).Error; err != nil {
+		return 0, nil, err
+	}
+
+	created := 0
+	var skipped []SIPAccountConflict
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&SIPAccount{}).Error; err != nil {
+			return err
+		}
+		used := make(map[string]uint) // domain + user name -> phone
+		for i := range phones {
+			phone := &phones[i]
+			for _, account := range phoneSIPAccounts(phone) {
+				if account.UserName != "" && account.ProfileID == nil {
+					key := account.Domain + "\x00" + account.UserName
+					if owner, dup := used[key]; dup {
+						skipped = append(skipped, SIPAccountConflict{LinePhoneID: phone.ID, Line: phoneLineIndex(phone, account.PhoneLineID), UserName: account.UserName, Domain: account.Domain, PhoneID: owner})
+						continue
+					}
+					used[key] = phone.ID
+				}
+				if err := tx.Create(&account).Error; err != nil {
+					return err
+				}
+				created++
+			}
+		}
+		return nil
+	})
+	return created, skipped, err
+}
+
+// phoneLineIndex returns the index of the line in Phone.Lines, -1 if it is not there
+func phoneLineIndex(phone *Phone, lineID uint) int {
+	for i, l := range phone.Lines {
+		if l.ID == lineID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// UnprovisionedDevice — устройство, запросившее конфиг по MAC, которого нет в базе.
+// Запись можно "забрать" (claim) через API в полноценный Phone.
+type UnprovisionedDevice struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	MacAddress    string    `gorm:"uniqueIndex" json:"mac_address"` // Normalized (12 hex)
+	Vendor        string    `json:"vendor"`                         // Guessed from User-Agent or OUI
+	Model         string    `json:"model"`                          // From User-Agent
+	Firmware      string    `json:"firmware"`
+	IPAddress     string    `json:"ip_address"`
+	UserAgent     string    `json:"user_agent"`
+	RequestedFile string    `json:"requested_file"`
+	RequestCount  int       `json:"request_count"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `gorm:"index" json:"last_seen"`
+}
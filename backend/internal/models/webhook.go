@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook — подписка внешней системы (АТС, тикет-система) на события
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Events  []string `gorm:"serializer:json" json:"events"` // Event types, prefix wildcards allowed ("phone.*"). Empty - all except device.access and device.fetch_failed
+	Domain  string   `json:"domain"`                        // Only events of this domain (empty - any)
+	Secret  string   `json:"secret,omitempty"`              // HMAC-SHA256 key for X-Provisioning-Signature
+	Enabled bool     `json:"enabled"`
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery — попытка доставки одного события в один webhook
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	WebhookID     uint       `gorm:"index" json:"webhook_id"`
+	EventID       uint64     `json:"event_id"`
+	EventType     string     `gorm:"index" json:"event_type"`
+	Payload       string     `json:"payload"`
+	Status        string     `gorm:"index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	ResponseCode  int        `json:"response_code"`
+	ResponseBody  string     `json:"response_body"` // Truncated
+	Error         string     `json:"error,omitempty"`
+}
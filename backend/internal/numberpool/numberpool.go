@@ -0,0 +1,228 @@
+// Package numberpool manages the extension ranges of a domain (number_pool): next free number,
+// reservations, exclusions and the used/free report.
+package numberpool
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is the number_pool of a domain: ranges of internal numbers assigned automatically.
+// Ranges are "200-299" or a single number "5000".
+type Config struct {
+	Start    int      `yaml:"start" json:"start"`
+	End      int      `yaml:"end" json:"end"`
+	Ranges   []string `yaml:"ranges" json:"ranges"`     // Additional ranges
+	Reserved []string `yaml:"reserved" json:"reserved"` // Not allocated automatically, can be assigned explicitly
+	Excluded []string `yaml:"excluded" json:"excluded"` // Never assigned to phones of the domain (service, emergency numbers)
+}
+
+// Range is an inclusive range of numbers
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func (r Range) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+func (r Range) contains(n int) bool {
+	return n >= r.Start && n <= r.End
+}
+
+// MaxSize caps the numbers of a pool: the next free number and the report walk all of them
+const MaxSize = 100000
+
+// Pool is the parsed number_pool of a domain
+type Pool struct {
+	Ranges   []Range `json:"ranges"`
+	Reserved []Range `json:"reserved"` // Not allocated automatically, can be assigned explicitly
+	Excluded []Range `json:"excluded"` // Never assigned
+}
+
+// New parses the number_pool of a domain. Ranges are "200-299" or a single "5000".
+func New(cfg Config) (*Pool, error) {
+	p := &Pool{}
+	if cfg.Start != 0 || cfg.End != 0 {
+		if cfg.End < cfg.Start {
+			return nil, fmt.Errorf("end %d is less than start %d", cfg.End, cfg.Start)
+		}
+		p.Ranges = append(p.Ranges, Range{cfg.Start, cfg.End})
+	}
+	var err error
+	if p.Ranges, err = appendRanges(p.Ranges, cfg.Ranges, "ranges"); err != nil {
+		return nil, err
+	}
+	if p.Reserved, err = appendRanges(nil, cfg.Reserved, "reserved"); err != nil {
+		return nil, err
+	}
+	if p.Excluded, err = appendRanges(nil, cfg.Excluded, "excluded"); err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, r := range p.Ranges {
+		if r.End-r.Start+1 > MaxSize-size {
+			return nil, fmt.Errorf("more than %d numbers", MaxSize)
+		}
+		size += r.End - r.Start + 1
+	}
+	sort.Slice(p.Ranges, func(i, j int) bool { return p.Ranges[i].Start < p.Ranges[j].Start })
+	return p, nil
+}
+
+func appendRanges(ranges []Range, values []string, field string) ([]Range, error) {
+	for _, v := range values {
+		r, err := ParseRange(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// ParseRange parses "200-299" or "5000"
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	start, end, found := strings.Cut(s, "-")
+	a, err := strconv.Atoi(strings.TrimSpace(start))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	b := a
+	if found {
+		if b, err = strconv.Atoi(strings.TrimSpace(end)); err != nil || b < a {
+			return Range{}, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	return Range{a, b}, nil
+}
+
+// number returns the numeric value of an extension. Numbers with leading zeros, prefixes etc. are never in a pool.
+func number(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || strconv.Itoa(n) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+func inRanges(ranges []Range, s string) bool {
+	n, ok := number(s)
+	if !ok {
+		return false
+	}
+	for _, r := range ranges {
+		if r.contains(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Configured reports whether the pool has any range
+func (p *Pool) Configured() bool {
+	return p != nil && len(p.Ranges) > 0
+}
+
+// Contains reports whether the number belongs to a range of the pool
+func (p *Pool) Contains(s string) bool {
+	return p != nil && inRanges(p.Ranges, s)
+}
+
+func (p *Pool) IsReserved(s string) bool {
+	return p != nil && inRanges(p.Reserved, s)
+}
+
+func (p *Pool) IsExcluded(s string) bool {
+	return p != nil && inRanges(p.Excluded, s)
+}
+
+// Next returns the lowest number of the pool that is not used, reserved or excluded
+func (p *Pool) Next(used map[string]bool) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	for _, r := range p.Ranges {
+		for n := r.Start; n <= r.End; n++ {
+			s := strconv.Itoa(n)
+			if !used[s] && !p.IsReserved(s) && !p.IsExcluded(s) {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Summary counts the numbers of the pool by status
+type Summary struct {
+	Total      int      `json:"total"`
+	Used       int      `json:"used"`
+	Free       int      `json:"free"`
+	Reserved   int      `json:"reserved"` // Not used
+	Excluded   int      `json:"excluded"`
+	FreeRanges []string `json:"free_ranges"`
+}
+
+// Summarize counts the numbers of the pool, numbers used by phones are never counted as free
+func (p *Pool) Summarize(used map[string]bool) Summary {
+	s := Summary{FreeRanges: []string{}}
+	seen := make(map[int]bool)
+	var free *Range
+	flush := func() {
+		if free != nil {
+			s.FreeRanges = append(s.FreeRanges, free.String())
+			free = nil
+		}
+	}
+	for _, r := range p.Ranges {
+		for n := r.Start; n <= r.End; n++ {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			s.Total++
+			num := strconv.Itoa(n)
+			switch {
+			case used[num]:
+				s.Used++
+			case p.IsExcluded(num):
+				s.Excluded++
+			case p.IsReserved(num):
+				s.Reserved++
+			default:
+				s.Free++
+				if free != nil && free.End == n-1 {
+					free.End = n
+					continue
+				}
+				flush()
+				free = &Range{n, n}
+				continue
+			}
+			flush()
+		}
+		flush()
+	}
+	return s
+}
+
+// Overlaps returns the parts of the pool ranges that are also in the other pool
+func (p *Pool) Overlaps(other *Pool) []Range {
+	var overlaps []Range
+	for _, a := range p.Ranges {
+		for _, b := range other.Ranges {
+			start, end := max(a.Start, b.Start), min(a.End, b.End)
+			if start <= end {
+				overlaps = append(overlaps, Range{start, end})
+			}
+		}
+	}
+	return overlaps
+}
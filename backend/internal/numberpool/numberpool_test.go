@@ -0,0 +1,56 @@
+package numberpool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	pool, err := New(Config{
+		Start:    100,
+		End:      109,
+		Ranges:   []string{"200-202"},
+		Reserved: []string{"100", "105-106"},
+		Excluded: []string{"102"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[string]bool{"101": true, "103": true}
+	if next, ok := pool.Next(used); !ok || next != "104" {
+		t.Errorf("next: got %q", next)
+	}
+	if !pool.Contains("201") || pool.Contains("0101") || pool.Contains("150") || pool.Contains("abc") {
+		t.Error("unexpected Contains result")
+	}
+
+	got := pool.Summarize(used)
+	want := Summary{Total: 13, Used: 2, Free: 7, Reserved: 3, Excluded: 1, FreeRanges: []string{"104", "107-109", "200-202"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summary:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	full := map[string]bool{}
+	for _, n := range []string{"101", "103", "104", "107", "108", "109", "200", "201", "202"} {
+		full[n] = true
+	}
+	if next, ok := pool.Next(full); ok {
+		t.Errorf("exhausted pool returned %q", next)
+	}
+
+	other, _ := New(Config{Ranges: []string{"105-150", "202"}})
+	if o := pool.Overlaps(other); !reflect.DeepEqual(o, []Range{{105, 109}, {202, 202}}) {
+		t.Errorf("overlaps: %v", o)
+	}
+
+	if _, err := New(Config{Ranges: []string{"300-200"}}); err == nil {
+		t.Error("invalid range accepted")
+	}
+	if _, err := New(Config{Start: 1, End: MaxSize, Ranges: []string{"5000000"}}); err == nil {
+		t.Error("pool over MaxSize accepted")
+	}
+	if _, err := New(Config{Ranges: []string{"0-9223372036854775806"}}); err == nil {
+		t.Error("huge range accepted")
+	}
+}
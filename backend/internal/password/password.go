@@ -0,0 +1,147 @@
+// Package password generates SIP passwords with crypto/rand and checks entered passwords
+// against the password policy of the domain.
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"provisioning-system/internal/config"
+)
+
+// Character classes of config.PasswordPolicy.Classes
+const (
+	ClassLower   = "lower"
+	ClassUpper   = "upper"
+	ClassDigits  = "digits"
+	ClassSymbols = "symbols"
+)
+
+// DefaultLength is used when the policy does not set a length
+const DefaultLength = 12
+
+var charsets = map[string]string{
+	ClassLower:  "abcdefghijklmnopqrstuvwxyz",
+	ClassUpper:  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	ClassDigits: "0123456789",
+	// No quotes, spaces, '$', '&', '<', '>', ';': they break configs and shell deploy commands
+	ClassSymbols: "!#%*+-.:=?@_",
+}
+
+// Look-alike characters, hard to read from a label and to type on a phone keypad
+const ambiguous = "0O1lI|"
+
+var defaultClasses = []string{ClassLower, ClassUpper, ClassDigits}
+
+// Classes returns the character classes of the policy, lower/upper/digits by default. Unknown classes are ignored.
+func Classes(p config.PasswordPolicy) []string {
+	var classes []string
+	for _, c := range p.Classes {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if _, ok := charsets[c]; ok && !contains(classes, c) {
+			classes = append(classes, c)
+		}
+	}
+	if len(classes) == 0 {
+		return defaultClasses
+	}
+	return classes
+}
+
+func length(p config.PasswordPolicy) int {
+	if p.Length <= 0 {
+		return DefaultLength
+	}
+	return p.Length
+}
+
+func charset(class string, p config.PasswordPolicy) string {
+	set := charsets[class]
+	if !p.ExcludeAmbiguous {
+		return set
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(ambiguous, r) {
+			return -1
+		}
+		return r
+	}, set)
+}
+
+// Generate returns a random password of the policy length with at least one character of every class
+func Generate(p config.PasswordPolicy) (string, error) {
+	classes := Classes(p)
+	n := max(length(p), len(classes))
+
+	all := ""
+	b := make([]byte, 0, n)
+	for _, c := range classes {
+		set := charset(c, p)
+		all += set
+		ch, err := pick(set)
+		if err != nil {
+			return "", err
+		}
+		b = append(b, ch)
+	}
+	for len(b) < n {
+		ch, err := pick(all)
+		if err != nil {
+			return "", err
+		}
+		b = append(b, ch)
+	}
+
+	// The required characters must not always be at the start
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		b[i], b[j.Int64()] = b[j.Int64()], b[i]
+	}
+	return string(b), nil
+}
+
+func pick(set string) (byte, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[i.Int64()], nil
+}
+
+// Check returns the problems of an entered password, nil if it matches the policy
+func Check(p config.PasswordPolicy, pwd string) []string {
+	var problems []string
+	if n := length(p); len(pwd) < n {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", n))
+	}
+	for _, c := range Classes(p) {
+		if !strings.ContainsAny(pwd, charsets[c]) {
+			problems = append(problems, fmt.Sprintf("must contain %s", classNames[c]))
+		}
+	}
+	if p.ExcludeAmbiguous && strings.ContainsAny(pwd, ambiguous) {
+		problems = append(problems, fmt.Sprintf("must not contain ambiguous characters (%s)", strings.Join(strings.Split(ambiguous, ""), " ")))
+	}
+	return problems
+}
+
+var classNames = map[string]string{
+	ClassLower:   "a lowercase letter",
+	ClassUpper:   "an uppercase letter",
+	ClassDigits:  "a digit",
+	ClassSymbols: "a symbol (" + charsets[ClassSymbols] + ")",
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/config"
+)
+
+func TestGenerate(t *testing.T) {
+	policies := []config.PasswordPolicy{
+		{},
+		{Length: 20, Classes: []string{"lower", "digits", "symbols"}, ExcludeAmbiguous: true},
+		{Length: 2, Classes: []string{"lower", "upper", "digits", "symbols"}},
+	}
+	for _, p := range policies {
+		seen := make(map[string]bool)
+		for i := 0; i < 50; i++ {
+			pwd, err := Generate(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problems := Check(p, pwd); problems != nil {
+				t.Fatalf("%+v: generated %q does not match the policy: %v", p, pwd, problems)
+			}
+			seen[pwd] = true
+		}
+		if len(seen) < 45 {
+			t.Errorf("%+v: only %d distinct passwords of 50", p, len(seen))
+		}
+	}
+
+	if pwd, _ := Generate(config.PasswordPolicy{}); len(pwd) != DefaultLength {
+		t.Errorf("default length: got %q", pwd)
+	}
+	if pwd, _ := Generate(config.PasswordPolicy{Length: 64, ExcludeAmbiguous: true}); strings.ContainsAny(pwd, ambiguous) {
+		t.Errorf("ambiguous characters in %q", pwd)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := config.PasswordPolicy{Length: 10, Classes: []string{"lower", "upper", "digits"}, ExcludeAmbiguous: true}
+	if problems := Check(p, "Secure2Pass"); problems != nil {
+		t.Errorf("valid password rejected: %v", problems)
+	}
+	problems := Check(p, "short0")
+	want := []string{"must be at least 10 characters long", "must contain an uppercase letter", "must not contain ambiguous characters (0 O 1 l I |)"}
+	if strings.Join(problems, "; ") != strings.Join(want, "; ") {
+		t.Errorf("got %v, want %v", problems, want)
+	}
+}
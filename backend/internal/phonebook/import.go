@@ -0,0 +1,291 @@
+package phonebook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"provisioning-system/internal/models"
+)
+
+// Import formats
+const (
+	FormatCSV   = "csv"
+	FormatVCard = "vcard"
+)
+
+// Parse reads contacts in the given format (csv, vcard)
+func Parse(format string, r io.Reader) ([]models.Contact, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(r)
+	case FormatVCard:
+		return ParseVCard(r)
+	}
+	return nil, fmt.Errorf("unknown format %q (csv, vcard)", format)
+}
+
+// DetectFormat guesses the format of an uploaded file by its name and content
+func DetectFormat(filename string, data []byte) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".vcf") || strings.HasSuffix(name, ".vcard"):
+		return FormatVCard
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case bytes.HasPrefix(bytes.ToUpper(bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))), []byte("BEGIN:VCARD")):
+		return FormatVCard
+	}
+	return FormatCSV
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// CSV header columns (lowercase, spaces and dashes as "_") -> contact field
+var csvColumns = map[string]string{
+	"name": "name", "display_name": "name", "full_name": "name",
+	"first_name": "first_name", "firstname": "first_name", "given_name": "first_name",
+	"last_name": "last_name", "lastname": "last_name", "surname": "last_name", "family_name": "last_name",
+	"company": "company", "organization": "company", "org": "company",
+	"title": "title", "job_title": "title",
+	"email": "email", "e_mail": "email",
+	"groups": "groups", "group": "groups", "category": "groups", "categories": "groups",
+	"note": "note", "notes": "note",
+
+	"number": models.NumberWork, "phone": models.NumberWork, "telephone": models.NumberWork,
+	"work": models.NumberWork, "work_phone": models.NumberWork,
+	"mobile": models.NumberMobile, "mobile_phone": models.NumberMobile, "cell": models.NumberMobile,
+	"home": models.NumberHome, "home_phone": models.NumberHome,
+	"fax":   models.NumberFax,
+	"other": models.NumberOther, "other_phone": models.NumberOther,
+}
+
+// ParseCSV reads contacts from a CSV file with a header row. The delimiter is "," or ";" (Excel),
+// groups are separated by ",", ";" or "|". Unknown columns are ignored, empty rows skipped.
+func ParseCSV(r io.Reader) ([]models.Contact, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(3); err == nil && bytes.Equal(b, utf8BOM) {
+		br.Discard(3)
+	}
+	first, err := br.Peek(4096)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	header, _, _ := bytes.Cut(first, []byte("\n"))
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty CSV file")
+	}
+
+	fields := make([]string, len(rows[0]))
+	hasNumber := false
+	for i, col := range rows[0] {
+		key := strings.ToLower(strings.TrimSpace(col))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		fields[i] = csvColumns[key]
+		if ValidNumberType(fields[i]) {
+			hasNumber = true
+		}
+	}
+	if !hasNumber {
+		return nil, errors.New("no number column in the CSV header (number, work, mobile, home, fax, other)")
+	}
+
+	var contacts []models.Contact
+	for _, row := range rows[1:] {
+		var c models.Contact
+		empty := true
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if i >= len(fields) || value == "" {
+				continue
+			}
+			empty = false
+			switch field := fields[i]; field {
+			case "name":
+				c.Name = value
+			case "first_name":
+				c.FirstName = value
+			case "last_name":
+				c.LastName = value
+			case "company":
+				c.Company = value
+			case "title":
+				c.Title = value
+			case "email":
+				c.Email = value
+			case "note":
+				c.Note = value
+			case "groups":
+				c.Groups = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == '|' })
+			case "":
+			default:
+				c.Numbers = append(c.Numbers, models.ContactNumber{Type: field, Number: value})
+			}
+		}
+		if !empty {
+			contacts = append(contacts, c)
+		}
+	}
+	return contacts, nil
+}
+
+// ParseVCard reads contacts from vCard 2.1/3.0/4.0 data: FN, N, ORG, TITLE, EMAIL, TEL (types cell, home,
+// work, fax), CATEGORIES and NOTE. Other properties are ignored.
+func ParseVCard(r io.Reader) ([]models.Contact, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	// Unfold continuation lines (starting with a space or a tab)
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(l, "\r"))
+	}
+
+	var contacts []models.Contact
+	var card *models.Contact
+	for n, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		nameParams, value, ok := strings.Cut(l, ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(nameParams, ";")
+		name := strings.ToUpper(parts[0])
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:] // item1.TEL
+		}
+		params := parts[1:]
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			if card != nil {
+				return nil, fmt.Errorf("line %d: nested BEGIN:VCARD", n+1)
+			}
+			card = &models.Contact{}
+			continue
+		case name == "END" && strings.EqualFold(value, "VCARD"):
+			if card == nil {
+				return nil, fmt.Errorf("line %d: END:VCARD without BEGIN", n+1)
+			}
+			contacts = append(contacts, *card)
+			card = nil
+			continue
+		case card == nil:
+			continue
+		}
+
+		switch name {
+		case "FN":
+			card.Name = vcardUnescape(value)
+		case "N":
+			n := vcardSplit(value, ';')
+			if len(n) > 0 {
+				card.LastName = n[0]
+			}
+			if len(n) > 1 {
+				card.FirstName = n[1]
+			}
+		case "ORG":
+			card.Company = vcardSplit(value, ';')[0]
+		case "TITLE":
+			card.Title = vcardUnescape(value)
+		case "EMAIL":
+			if card.Email == "" {
+				card.Email = vcardUnescape(value)
+			}
+		case "TEL":
+			number := strings.TrimPrefix(vcardUnescape(value), "tel:")
+			card.Numbers = append(card.Numbers, models.ContactNumber{Type: vcardNumberType(params), Number: number})
+		case "CATEGORIES":
+			card.Groups = append(card.Groups, vcardSplit(value, ',')...)
+		case "NOTE":
+			card.Note = vcardUnescape(value)
+		}
+	}
+	if card != nil {
+		return nil, errors.New("unterminated vCard (no END:VCARD)")
+	}
+	if len(contacts) == 0 {
+		return nil, errors.New("no vCard found")
+	}
+	return contacts, nil
+}
+
+// vcardNumberType maps TEL parameters (TYPE=CELL,VOICE / TYPE=cell;TYPE=pref / CELL in vCard 2.1) to a number type
+func vcardNumberType(params []string) string {
+	types := make(map[string]bool)
+	for _, p := range params {
+		p = strings.ToLower(p)
+		if k, v, ok := strings.Cut(p, "="); ok {
+			if k != "type" {
+				continue
+			}
+			p = strings.Trim(v, `"`)
+		}
+		for _, t := range strings.Split(p, ",") {
+			types[t] = true
+		}
+	}
+	delete(types, "pref")
+	switch {
+	case types["fax"]:
+		return models.NumberFax
+	case types["cell"]:
+		return models.NumberMobile
+	case types["home"]:
+		return models.NumberHome
+	case types["work"], types["voice"], len(types) == 0:
+		return models.NumberWork
+	}
+	return models.NumberOther
+}
+
+// vcardSplit splits a structured value at unescaped separators and unescapes the parts
+func vcardSplit(value string, sep byte) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			b.WriteByte('\\')
+			b.WriteByte(value[i+1])
+			i++
+		case value[i] == sep:
+			parts = append(parts, vcardUnescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return append(parts, vcardUnescape(b.String()))
+}
+
+func vcardUnescape(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s))
+}
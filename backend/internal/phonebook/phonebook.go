@@ -0,0 +1,201 @@
+// Package phonebook builds the corporate directory of a domain: internal numbers (phones and their SIP
+// accounts) and external contacts of the domain and shared phonebooks. The entries are exposed to the
+// vendor directory/ templates and imported from CSV or vCard files.
+package phonebook
+
+import (
+	"sort"
+	"strings"
+
+	"provisioning-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Entry sources
+const (
+	SourceInternal = "internal" // Phone or SIP account of the domain
+	SourceExternal = "external" // Contact of a phonebook
+)
+
+// Entry is a directory entry as seen by the directory templates ({% for entry in directory %})
+type Entry struct {
+	Name      string                 `json:"name"`
+	FirstName string                 `json:"first_name"`
+	LastName  string                 `json:"last_name"`
+	Company   string                 `json:"company"`
+	Title     string                 `json:"title"`
+	Email     string                 `json:"email"`
+	Number    string                 `json:"number"`  // Main number: the extension, or the first work/other number of a contact
+	Numbers   []models.ContactNumber `json:"numbers"` // All numbers
+	Groups    []string               `json:"groups"`
+	Phonebook string                 `json:"phonebook"`            // Name of the phonebook, empty for internal entries
+	Source    string                 `json:"source"`               // internal, external
+	Domain    string                 `json:"domain"`               // Domain of the phone or the phonebook (empty for shared phonebooks)
+	PhoneID   uint                   `json:"phone_id,omitempty"`   // Internal entries
+	ContactID uint                   `json:"contact_id,omitempty"` // External entries
+}
+
+// Loader returns the phonebooks with their contacts from the database (provisioner.Manager.Phonebooks)
+func Loader(db *gorm.DB) func() ([]models.Phonebook, error) {
+	return func() ([]models.Phonebook, error) {
+		var books []models.Phonebook
+		err := db.Preload("Contacts", func(tx *gorm.DB) *gorm.DB { return tx.Order("name") }).Order("domain, name").Find(&books).Error
+		return books, err
+	}
+}
+
+// Normalize trims the contact fields, builds a missing name from the first and last names (or the company),
+// lowercases number types (default work) and drops empty numbers and groups
+func Normalize(c *models.Contact) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.FirstName = strings.TrimSpace(c.FirstName)
+	c.LastName = strings.TrimSpace(c.LastName)
+	c.Company = strings.TrimSpace(c.Company)
+	c.Title = strings.TrimSpace(c.Title)
+	c.Email = strings.TrimSpace(c.Email)
+	if c.Name == "" {
+		c.Name = strings.TrimSpace(c.FirstName + " " + c.LastName)
+	}
+	if c.Name == "" {
+		c.Name = c.Company
+	}
+
+	numbers := make([]models.ContactNumber, 0, len(c.Numbers))
+	for _, n := range c.Numbers {
+		n.Number = strings.TrimSpace(n.Number)
+		n.Type = strings.ToLower(strings.TrimSpace(n.Type))
+		if n.Number == "" {
+			continue
+		}
+		if n.Type == "" {
+			n.Type = models.NumberWork
+		}
+		numbers = append(numbers, n)
+	}
+	c.Numbers = numbers
+
+	groups := make([]string, 0, len(c.Groups))
+	for _, g := range c.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	c.Groups = groups
+}
+
+// ValidNumberType reports whether t is one of models.ContactNumberTypes
+func ValidNumberType(t string) bool {
+	for _, v := range models.ContactNumberTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Build returns the directory of a domain sorted by name: the phones of the domain (one entry per SIP user,
+// or the phone number for phones without accounts) and the contacts of the domain and shared phonebooks.
+// phones may contain phones of other domains, phonebooks must have their contacts loaded.
+func Build(domain string, phones []models.Phone, phonebooks []models.Phonebook) []Entry {
+	entries := []Entry{}
+	seen := make(map[string]bool) // internal numbers
+	addInternal := func(phone *models.Phone, name, number string) {
+		if number == "" || seen[number] {
+			return
+		}
+		seen[number] = true
+		if name == "" {
+			name = number
+		}
+		first, last, _ := strings.Cut(name, " ")
+		entries = append(entries, Entry{
+			Name:      name,
+			FirstName: first,
+			LastName:  strings.TrimSpace(last),
+			Number:    number,
+			Numbers:   []models.ContactNumber{{Type: models.NumberWork, Number: number}},
+			Groups:    []string{},
+			Source:    SourceInternal,
+			Domain:    phone.Domain,
+			PhoneID:   phone.ID,
+		})
+	}
+
+	for i := range phones {
+		phone := &phones[i]
+		if phone.Domain != domain || phone.Type == "gateway" {
+			continue
+		}
+		accounts := 0
+		for _, l := range phone.Lines {
+			account, ok := models.SIPAccountFromLine(phone, l)
+			if !ok || account.UserName == "" {
+				continue
+			}
+			accounts++
+			name := account.DisplayName
+			if name == "" {
+				name = phone.Description
+			}
+			addInternal(phone, name, account.UserName)
+		}
+		if accounts == 0 && phone.PhoneNumber != nil {
+			addInternal(phone, phone.Description, *phone.PhoneNumber)
+		}
+	}
+
+	for _, book := range phonebooks {
+		if book.Domain != "" && book.Domain != domain {
+			continue
+		}
+		for _, c := range book.Contacts {
+			entries = append(entries, contactEntry(book, c))
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries
+}
+
+func contactEntry(book models.Phonebook, c models.Contact) Entry {
+	e := Entry{
+		Name:      c.Name,
+		FirstName: c.FirstName,
+		LastName:  c.LastName,
+		Company:   c.Company,
+		Title:     c.Title,
+		Email:     c.Email,
+		Numbers:   c.Numbers,
+		Groups:    c.Groups,
+		Phonebook: book.Name,
+		Source:    SourceExternal,
+		Domain:    book.Domain,
+		ContactID: c.ID,
+	}
+	if e.Numbers == nil {
+		e.Numbers = []models.ContactNumber{}
+	}
+	if e.Groups == nil {
+		e.Groups = []string{}
+	}
+	if e.FirstName == "" && e.LastName == "" {
+		first, last, _ := strings.Cut(e.Name, " ")
+		e.FirstName, e.LastName = first, strings.TrimSpace(last)
+	}
+	// Main number: work first, then other, then whatever the contact has
+	for _, t := range []string{models.NumberWork, models.NumberOther, ""} {
+		for _, n := range e.Numbers {
+			if t == "" || n.Type == t {
+				e.Number = n.Number
+				break
+			}
+		}
+		if e.Number != "" {
+			break
+		}
+	}
+	return e
+}
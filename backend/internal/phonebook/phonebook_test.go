@@ -0,0 +1,115 @@
+package phonebook
+
+import (
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/models"
+)
+
+func TestParseCSV(t *testing.T) {
+	data := "\xef\xbb\xbfName;Company;Work Phone;Mobile;Groups;Unknown\n" +
+		"John Smith;Acme;+1 905 480 4321;+1 416 555 0100;Suppliers, VIP;x\n" +
+		";;;;;\n" +
+		"\"Doe; Jane\";;200;;;\n"
+	contacts, err := ParseCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("expected 2 contacts, got %+v", contacts)
+	}
+	c := contacts[0]
+	if c.Name != "John Smith" || c.Company != "Acme" || len(c.Numbers) != 2 || c.Numbers[1].Type != models.NumberMobile {
+		t.Errorf("unexpected contact %+v", c)
+	}
+	if len(c.Groups) != 2 || strings.TrimSpace(c.Groups[1]) != "VIP" {
+		t.Errorf("unexpected groups %q", c.Groups)
+	}
+	if contacts[1].Name != "Doe; Jane" {
+		t.Errorf("quoted name: %q", contacts[1].Name)
+	}
+
+	if _, err := ParseCSV(strings.NewReader("name,company\nJohn,Acme\n")); err == nil {
+		t.Error("CSV without a number column accepted")
+	}
+}
+
+func TestParseVCard(t *testing.T) {
+	data := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;John;;;\r\nFN:John Smith\r\nORG:Acme\\, Inc.;Sales\r\n" +
+		"TEL;TYPE=WORK,VOICE:+1 905 480 4321\r\nTEL;TYPE=cell;TYPE=pref:+1 416 555 0100\r\n" +
+		"item1.TEL:100\r\nCATEGORIES:Suppliers,VIP\r\nNOTE:Line one\\nline\r\n  two\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\nVERSION:2.1\nN:Doe;Jane\nTEL;HOME;VOICE:200\nTEL;FAX:201\nEND:VCARD\n"
+	contacts, err := ParseVCard(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("expected 2 contacts, got %+v", contacts)
+	}
+	c := contacts[0]
+	if c.Name != "John Smith" || c.FirstName != "John" || c.LastName != "Smith" || c.Company != "Acme, Inc." {
+		t.Errorf("unexpected contact %+v", c)
+	}
+	want := []models.ContactNumber{{Type: models.NumberWork, Number: "+1 905 480 4321"}, {Type: models.NumberMobile, Number: "+1 416 555 0100"}, {Type: models.NumberWork, Number: "100"}}
+	if len(c.Numbers) != len(want) {
+		t.Fatalf("unexpected numbers %+v", c.Numbers)
+	}
+	for i := range want {
+		if c.Numbers[i] != want[i] {
+			t.Errorf("number %d = %+v, want %+v", i, c.Numbers[i], want[i])
+		}
+	}
+	if len(c.Groups) != 2 || c.Note != "Line one\nline two" {
+		t.Errorf("unexpected groups/note %q %q", c.Groups, c.Note)
+	}
+	if d := contacts[1]; d.Name != "" || d.Numbers[0].Type != models.NumberHome || d.Numbers[1].Type != models.NumberFax {
+		t.Errorf("unexpected vCard 2.1 contact %+v", d)
+	}
+
+	if _, err := ParseVCard(strings.NewReader("BEGIN:VCARD\nFN:x\n")); err == nil {
+		t.Error("unterminated vCard accepted")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	number, gateway := "150", "10.0.0.1"
+	phones := []models.Phone{
+		{ID: 1, Domain: "office", Description: "Reception desk", Lines: []models.PhoneLine{
+			{Type: "Line", AdditionalInfo: `{"user_name":"100","display_name":"Reception"}`},
+			{Type: "Line", AdditionalInfo: `{"user_name":"101"}`},
+		}},
+		{ID: 2, Domain: "office", PhoneNumber: &number, Description: "Warehouse"},
+		{ID: 3, Domain: "office", Type: "gateway", PhoneNumber: &gateway},
+		{ID: 4, Domain: "branch", PhoneNumber: &number},
+	}
+	phonebooks := []models.Phonebook{
+		{Name: "Suppliers", Contacts: []models.Contact{
+			{ID: 7, Name: "acme support", Numbers: []models.ContactNumber{{Type: models.NumberMobile, Number: "+7 900"}, {Type: models.NumberWork, Number: "+7 495"}}},
+		}},
+		{Name: "Branch", Domain: "branch", Contacts: []models.Contact{{Name: "Hidden"}}},
+	}
+
+	entries := Build("office", phones, phonebooks)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name+"="+e.Number)
+	}
+	if got := strings.Join(names, ","); got != "acme support=+7 495,Reception=100,Reception desk=101,Warehouse=150" {
+		t.Errorf("unexpected directory %s", got)
+	}
+	if e := entries[0]; e.Source != SourceExternal || e.Phonebook != "Suppliers" || e.FirstName != "acme" || e.ContactID != 7 {
+		t.Errorf("unexpected external entry %+v", e)
+	}
+	if e := entries[2]; e.Source != SourceInternal || e.PhoneID != 1 || e.LastName != "desk" {
+		t.Errorf("unexpected internal entry %+v", e)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := models.Contact{FirstName: " John ", LastName: "Smith", Numbers: []models.ContactNumber{{Type: "", Number: " 100 "}, {Type: "Mobile", Number: ""}}, Groups: []string{" ", "VIP "}}
+	Normalize(&c)
+	if c.Name != "John Smith" || len(c.Numbers) != 1 || c.Numbers[0] != (models.ContactNumber{Type: models.NumberWork, Number: "100"}) || len(c.Groups) != 1 || c.Groups[0] != "VIP" {
+		t.Errorf("unexpected contact %+v", c)
+	}
+}
@@ -0,0 +1,40 @@
+package provisioner
+
+import (
+	"strings"
+
+	"provisioning-system/internal/macaddr"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	pongo2.RegisterFilter("mac", filterMAC)
+	pongo2.RegisterFilter("csv", filterCSV)
+}
+
+// filterMAC renders a MAC address in a vendor format: {{ account.mac_address|mac:"dot" }} -> 0015.65aa.bbcc.
+// Formats: plain (default), colon, dash, dot; combine with |upper for uppercase.
+// Values that are not MAC addresses are returned unchanged.
+func filterMAC(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	m, err := macaddr.Parse(in.String())
+	if err != nil {
+		return in, nil
+	}
+	out, err := m.Format(param.String())
+	if err != nil {
+		return nil, &pongo2.Error{OrigError: err}
+	}
+	return pongo2.AsValue(out), nil
+}
+
+// filterCSV renders a value as a CSV field: {{ entry.Company|csv }} -> "Smith, Jones & Co".
+// Values with commas, quotes or line breaks are quoted (quotes doubled), others are written as they are.
+// The result is not HTML-escaped.
+func filterCSV(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	s := in.String()
+	if strings.ContainsAny(s, ",\"\r\n") {
+		s = `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return pongo2.AsSafeValue(s), nil
+}
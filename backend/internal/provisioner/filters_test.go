@@ -0,0 +1,58 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestFilterMAC(t *testing.T) {
+	tests := map[string]string{
+		`{{ mac|mac }}`:                "001565aabbcc",
+		`{{ mac|mac:"colon" }}`:        "00:15:65:aa:bb:cc",
+		`{{ mac|mac:"dash"|upper }}`:   "00-15-65-AA-BB-CC",
+		`{{ mac|mac:"dot" }}`:          "0015.65aa.bbcc",
+		`{{ other|mac:"colon" }}`:      "not a mac",
+		`spa{{ mac|mac:"plain" }}.xml`: "spa001565aabbcc.xml",
+	}
+	ctx := pongo2.Context{"mac": "00:15:65:AA:BB:CC", "other": "not a mac"}
+	for text, want := range tests {
+		tpl, err := pongo2.FromString(text)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		got, err := tpl.Execute(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", text, got, want)
+		}
+	}
+
+	tpl, _ := pongo2.FromString(`{{ mac|mac:"cisco" }}`)
+	if _, err := tpl.Execute(ctx); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestFilterCSV(t *testing.T) {
+	tests := map[string]string{
+		"Smith":             "Smith",
+		"Smith, Jones & Co": `"Smith, Jones & Co"`,
+		`The "Best" Ltd.`:   `"The ""Best"" Ltd."`,
+		"two\nlines":        "\"two\nlines\"",
+		"":                  "",
+	}
+	tpl, err := pongo2.FromString(`{{ value|csv }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range tests {
+		got, err := tpl.Execute(pongo2.Context{"value": value})
+		if err != nil || got != want {
+			t.Errorf("%q = %q, want %q (%v)", value, got, want, err)
+		}
+	}
+}
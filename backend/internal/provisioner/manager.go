@@ -8,7 +8,11 @@ import (
 
 	"provisioning-system/internal/config"
 	"provisioning-system/internal/logger"
+	"provisioning-system/internal/macaddr"
 	"provisioning-system/internal/models"
+	"provisioning-system/internal/phonebook"
+	"provisioning-system/internal/secrets"
+	"provisioning-system/internal/variables"
 
 	"github.com/flosch/pongo2/v6"
 	"gopkg.in/yaml.v3"
@@ -18,8 +22,22 @@ type Manager struct {
 	Config  *config.SystemConfig
 	Vendors []VendorConfig
 	Models  []DeviceModel
+
+	// Firmware returns the resolver of the firmware phones should run, called once per generation run
+	// (optional, see internal/firmware)
+	Firmware func() (FirmwareResolver, error)
+
+	// Secrets encrypts secret params of the lines (optional: without it they are stored as is)
+	Secrets *secrets.Box
+
+	// Phonebooks returns the phonebooks with their contacts for the directory templates
+	// (optional: without it the directory has the internal numbers only, see internal/phonebook)
+	Phonebooks func() ([]models.Phonebook, error)
 }
 
+// FirmwareResolver returns the target firmware of a phone, nil if none
+type FirmwareResolver func(phone models.Phone) *models.Firmware
+
 func NewManager(cfg *config.SystemConfig) *Manager {
 	// Disable Pongo2 caching to allow hot-reloading of templates
 	pongo2.DefaultSet.Debug = true
@@ -175,6 +193,11 @@ func (m *Manager) LoadVendors(vendorsDir string) error {
 
 // GenerateConfigs генерирует конфигурационные файлы для всех доменов и вендоров
 func (m *Manager) GenerateConfigs(outputDir string, phones []models.Phone) error {
+	phones, err := m.openPhones(phones)
+	if err != nil {
+		return err
+	}
+
 	// 1. Prepare data for all domains
 	var allDomains []map[string]interface{}
 
@@ -184,11 +207,13 @@ func (m *Manager) GenerateConfigs(outputDir string, phones []models.Phone) error
 		phonesByDomain[p.Domain] = append(phonesByDomain[p.Domain], p)
 	}
 
+	directories := m.directories(phones)
 	for _, d := range m.Config.Domains {
 		domainData := map[string]interface{}{
 			"name":      d.Name,
 			"variables": d.Variables,
 			"phones":    phonesByDomain[d.Name],
+			"directory": directories[d.Name],
 		}
 		allDomains = append(allDomains, domainData)
 	}
@@ -202,7 +227,7 @@ func (m *Manager) GenerateConfigs(outputDir string, phones []models.Phone) error
 		domainPhones := phonesByDomain[domainName]
 
 		for _, vendor := range m.Vendors {
-			if err := m.generateForVendor(outputDir, domainConfig, vendor, domainPhones, allDomains); err != nil {
+			if err := m.generateForVendor(outputDir, domainConfig, vendor, domainPhones, directories[domainName], allDomains); err != nil {
 				return fmt.Errorf("failed to generate config for domain %s, vendor %s: %w", domainName, vendor.Name, err)
 			}
 		}
@@ -211,7 +236,7 @@ func (m *Manager) GenerateConfigs(outputDir string, phones []models.Phone) error
 	return nil
 }
 
-func (m *Manager) generateForVendor(outputDir string, domain config.DomainSettings, vendor VendorConfig, phones []models.Phone, allDomains []map[string]interface{}) error {
+func (m *Manager) generateForVendor(outputDir string, domain config.DomainSettings, vendor VendorConfig, phones []models.Phone, directory []phonebook.Entry, allDomains []map[string]interface{}) error {
 	// Создаем выходную директорию: outputDir/domain/
 	// Файлы всех вендоров кладем в корень домена (как на TFTP сервере)
 	targetDir := filepath.Join(outputDir, domain.Name)
@@ -241,15 +266,20 @@ func (m *Manager) generateForVendor(outputDir string, domain config.DomainSettin
 
 		// Подготавливаем контекст
 		ctx := pongo2.Context{}
-		vars := make(map[string]interface{})
-		for k, v := range domain.Variables {
-			ctx[k] = v
-			vars[k] = v
-		}
-		ctx["variables"] = vars
+		vars := variables.Resolve(
+			variables.Layer{Source: variables.SourceGlobal, Values: m.Config.Variables},
+			variables.Layer{Source: variables.SourceDomain, Name: domain.Name, Values: domain.Variables},
+			variables.Layer{Source: variables.SourceVendor, Name: vendor.ID, Values: vendor.Variables},
+		)
+		for k, v := range vars {
+			ctx[k] = v.Value
+		}
+		ctx["variables"] = vars.Values()
+		ctx["variable_sources"] = vars.Sources()
 		ctx["domain_name"] = domain.Name
 		ctx["vendor_name"] = vendor.Name
 		ctx["phones"] = phones
+		ctx["directory"] = directory
 		ctx["all_domains"] = allDomains
 
 		// Рендерим
@@ -306,8 +336,29 @@ func (m *Manager) generateForVendor(outputDir string, domain config.DomainSettin
 	return nil
 }
 
+// directories builds the directory of each domain: internal numbers and contacts of the domain and shared phonebooks
+func (m *Manager) directories(phones []models.Phone) map[string][]phonebook.Entry {
+	var books []models.Phonebook
+	if m.Phonebooks != nil {
+		var err error
+		if books, err = m.Phonebooks(); err != nil {
+			logger.Warn("Failed to load phonebooks, directories have internal numbers only: %v", err)
+		}
+	}
+	result := make(map[string][]phonebook.Entry, len(m.Config.Domains))
+	for _, d := range m.Config.Domains {
+		result[d.Name] = phonebook.Build(d.Name, phones, books)
+	}
+	return result
+}
+
 // GenerateDirectories генерирует только файлы из папки directory для всех вендоров
 func (m *Manager) GenerateDirectories(outputDir string, phones []models.Phone) error {
+	phones, err := m.openPhones(phones)
+	if err != nil {
+		return err
+	}
+
 	// 1. Prepare data for all domains
 	var allDomains []map[string]interface{}
 
@@ -317,11 +368,13 @@ func (m *Manager) GenerateDirectories(outputDir string, phones []models.Phone) e
 		phonesByDomain[p.Domain] = append(phonesByDomain[p.Domain], p)
 	}
 
+	directories := m.directories(phones)
 	for _, d := range m.Config.Domains {
 		domainData := map[string]interface{}{
 			"name":      d.Name,
 			"variables": d.Variables,
 			"phones":    phonesByDomain[d.Name],
+			"directory": directories[d.Name],
 		}
 		allDomains = append(allDomains, domainData)
 	}
@@ -370,12 +423,18 @@ func (m *Manager) GenerateDirectories(outputDir string, phones []models.Phone) e
 				}
 
 				ctx := pongo2.Context{}
-				for k, v := range domainConfig.Variables {
-					ctx[k] = v
+				vars := variables.Resolve(
+					variables.Layer{Source: variables.SourceGlobal, Values: m.Config.Variables},
+					variables.Layer{Source: variables.SourceDomain, Name: domainName, Values: domainConfig.Variables},
+					variables.Layer{Source: variables.SourceVendor, Name: vendor.ID, Values: vendor.Variables},
+				)
+				for k, v := range vars {
+					ctx[k] = v.Value
 				}
 				ctx["domain_name"] = domainName
 				ctx["vendor_name"] = vendor.Name
 				ctx["phones"] = domainPhones
+				ctx["directory"] = directories[domainName]
 				ctx["all_domains"] = allDomains
 
 				out, err := tpl.Execute(ctx)
@@ -450,11 +509,30 @@ func (m *Manager) copyStaticFiles(srcDir, dstDir string) error {
 
 func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone) ([]string, error) {
 	var warnings []string
+	var failed []string // Phones whose secrets cannot be decrypted
+
+	var resolveFirmware FirmwareResolver
+	if m.Firmware != nil {
+		var err error
+		if resolveFirmware, err = m.Firmware(); err != nil {
+			logger.Warn("Failed to load firmware policies, configs are generated without firmware: %v", err)
+		}
+	}
 
 	for _, phone := range phones {
+		// Keys, features and expansion modules inherited from the profile; secrets decrypted for rendering
+		opened, err := m.OpenPhone(phone.ApplyProfile())
+		if err != nil {
+			// Not rendered with empty secrets: the previous config of the phone stays
+			logger.Error("Skip phone %d: %v", phone.ID, err)
+			failed = append(failed, err.Error())
+			continue
+		}
+		phone = opened
+
 		mac := ""
 		if phone.MacAddress != nil {
-			mac = strings.ReplaceAll(*phone.MacAddress, ":", "")
+			mac = macaddr.Plain(*phone.MacAddress)
 		}
 		// Log generation start
 		logger.Info("Generating config for phone %s (Vendor: %s, Model: %s, Domain: %s)", mac, phone.Vendor, phone.ModelID, phone.Domain)
@@ -654,9 +732,10 @@ func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone)
 		}
 		// 3. Render Final Config
 		domainConfig := m.Config.GetEffectiveDomainConfig(phone.Domain)
-		domainCtx := make(map[string]interface{})
-		for k, v := range domainConfig.Variables {
-			domainCtx[k] = v
+		vars := m.PhoneVariables(phone)
+		profileName := ""
+		if phone.Profile != nil {
+			profileName = phone.Profile.Name
 		}
 
 		number := ""
@@ -665,10 +744,12 @@ func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone)
 		}
 
 		context := pongo2.Context{
-			"phone":       phone,
-			"vendor":      vendor,
-			"variables":   domainCtx,
-			"keys_config": keysConfig,
+			"phone":            phone,
+			"vendor":           vendor,
+			"variables":        vars.Values(),
+			"variable_sources": vars.Sources(),
+			"keys_config":      keysConfig,
+			"raw_config":       phone.RawConfig,
 			"account": map[string]interface{}{
 				"id":           phone.ID,
 				"domain":       phone.Domain,
@@ -677,10 +758,18 @@ func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone)
 				"phone_number": number,
 				"ip_address":   phone.IPAddress,
 				"type":         phone.Type,
+				"profile":      profileName,
 				"lines":        linesForContext,
 			},
 		}
 
+		// Target firmware: {{ firmware.url }}, {{ firmware.version }}...
+		if resolveFirmware != nil {
+			if fw := resolveFirmware(phone); fw != nil {
+				context["firmware"] = firmwareContext(*fw, domainConfig)
+			}
+		}
+
 		// Render main template
 		tplPath := filepath.Join(vendor.Dir, vendor.PhoneConfigTemplate)
 		tplData, err := os.ReadFile(tplPath)
@@ -700,6 +789,7 @@ func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone)
 			logger.Error("Error executing phone template %s: %v", tplPath, err)
 			continue
 		}
+		finalConfig = MergeRawConfig(finalConfig, phone.RawConfig, vendor.RawConfig)
 
 		// Save to file
 		fileNameTpl, err := pongo2.FromString(vendor.PhoneConfigFile)
@@ -726,6 +816,9 @@ func (m *Manager) GeneratePhoneConfigs(outputDir string, phones []models.Phone)
 		logger.Info("Config saved to: %s", fullPath)
 	}
 
+	if len(failed) > 0 {
+		return warnings, fmt.Errorf("configs not generated: %s", strings.Join(failed, "; "))
+	}
 	return warnings, nil
 }
 
@@ -761,12 +854,43 @@ func (m *Manager) renderAndAppend(keysConfig *[]string, param FeatureParam, ctx
 	}
 }
 
+// PhoneVariables resolves the template variables of the phone from all levels (Profile must be loaded),
+// see internal/variables for the precedence
+func (m *Manager) PhoneVariables(phone models.Phone) variables.Resolved {
+	domain := m.Config.GetEffectiveDomainConfig(phone.Domain)
+	layers := []variables.Layer{
+		{Source: variables.SourceGlobal, Values: m.Config.Variables},
+		{Source: variables.SourceDomain, Name: domain.Name, Values: domain.Variables},
+	}
+	if vendor, ok := m.getVendorByID(phone.Vendor); ok {
+		layers = append(layers, variables.Layer{Source: variables.SourceVendor, Name: vendor.ID, Values: vendor.Variables})
+	}
+	if model, ok := m.getModelByID(phone.ModelID); ok {
+		layers = append(layers, variables.Layer{Source: variables.SourceModel, Name: model.ID, Values: model.Variables})
+	}
+	if phone.Profile != nil {
+		layers = append(layers, variables.Layer{Source: variables.SourceGroup, Name: phone.Profile.Name, Values: phone.Profile.Variables})
+	}
+	layers = append(layers, variables.Layer{Source: variables.SourcePhone, Values: phone.Variables})
+	return variables.Resolve(layers...)
+}
+
 // GetPhoneConfigPath returns the path to the phone's configuration file (without checking its existence)
 func (m *Manager) GetPhoneConfigPath(outputDir string, phone models.Phone) (string, error) {
 	mac := ""
 	if phone.MacAddress != nil {
-		mac = strings.ReplaceAll(*phone.MacAddress, ":", "")
+		mac = macaddr.Plain(*phone.MacAddress)
 	}
+	return m.phoneConfigPath(outputDir, phone, mac)
+}
+
+// GetLegacyPhoneConfigPath returns the path the phone's configuration file had before MAC addresses were
+// canonicalized: the stored address without colons, in the case it was entered
+func (m *Manager) GetLegacyPhoneConfigPath(outputDir string, phone models.Phone, storedMAC string) (string, error) {
+	return m.phoneConfigPath(outputDir, phone, strings.ReplaceAll(storedMAC, ":", ""))
+}
+
+func (m *Manager) phoneConfigPath(outputDir string, phone models.Phone, mac string) (string, error) {
 	number := ""
 	if phone.PhoneNumber != nil {
 		number = *phone.PhoneNumber
@@ -822,6 +946,24 @@ func (m *Manager) DeletePhoneConfig(outputDir string, phone models.Phone) error
 	return nil
 }
 
+// firmwareContext describes the firmware for templates. url is empty if the domain has no firmware_url.
+func firmwareContext(fw models.Firmware, domain config.DomainSettings) map[string]interface{} {
+	path := fw.Vendor + "/" + fw.FileName
+	url := ""
+	if domain.FirmwareURL != "" {
+		url = strings.TrimSuffix(domain.FirmwareURL, "/") + "/" + path
+	}
+	return map[string]interface{}{
+		"id":        fw.ID,
+		"version":   fw.Version,
+		"file_name": fw.FileName,
+		"path":      path,
+		"url":       url,
+		"sha256":    fw.SHA256,
+		"size":      fw.Size,
+	}
+}
+
 func renderPongoTemplate(tplString string, ctx pongo2.Context) (string, error) {
 	tpl, err := pongo2.FromString(tplString)
 	if err != nil {
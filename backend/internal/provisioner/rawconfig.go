@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"strings"
+)
+
+// Raw config merge modes
+const (
+	RawConfigAppend   = "append"   // Lines are added to the end of the config
+	RawConfigReplace  = "replace"  // key<separator>value lines replace the lines with the same key, the others are appended
+	RawConfigTemplate = "template" // The template places {{ raw_config }} itself (XML formats)
+)
+
+// RawConfig — как Phone.RawConfig объединяется с конфигом, сгенерированным шаблоном
+type RawConfig struct {
+	Mode      string `yaml:"mode" json:"mode"`           // append (default), replace, template
+	Separator string `yaml:"separator" json:"separator"` // replace: key/value separator, default "="
+}
+
+// MergeRawConfig merges the raw config of a phone into the rendered config
+func MergeRawConfig(config, raw string, rc RawConfig) string {
+	raw = strings.TrimSpace(strings.ReplaceAll(raw, "\r\n", "\n"))
+	if raw == "" {
+		return config
+	}
+
+	switch rc.Mode {
+	case RawConfigTemplate:
+		return config
+	case RawConfigReplace:
+		return replaceKeys(config, raw, rc.Separator)
+	default:
+		return appendLines(config, raw)
+	}
+}
+
+func appendLines(config, raw string) string {
+	if config != "" && !strings.HasSuffix(config, "\n") {
+		config += "\n"
+	}
+	return config + raw + "\n"
+}
+
+func replaceKeys(config, raw, separator string) string {
+	if separator == "" {
+		separator = "="
+	}
+	key := func(line string) string {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			return ""
+		}
+		k, _, found := strings.Cut(trimmed, separator)
+		if !found {
+			return ""
+		}
+		return strings.TrimSpace(k)
+	}
+
+	overrides := make(map[string]string)
+	var rest []string // Lines without a key and keys the config does not have, in the raw config order
+	var order []string
+	for _, line := range strings.Split(raw, "\n") {
+		k := key(line)
+		if k == "" {
+			rest = append(rest, line)
+			continue
+		}
+		if _, dup := overrides[k]; !dup {
+			order = append(order, k)
+		}
+		overrides[k] = strings.TrimSpace(line)
+	}
+
+	replaced := make(map[string]bool)
+	lines := strings.Split(config, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		k := key(line)
+		value, ok := overrides[k]
+		if k == "" || !ok {
+			out = append(out, line)
+			continue
+		}
+		if replaced[k] {
+			continue // Only the first occurrence is kept
+		}
+		replaced[k] = true
+		out = append(out, value)
+	}
+
+	for _, k := range order {
+		if !replaced[k] {
+			rest = append(rest, overrides[k])
+		}
+	}
+	result := strings.Join(out, "\n")
+	if len(rest) == 0 {
+		return result
+	}
+	return appendLines(result, strings.Join(rest, "\n"))
+}
@@ -0,0 +1,33 @@
+package provisioner
+
+import "testing"
+
+func TestMergeRawConfig(t *testing.T) {
+	config := "#!version:1.0.0.1\naccount.1.label = 101\nlocal_time.ntp_server1 = pool.ntp.org\n# local_time.time_zone = +3\n"
+	raw := "local_time.ntp_server1 = 10.0.0.1\r\nfeatures.dnd.enable=1\n# custom\nlocal_time.time_zone = +5"
+
+	cases := []struct {
+		name string
+		rc   RawConfig
+		want string
+	}{
+		{"append", RawConfig{}, config + "local_time.ntp_server1 = 10.0.0.1\nfeatures.dnd.enable=1\n# custom\nlocal_time.time_zone = +5\n"},
+		{"replace", RawConfig{Mode: RawConfigReplace},
+			"#!version:1.0.0.1\naccount.1.label = 101\nlocal_time.ntp_server1 = 10.0.0.1\n# local_time.time_zone = +3\n# custom\nfeatures.dnd.enable=1\nlocal_time.time_zone = +5\n"},
+		{"template", RawConfig{Mode: RawConfigTemplate}, config},
+	}
+	for _, c := range cases {
+		if got := MergeRawConfig(config, raw, c.rc); got != c.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", c.name, got, c.want)
+		}
+	}
+
+	mitel := "sip line1 proxy: 10.0.0.2\nsip line1 proxy port: 5060\n"
+	got := MergeRawConfig(mitel, "sip line1 proxy port: 5062", RawConfig{Mode: RawConfigReplace, Separator: ":"})
+	if got != "sip line1 proxy: 10.0.0.2\nsip line1 proxy port: 5062\n" {
+		t.Errorf("mitel: got %q", got)
+	}
+	if got := MergeRawConfig(config, "  \n", RawConfig{Mode: RawConfigReplace}); got != config {
+		t.Errorf("empty raw config changed the config: %q", got)
+	}
+}
@@ -0,0 +1,251 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/secrets"
+)
+
+// SecretParams returns the ids of the params marked secret for the line type:
+// account params for "Line", feature params otherwise
+func (m *Manager) SecretParams(vendorID, lineType string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, v := range m.Vendors {
+		if !strings.EqualFold(v.ID, vendorID) {
+			continue
+		}
+		features := v.Features
+		if lineType == "Line" {
+			features = v.Accounts
+		}
+		for _, f := range features {
+			if lineType == "Line" || f.ID == lineType {
+				collectSecretParams(f.Params, ids)
+			}
+		}
+	}
+	return ids
+}
+
+func collectSecretParams(params []FeatureParam, ids map[string]bool) {
+	for _, p := range params {
+		if p.Secret {
+			ids[p.ID] = true
+		}
+		collectSecretParams(p.Params, ids)
+	}
+}
+
+// SealInfo encrypts the secret values of a line's AdditionalInfo. A value equal to secrets.Mask
+// (sent back from a masked response) keeps the value of previous, the stored AdditionalInfo of the same line.
+func (m *Manager) SealInfo(vendorID, lineType, info, previous string) (string, error) {
+	values := decodeInfo(info)
+	if values == nil {
+		return info, nil
+	}
+	old := decodeInfo(previous)
+
+	secretIDs := m.SecretParams(vendorID, lineType)
+	changed := false
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			continue
+		}
+		if s == secrets.Mask {
+			if prev, ok := old[k].(string); ok && prev != "" {
+				values[k] = prev
+			} else {
+				delete(values, k)
+			}
+			changed = true
+			continue
+		}
+		if !secretIDs[k] || secrets.IsEncrypted(s) {
+			continue
+		}
+		enc, err := m.Secrets.Encrypt(s)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt %s: %w", k, err)
+		}
+		values[k] = enc
+		changed = true
+	}
+	if !changed {
+		return info, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SealLines encrypts the secret values of the phone lines, previous are the stored lines of the phone
+func (m *Manager) SealLines(phone *models.Phone, previous []models.PhoneLine) error {
+	for i := range phone.Lines {
+		l := &phone.Lines[i]
+		prev := ""
+		if p, ok := matchLine(previous, *l); ok {
+			prev = p.AdditionalInfo
+		}
+		sealed, err := m.SealInfo(phone.Vendor, l.Type, l.AdditionalInfo, prev)
+		if err != nil {
+			return err
+		}
+		l.AdditionalInfo = sealed
+	}
+	return nil
+}
+
+// matchLine finds the stored line a line of the request replaces: same type and position, or same account
+func matchLine(lines []models.PhoneLine, l models.PhoneLine) (models.PhoneLine, bool) {
+	same := func(a, b *int) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+	}
+	for _, p := range lines {
+		if p.Type == l.Type && p.AccountNumber == l.AccountNumber && same(p.PanelNumber, l.PanelNumber) && same(p.KeyNumber, l.KeyNumber) {
+			return p, true
+		}
+	}
+	if l.Type == "Line" {
+		for _, p := range lines {
+			if p.Type == "Line" && p.AccountNumber == l.AccountNumber {
+				return p, true
+			}
+		}
+	}
+	return models.PhoneLine{}, false
+}
+
+// MaskInfo replaces secret and encrypted values of AdditionalInfo with secrets.Mask
+func (m *Manager) MaskInfo(vendorID, lineType, info string) string {
+	values := decodeInfo(info)
+	if values == nil {
+		return info
+	}
+	secretIDs := m.SecretParams(vendorID, lineType)
+	changed := false
+	for k, v := range values {
+		if s, ok := v.(string); ok && s != "" && (secretIDs[k] || secrets.IsEncrypted(s)) {
+			values[k] = secrets.Mask
+			changed = true
+		}
+	}
+	if !changed {
+		return info
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// MaskPhone masks the secret values of the phone lines (and of its profile lines) for API responses
+func (m *Manager) MaskPhone(phone *models.Phone) {
+	for i := range phone.Lines {
+		phone.Lines[i].AdditionalInfo = m.MaskInfo(phone.Vendor, phone.Lines[i].Type, phone.Lines[i].AdditionalInfo)
+	}
+	if phone.Profile != nil {
+		profile := *phone.Profile
+		profile.Lines = append([]models.ProfileLine(nil), profile.Lines...)
+		for i := range profile.Lines {
+			profile.Lines[i].AdditionalInfo = m.MaskInfo(profile.Vendor, profile.Lines[i].Type, profile.Lines[i].AdditionalInfo)
+		}
+		phone.Profile = &profile
+	}
+}
+
+// OpenInfo decrypts the encrypted values of AdditionalInfo. A value that cannot be decrypted (another
+// master key, damaged data) is an error: a config must not be rendered with an empty password.
+func (m *Manager) OpenInfo(info string) (string, error) {
+	if !strings.Contains(info, "enc:") {
+		return info, nil
+	}
+	values := decodeInfo(info)
+	if values == nil {
+		return info, nil
+	}
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok || !secrets.IsEncrypted(s) {
+			continue
+		}
+		plain, err := m.Secrets.Decrypt(s)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt %s: %w", k, err)
+		}
+		values[k] = plain
+	}
+	data, _ := json.Marshal(values)
+	return string(data), nil
+}
+
+// OpenPhone returns a copy of the phone with the secrets of its lines decrypted. Only for rendering
+// (configs, deploy commands): the result must not be saved or returned by the API.
+func (m *Manager) OpenPhone(phone models.Phone) (models.Phone, error) {
+	lines := make([]models.PhoneLine, len(phone.Lines))
+	for i, l := range phone.Lines {
+		info, err := m.OpenInfo(l.AdditionalInfo)
+		if err != nil {
+			return phone, fmt.Errorf("phone %d, account %d: %w", phone.ID, l.AccountNumber, err)
+		}
+		l.AdditionalInfo = info
+		lines[i] = l
+	}
+	phone.Lines = lines
+	return phone, nil
+}
+
+// SecretValues returns the plain secret values of the phone lines (secret params and encrypted values),
+// to be masked in the output of the commands rendered from the opened phone
+func (m *Manager) SecretValues(phone models.Phone) ([]string, error) {
+	var values []string
+	for _, l := range phone.Lines {
+		secretIDs := m.SecretParams(phone.Vendor, l.Type)
+		for k, v := range decodeInfo(l.AdditionalInfo) {
+			s, ok := v.(string)
+			if !ok || s == "" || s == secrets.Mask {
+				continue
+			}
+			if secrets.IsEncrypted(s) {
+				plain, err := m.Secrets.Decrypt(s)
+				if err != nil {
+					return nil, fmt.Errorf("phone %d, account %d: failed to decrypt %s: %w", phone.ID, l.AccountNumber, k, err)
+				}
+				s = plain
+			} else if !secretIDs[k] {
+				continue
+			}
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (m *Manager) openPhones(phones []models.Phone) ([]models.Phone, error) {
+	opened := make([]models.Phone, len(phones))
+	for i, p := range phones {
+		var err error
+		if opened[i], err = m.OpenPhone(p); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+func decodeInfo(info string) map[string]interface{} {
+	if info == "" {
+		return nil
+	}
+	var values map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(info))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,66 @@
+package provisioner
+
+import (
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/secrets"
+)
+
+func TestSecretLines(t *testing.T) {
+	box, err := secrets.LoadKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{Secrets: box, Vendors: []VendorConfig{{
+		ID:       "yealink",
+		Accounts: []Feature{{ID: "sip", Params: []FeatureParam{{ID: "user_name"}, {ID: "password", Secret: true}}}},
+	}}}
+
+	phone := models.Phone{Vendor: "yealink", Lines: []models.PhoneLine{
+		{Type: "Line", AccountNumber: 1, AdditionalInfo: `{"user_name":"101","password":"s3cret"}`},
+	}}
+	if err := m.SealLines(&phone, nil); err != nil {
+		t.Fatal(err)
+	}
+	stored := phone.Lines[0].AdditionalInfo
+	if strings.Contains(stored, "s3cret") || !strings.Contains(stored, `"user_name":"101"`) {
+		t.Fatalf("password not encrypted: %s", stored)
+	}
+
+	if opened, err := m.OpenPhone(phone); err != nil || !strings.Contains(opened.Lines[0].AdditionalInfo, `"password":"s3cret"`) {
+		t.Fatalf("not decrypted for rendering: %s (%v)", opened.Lines[0].AdditionalInfo, err)
+	}
+	if phone.Lines[0].AdditionalInfo != stored {
+		t.Fatal("OpenPhone changed the stored phone")
+	}
+	if values, err := m.SecretValues(phone); err != nil || len(values) != 1 || values[0] != "s3cret" {
+		t.Fatalf("unexpected secret values %v (%v)", values, err)
+	}
+
+	// Another master key: an error, not an empty password
+	otherBox, err := secrets.LoadKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &Manager{Secrets: otherBox, Vendors: m.Vendors}
+	if _, err := other.OpenPhone(phone); err == nil {
+		t.Fatal("expected an error for a password encrypted with another key")
+	}
+
+	masked := phone
+	masked.Lines = append([]models.PhoneLine(nil), phone.Lines...)
+	m.MaskPhone(&masked)
+	if !strings.Contains(masked.Lines[0].AdditionalInfo, `"password":"`+secrets.Mask+`"`) {
+		t.Fatalf("not masked: %s", masked.Lines[0].AdditionalInfo)
+	}
+
+	// The masked value sent back keeps the stored password
+	if err := m.SealLines(&masked, phone.Lines); err != nil {
+		t.Fatal(err)
+	}
+	if masked.Lines[0].AdditionalInfo != stored {
+		t.Fatalf("masked password not kept: %s", masked.Lines[0].AdditionalInfo)
+	}
+}
@@ -1,14 +1,18 @@
 package provisioner
 
 type VendorConfig struct {
-	ID                  string   `yaml:"id"`
-	Name                string   `yaml:"name"`
-	StaticDir           string   `yaml:"static_dir"`            // Директория со статикой (относительно vendor.yaml)
-	PhoneConfigFile     string   `yaml:"phone_config_file"`     // Шаблон имени файла конфига телефона (например: "{{account.mac_address}}.cfg")
-	PhoneConfigTemplate string   `yaml:"phone_config_template"` // Путь к шаблону конфига телефона (относительно vendor.yaml)
-	FeaturesFile        string   `yaml:"features_file"`         // Путь к файлу с описанием функций (относительно vendor.yaml)
-	AccountsFile        string   `yaml:"accounts_file"`         // Путь к файлу с описанием аккаунтов (относительно vendor.yaml)
-	KeyTypes            []string `yaml:"key_types"`             // Список типов кнопок
+	ID                  string            `yaml:"id"`
+	Name                string            `yaml:"name"`
+	StaticDir           string            `yaml:"static_dir"`            // Директория со статикой (относительно vendor.yaml)
+	PhoneConfigFile     string            `yaml:"phone_config_file"`     // Шаблон имени файла конфига телефона (например: "{{account.mac_address}}.cfg")
+	PhoneConfigTemplate string            `yaml:"phone_config_template"` // Путь к шаблону конфига телефона (относительно vendor.yaml)
+	FeaturesFile        string            `yaml:"features_file"`         // Путь к файлу с описанием функций (относительно vendor.yaml)
+	AccountsFile        string            `yaml:"accounts_file"`         // Путь к файлу с описанием аккаунтов (относительно vendor.yaml)
+	KeyTypes            []string          `yaml:"key_types"`             // Список типов кнопок
+	Notify              Notify            `yaml:"notify"`                // SIP NOTIFY для resync/reboot
+	Actions             []RemoteAction    `yaml:"actions"`               // Действия по HTTP (action URI): reboot, factory_reset, screenshot
+	Variables           map[string]string `yaml:"variables"`             // Переменные шаблонов уровня вендора (см. internal/variables)
+	RawConfig           RawConfig         `yaml:"raw_config"`            // Как добавлять Phone.RawConfig в конфиг телефона
 
 	// Внутренние поля
 	Dir      string    `yaml:"-"`
@@ -16,6 +20,45 @@ type VendorConfig struct {
 	Accounts []Feature `yaml:"-" json:"accounts"`
 }
 
+// Notify — SIP NOTIFY, по которому телефон перечитывает конфигурацию или перезагружается
+type Notify struct {
+	Port   int               `yaml:"port" json:"port"`     // SIP port of the phones, default 5060
+	Events map[string]string `yaml:"events" json:"events"` // Action (resync, reboot) -> Event header
+}
+
+// DefaultNotifyEvents are used for actions the vendor does not define
+var DefaultNotifyEvents = map[string]string{
+	"resync": "check-sync",
+	"reboot": "check-sync;reboot=true",
+}
+
+// NotifyEvent returns the Event header for the action, false if the action is unknown
+func (n Notify) NotifyEvent(action string) (string, bool) {
+	if event, ok := n.Events[action]; ok && event != "" {
+		return event, true
+	}
+	event, ok := DefaultNotifyEvents[action]
+	return event, ok
+}
+
+// RemoteAction — действие, выполняемое на телефоне по HTTP (action URI).
+// URL, Body, Username и Password — шаблоны pongo2 с контекстом account (как в phone_config_file,
+// плюс account.address — адрес телефона) и variables (переменные телефона, см. internal/variables).
+type RemoteAction struct {
+	ID          string `yaml:"id" json:"id"` // reboot, factory_reset, screenshot...
+	Name        string `yaml:"name" json:"name"`
+	Method      string `yaml:"method" json:"method"` // Default GET
+	URL         string `yaml:"url" json:"url"`       // e.g. "http://{{ account.address }}/servlet?key=Reboot"
+	Body        string `yaml:"body" json:"body,omitempty"`
+	ContentType string `yaml:"content_type" json:"content_type,omitempty"`
+	Auth        string `yaml:"auth" json:"auth"` // none (default), basic (https only), digest. Actions with auth need Phone.IPAddress
+	Username    string `yaml:"username" json:"-"`
+	Password    string `yaml:"password" json:"-"`
+	Result      string `yaml:"result" json:"result"`   // status (default) or file: the response body is returned (screenshots)
+	Timeout     string `yaml:"timeout" json:"timeout"` // Go duration, default 10s
+	Confirm     bool   `yaml:"confirm" json:"confirm"` // Destructive action, must be confirmed by the caller
+}
+
 type Feature struct {
 	ID                    string         `yaml:"id" json:"id"`
 	Name                  string         `yaml:"name" json:"name"`
@@ -33,6 +76,7 @@ type FeatureParam struct {
 	ID             string                 `yaml:"id" json:"id"`
 	Label          string                 `yaml:"label" json:"label"`
 	Type           string                 `yaml:"type" json:"type"`                           // string, select, boolean, etc.
+	Secret         bool                   `yaml:"secret,omitempty" json:"secret,omitempty"`   // Encrypted in the DB, masked in API responses (passwords)
 	Value          string                 `yaml:"value,omitempty" json:"value,omitempty"`     // Fixed value if any
 	ConfigTemplate string                 `yaml:"config_template" json:"config_template"`     // Template line
 	Source         string                 `yaml:"source,omitempty" json:"source,omitempty"`   // e.g. "lines" for select source
@@ -58,13 +102,15 @@ type DeviceModel struct {
 	Keys                      []ModelKey          `yaml:"keys" json:"keys"`
 	KeyTypes                  []KeyType           `yaml:"key_types" json:"key_types"`
 	Settings                  []ModelSettingGroup `yaml:"settings" json:"settings"`
+	Variables                 map[string]string   `yaml:"variables" json:"variables,omitempty"` // Template variables of the model, override vendor variables
 }
 
 type KeyType struct {
-	ID      string `yaml:"id" json:"id"`
-	Verbose string `yaml:"verbose" json:"verbose"`
-	Polygon string `yaml:"polygon" json:"polygon"`
-	Image   string `yaml:"image" json:"image"`
+	ID       string   `yaml:"id" json:"id"`
+	Verbose  string   `yaml:"verbose" json:"verbose"`
+	Polygon  string   `yaml:"polygon" json:"polygon"`
+	Image    string   `yaml:"image" json:"image"`
+	Features []string `yaml:"features" json:"features,omitempty"` // Line types allowed on keys of this type ("Line", feature ids). Empty - any button feature
 }
 
 type ModelKey struct {
@@ -0,0 +1,314 @@
+package remoteaction
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"provisioning-system/internal/macaddr"
+	"provisioning-system/internal/provisioner"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+
+	maxFileSize   = 10 << 20 // Screenshots
+	maxStatusBody = 4096
+)
+
+// HTTPAction is the generic plugin: one HTTP request described in vendor.yaml
+type HTTPAction struct {
+	Action provisioner.RemoteAction
+	Client *http.Client // Optional, for tests
+}
+
+func NewHTTPAction(action provisioner.RemoteAction) *HTTPAction {
+	if action.Method == "" {
+		action.Method = http.MethodGet
+	}
+	if action.Auth == "" {
+		action.Auth = "none"
+	}
+	if action.Result == "" {
+		action.Result = ResultStatus
+	}
+	if action.Name == "" {
+		action.Name = action.ID
+	}
+	return &HTTPAction{Action: action}
+}
+
+func (a *HTTPAction) Spec() provisioner.RemoteAction {
+	return a.Action
+}
+
+// templateContext is the same "account" as for phone_config_file, plus the phone address and variables
+func templateContext(target Target) pongo2.Context {
+	phone := target.Phone
+	mac := ""
+	if phone.MacAddress != nil {
+		mac = macaddr.Plain(*phone.MacAddress)
+	}
+	number := ""
+	if phone.PhoneNumber != nil {
+		number = *phone.PhoneNumber
+	}
+
+	variables := make(map[string]interface{}, len(target.Vars))
+	for k, v := range target.Vars {
+		variables[k] = v
+	}
+
+	return pongo2.Context{
+		"account": map[string]interface{}{
+			"id":           phone.ID,
+			"domain":       phone.Domain,
+			"vendor":       phone.Vendor,
+			"model_id":     phone.ModelID,
+			"mac_address":  mac,
+			"phone_number": number,
+			"ip_address":   phone.IPAddress,
+			"type":         phone.Type,
+			"address":      target.Address,
+		},
+		"variables": variables,
+	}
+}
+
+func render(name, text string, ctx pongo2.Context) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tpl, err := pongo2.FromString(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	out, err := tpl.Execute(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute %s template: %w", name, err)
+	}
+	return out, nil
+}
+
+func (a *HTTPAction) Run(ctx context.Context, target Target) (*Result, error) {
+	res := &Result{}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	if target.Address == "" {
+		return res, fmt.Errorf("phone has no address")
+	}
+	// The admin credentials go only to an address set by the administrator,
+	// not to the source address of the last config request (any device can make one)
+	if a.Action.Auth != "none" && target.Phone.IPAddress == "" {
+		return res, fmt.Errorf("action %q sends credentials: set the phone IP address", a.Action.ID)
+	}
+
+	tctx := templateContext(target)
+	rawURL, err := render("url", a.Action.URL, tctx)
+	if err != nil {
+		return res, err
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return res, fmt.Errorf("invalid action URL %q", rawURL)
+	}
+	u.User = nil
+	res.URL = u.String()
+	if a.Action.Auth == "basic" && u.Scheme != "https" {
+		return res, fmt.Errorf("basic auth over http sends the password in clear, use digest or https")
+	}
+
+	body, err := render("body", a.Action.Body, tctx)
+	if err != nil {
+		return res, err
+	}
+	username, err := render("username", a.Action.Username, tctx)
+	if err != nil {
+		return res, err
+	}
+	password, err := render("password", a.Action.Password, tctx)
+	if err != nil {
+		return res, err
+	}
+
+	timeout := defaultTimeout
+	if d, err := time.ParseDuration(a.Action.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, strings.ToUpper(a.Action.Method), res.URL, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if a.Action.ContentType != "" {
+			req.Header.Set("Content-Type", a.Action.ContentType)
+		}
+		req.Header.Set("User-Agent", "provisioning-system")
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return res, err
+	}
+	switch a.Action.Auth {
+	case "none":
+	case "basic":
+		req.SetBasicAuth(username, password)
+	case "digest":
+	default:
+		return res, fmt.Errorf("unknown auth %q", a.Action.Auth)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return res, err
+	}
+
+	// Digest: answer the challenge once
+	if a.Action.Auth == "digest" && resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxStatusBody))
+		resp.Body.Close()
+
+		req, err = newRequest()
+		if err != nil {
+			return res, err
+		}
+		authorization, err := digestAuthorization(challenge, req.Method, req.URL.RequestURI(), username, password)
+		if err != nil {
+			return res, err
+		}
+		req.Header.Set("Authorization", authorization)
+		if resp, err = client.Do(req); err != nil {
+			return res, err
+		}
+	}
+	defer resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	res.ContentType = resp.Header.Get("Content-Type")
+
+	limit := int64(maxStatusBody)
+	if a.Action.Result == ResultFile {
+		limit = maxFileSize
+	}
+	res.Body, err = io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return res, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return res, fmt.Errorf("phone responded %s", resp.Status)
+	}
+	return res, nil
+}
+
+// digestAuthorization answers an RFC 7616 Digest challenge (MD5 or SHA-256, qop auth or none)
+func digestAuthorization(challenge, method, uri, username, password string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "digest ") {
+		return "", fmt.Errorf("phone did not ask for digest authentication")
+	}
+	params := parseChallenge(challenge[len("digest "):])
+
+	var newHash func() hash.Hash
+	algorithm := params["algorithm"]
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := h(username + ":" + realm + ":" + password)
+	ha2 := h(method + ":" + uri)
+
+	var sb bytes.Buffer
+	fmt.Fprintf(&sb, `Digest username="%s", realm="%s", nonce="%s", uri="%s"`, username, realm, nonce, uri)
+
+	qop := ""
+	for _, q := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if qop != "" {
+		cnonceBytes := make([]byte, 8)
+		rand.Read(cnonceBytes)
+		cnonce := hex.EncodeToString(cnonceBytes)
+		nc := "00000001"
+		response := h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+		fmt.Fprintf(&sb, `, qop=%s, nc=%s, cnonce="%s", response="%s"`, qop, nc, cnonce, response)
+	} else {
+		fmt.Fprintf(&sb, `, response="%s"`, h(ha1+":"+nonce+":"+ha2))
+	}
+	if algorithm != "" {
+		fmt.Fprintf(&sb, `, algorithm=%s`, algorithm)
+	}
+	if opaque, ok := params["opaque"]; ok {
+		fmt.Fprintf(&sb, `, opaque="%s"`, opaque)
+	}
+	return sb.String(), nil
+}
+
+// parseChallenge splits `realm="x", nonce="y", qop="auth,auth-int"` into a map
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+	return params
+}
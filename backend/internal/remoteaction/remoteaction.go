@@ -0,0 +1,93 @@
+// Package remoteaction runs vendor-specific actions (reboot, factory reset, screenshot) against phones.
+// Actions are plugins: the generic HTTP plugin is driven by the actions list of vendor.yaml,
+// Go plugins can be registered for anything that needs code.
+package remoteaction
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+// Result modes of an action
+const (
+	ResultStatus = "status"
+	ResultFile   = "file"
+)
+
+// Target is the phone an action runs against
+type Target struct {
+	Phone   models.Phone
+	Address string            // Phone address (IP or host[:port])
+	Vars    map[string]string // Effective variables of the phone (see internal/variables)
+}
+
+// Result of an action
+type Result struct {
+	URL         string // Request URL without credentials
+	StatusCode  int    // HTTP status of the phone response
+	ContentType string // File results
+	Body        []byte // File results, and the beginning of the response for status results
+	Duration    time.Duration
+}
+
+// Plugin is a remote action of a vendor
+type Plugin interface {
+	// Spec describes the action (id, name, whether it must be confirmed, result mode)
+	Spec() provisioner.RemoteAction
+	// Run executes the action. A non-2xx response of the phone is an error.
+	Run(ctx context.Context, target Target) (*Result, error)
+}
+
+// Factory creates a Go plugin for a vendor
+type Factory func(vendor provisioner.VendorConfig) Plugin
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]map[string]Factory{} // vendor id -> action id -> factory
+)
+
+// Register adds a Go plugin for the vendor. It replaces a vendor.yaml action with the same id.
+func Register(vendorID, actionID string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if registry[vendorID] == nil {
+		registry[vendorID] = map[string]Factory{}
+	}
+	registry[vendorID][actionID] = factory
+}
+
+// For returns the actions of the vendor ordered by id: vendor.yaml actions and registered Go plugins
+func For(vendor provisioner.VendorConfig) []Plugin {
+	plugins := map[string]Plugin{}
+	for _, action := range vendor.Actions {
+		plugins[action.ID] = NewHTTPAction(action)
+	}
+
+	mu.RLock()
+	for id, factory := range registry[vendor.ID] {
+		plugins[id] = factory(vendor)
+	}
+	mu.RUnlock()
+
+	result := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Spec().ID < result[j].Spec().ID })
+	return result
+}
+
+// Find returns the action of the vendor with the given id
+func Find(vendor provisioner.VendorConfig, actionID string) (Plugin, bool) {
+	for _, p := range For(vendor) {
+		if p.Spec().ID == actionID {
+			return p, true
+		}
+	}
+	return nil, false
+}
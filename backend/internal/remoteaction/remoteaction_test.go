@@ -0,0 +1,154 @@
+package remoteaction
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"provisioning-system/internal/models"
+	"provisioning-system/internal/provisioner"
+)
+
+func testTarget(srv *httptest.Server) Target {
+	mac := "00:15:65:aa:bb:cc"
+	return Target{
+		Phone:   models.Phone{ID: 7, Domain: "office", Vendor: "yealink", MacAddress: &mac, IPAddress: "127.0.0.1"},
+		Address: srv.Listener.Addr().String(),
+		Vars:    map[string]string{"phone_admin_password": "secret"},
+	}
+}
+
+func TestHTTPActionBasic(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("key") != "Reboot" || r.URL.Query().Get("mac") != "001565aabbcc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	action := NewHTTPAction(provisioner.RemoteAction{
+		ID:       "reboot",
+		URL:      "https://{{ account.address }}/servlet?key=Reboot&mac={{ account.mac_address }}",
+		Auth:     "basic",
+		Username: `{{ variables.phone_admin_user|default:"admin" }}`,
+		Password: "{{ variables.phone_admin_password }}",
+	})
+	action.Client = srv.Client()
+	res, err := action.Run(context.Background(), testTarget(srv))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.URL, srv.URL+"/servlet") {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	// Credentials go only to the configured phone address
+	target := testTarget(srv)
+	target.Phone.IPAddress = ""
+	if _, err := action.Run(context.Background(), target); err == nil {
+		t.Fatal("expected an error for a phone without IP address")
+	}
+
+	// Basic auth is never sent over plain http
+	plain := *action
+	plain.Action.URL = "http://{{ account.address }}/servlet?key=Reboot"
+	if res, err := plain.Run(context.Background(), testTarget(srv)); err == nil || res.StatusCode != 0 {
+		t.Fatalf("expected basic auth over http to be refused before the request: %v %+v", err, res)
+	}
+
+	// Wrong password is an error
+	action.Action.Password = "wrong"
+	if _, err := action.Run(context.Background(), testTarget(srv)); err == nil {
+		t.Fatal("expected an error for 401")
+	}
+}
+
+func TestHTTPActionDigest(t *testing.T) {
+	const realm, nonce = "phone", "abc123"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth", opaque="xyz"`, realm, nonce))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := parseChallenge(strings.TrimPrefix(auth, "Digest "))
+		h := func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) }
+		ha1 := h("admin:" + realm + ":secret")
+		ha2 := h(r.Method + ":" + p["uri"])
+		want := h(strings.Join([]string{ha1, nonce, p["nc"], p["cnonce"], p["qop"], ha2}, ":"))
+		if p["response"] != want || p["opaque"] != "xyz" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/bmp")
+		w.Write([]byte("BMimage"))
+	}))
+	defer srv.Close()
+
+	action := NewHTTPAction(provisioner.RemoteAction{
+		ID:       "screenshot",
+		URL:      "http://{{ account.address }}/screen.bmp",
+		Auth:     "digest",
+		Username: "admin",
+		Password: "{{ variables.phone_admin_password }}",
+		Result:   ResultFile,
+	})
+	res, err := action.Run(context.Background(), testTarget(srv))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if string(res.Body) != "BMimage" || res.ContentType != "image/bmp" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+type testPlugin struct{}
+
+func (testPlugin) Spec() provisioner.RemoteAction {
+	return provisioner.RemoteAction{ID: "reboot", Name: "Go reboot"}
+}
+
+func (testPlugin) Run(ctx context.Context, target Target) (*Result, error) {
+	return &Result{}, nil
+}
+
+func TestForOverride(t *testing.T) {
+	vendor := provisioner.VendorConfig{ID: "test-vendor", Actions: []provisioner.RemoteAction{
+		{ID: "screenshot", URL: "http://{{ account.address }}/s"},
+		{ID: "reboot", URL: "http://{{ account.address }}/r"},
+	}}
+	mu.Lock()
+	saved := registry
+	registry = map[string]map[string]Factory{}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		registry = saved
+		mu.Unlock()
+	})
+	Register("test-vendor", "reboot", func(provisioner.VendorConfig) Plugin { return testPlugin{} })
+
+	plugins := For(vendor)
+	if len(plugins) != 2 || plugins[0].Spec().ID != "reboot" || plugins[1].Spec().ID != "screenshot" {
+		t.Fatalf("unexpected plugins %v", plugins)
+	}
+	if plugins[0].Spec().Name != "Go reboot" {
+		t.Fatalf("registered plugin must replace the vendor.yaml action")
+	}
+	if p, ok := Find(vendor, "screenshot"); !ok || p.Spec().Method != http.MethodGet {
+		t.Fatalf("screenshot: %v %v", p, ok)
+	}
+}
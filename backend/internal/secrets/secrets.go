@@ -0,0 +1,114 @@
+// Package secrets encrypts secret values (SIP passwords...) stored in the database with AES-256-GCM.
+// The master key is kept in <config dir>/master.key and never leaves the server: it is excluded
+// from support bundles, so database copies only contain ciphertext.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// KeyFile is the name of the master key file in the config dir
+	KeyFile = "master.key"
+
+	// Mask replaces secret values in API responses. A masked value sent back keeps the stored value.
+	Mask = "********"
+
+	prefix  = "enc:v1:"
+	keySize = 32
+)
+
+// Box encrypts and decrypts values with the master key. A nil *Box stores values as is.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// LoadKey reads the master key from the config dir, a new key is generated on the first start
+func LoadKey(configDir string) (*Box, error) {
+	path := filepath.Join(configDir, KeyFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write master key: %w", err)
+		}
+		return NewBox(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key %s: %w", path, err)
+	}
+	return NewBox(key)
+}
+
+// IsEncrypted reports whether the value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt returns the encrypted value. Empty and already encrypted values are returned as is.
+func (b *Box) Encrypt(plain string) (string, error) {
+	if b == nil || plain == "" || IsEncrypted(plain) {
+		return plain, nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plain value. Values that are not encrypted (stored before encryption was enabled) are returned as is.
+func (b *Box) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if b == nil {
+		return "", errors.New("encrypted value but no master key")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	size := b.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plain, err := b.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value (wrong master key?): %w", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBox(t *testing.T) {
+	dir := t.TempDir()
+	box, err := LoadKey(dir)
+	if err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, KeyFile)); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("master key not created with 0600: %v", err)
+	}
+
+	enc, err := box.Encrypt("s3cret")
+	if err != nil || !IsEncrypted(enc) || enc == "s3cret" {
+		t.Fatalf("unexpected encrypted value %q: %v", enc, err)
+	}
+	if again, _ := box.Encrypt(enc); again != enc {
+		t.Fatal("encrypted value must not be encrypted twice")
+	}
+
+	// The key is read back on the next start
+	reloaded, err := LoadKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := reloaded.Decrypt(enc); err != nil || plain != "s3cret" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if plain, err := reloaded.Decrypt("legacy"); err != nil || plain != "legacy" {
+		t.Fatalf("plain values must be returned as is, got %q, %v", plain, err)
+	}
+
+	other, _ := LoadKey(t.TempDir())
+	if _, err := other.Decrypt(enc); err == nil {
+		t.Fatal("decrypted with a wrong key")
+	}
+	var none *Box
+	if v, _ := none.Encrypt("x"); v != "x" {
+		t.Fatal("nil box must store values as is")
+	}
+}
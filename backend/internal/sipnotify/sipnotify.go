@@ -0,0 +1,218 @@
+// Package sipnotify sends unsolicited SIP NOTIFY requests (check-sync and vendor variants)
+// that make phones re-read their configuration or reboot.
+package sipnotify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPort    = 5060
+	DefaultTimeout = 4 * time.Second
+
+	// RFC 3261 timer T1 and T2: retransmit after 500ms, doubling up to 4s
+	t1 = 500 * time.Millisecond
+	t2 = 4 * time.Second
+
+	maxMessageSize = 65535
+)
+
+// Request is one NOTIFY to send
+type Request struct {
+	Host    string        // Phone IP address or host name
+	Port    int           // Default 5060
+	User    string        // User part of the Request-URI (SIP account of the phone), may be empty
+	Event   string        // Event header, e.g. "check-sync" or "check-sync;reboot=true"
+	Timeout time.Duration // Overall time to wait for a final response, default DefaultTimeout
+}
+
+// Result is the outcome of a NOTIFY
+type Result struct {
+	Address    string        `json:"address"` // host:port the NOTIFY was sent to
+	Event      string        `json:"event"`
+	StatusCode int           `json:"status_code,omitempty"` // Final SIP response code, 0 if none received
+	Reason     string        `json:"reason,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Success reports whether the phone accepted the NOTIFY (2xx response)
+func (r Result) Success() bool {
+	return r.Error == "" && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send sends a NOTIFY over UDP and waits for the final response, retransmitting like a SIP non-INVITE client transaction.
+// The returned error is also stored in Result.Error.
+func Send(ctx context.Context, req Request) (Result, error) {
+	if req.Port == 0 {
+		req.Port = DefaultPort
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = DefaultTimeout
+	}
+
+	addr := net.JoinHostPort(req.Host, strconv.Itoa(req.Port))
+	res := Result{Address: addr, Event: req.Event}
+	start := time.Now()
+
+	fail := func(err error) (Result, error) {
+		res.Duration = time.Since(start)
+		res.Error = err.Error()
+		return res, err
+	}
+
+	if req.Host == "" {
+		return fail(errors.New("no address to send NOTIFY to"))
+	}
+	if req.Event == "" {
+		return fail(errors.New("no event for NOTIFY"))
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fail(err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return fail(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	branch := "z9hG4bK" + randomHex(8)
+	msg := buildNotify(req, conn.LocalAddr().(*net.UDPAddr), branch)
+
+	buf := make([]byte, maxMessageSize)
+	interval := t1
+	for {
+		if _, err := conn.Write(msg); err != nil {
+			return fail(err)
+		}
+
+		// Wait for a response until the next retransmission
+		next := time.Now().Add(interval)
+		if next.After(deadline) {
+			next = deadline
+		}
+		for {
+			conn.SetReadDeadline(next)
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				// ICMP port unreachable and the like
+				return fail(err)
+			}
+			code, reason, ok := parseResponse(buf[:n], branch)
+			if !ok || code < 200 {
+				continue // Not ours or provisional
+			}
+			res.StatusCode = code
+			res.Reason = reason
+			res.Duration = time.Since(start)
+			if code >= 300 {
+				err := fmt.Errorf("phone rejected NOTIFY: %d %s", code, reason)
+				res.Error = err.Error()
+				return res, err
+			}
+			return res, nil
+		}
+
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("no response from %s within %s", addr, req.Timeout))
+		}
+		interval *= 2
+		if interval > t2 {
+			interval = t2
+		}
+	}
+}
+
+func buildNotify(req Request, local *net.UDPAddr, branch string) []byte {
+	target := req.Host
+	if strings.Contains(target, ":") {
+		target = "[" + target + "]" // IPv6
+	}
+	uri := fmt.Sprintf("sip:%s:%d", target, req.Port)
+	if req.User != "" {
+		uri = fmt.Sprintf("sip:%s@%s:%d", req.User, target, req.Port)
+	}
+	localHost := local.IP.String()
+	if local.IP.To4() == nil {
+		localHost = "[" + localHost + "]"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "NOTIFY %s SIP/2.0\r\n", uri)
+	fmt.Fprintf(&sb, "Via: SIP/2.0/UDP %s:%d;branch=%s;rport\r\n", localHost, local.Port, branch)
+	sb.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&sb, "From: <sip:provisioning@%s>;tag=%s\r\n", localHost, randomHex(4))
+	fmt.Fprintf(&sb, "To: <%s>\r\n", uri)
+	fmt.Fprintf(&sb, "Call-ID: %s@%s\r\n", randomHex(12), localHost)
+	sb.WriteString("CSeq: 1 NOTIFY\r\n")
+	fmt.Fprintf(&sb, "Contact: <sip:provisioning@%s:%d>\r\n", localHost, local.Port)
+	fmt.Fprintf(&sb, "Event: %s\r\n", req.Event)
+	sb.WriteString("Subscription-State: terminated;reason=timeout\r\n")
+	sb.WriteString("User-Agent: provisioning-system\r\n")
+	sb.WriteString("Content-Length: 0\r\n\r\n")
+	return []byte(sb.String())
+}
+
+// parseResponse returns the status of a SIP response matching our transaction (Via branch and CSeq method)
+func parseResponse(data []byte, branch string) (int, string, bool) {
+	lines := strings.Split(string(data), "\r\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "SIP/2.0 ") {
+		return 0, "", false
+	}
+
+	status := strings.SplitN(strings.TrimPrefix(lines[0], "SIP/2.0 "), " ", 2)
+	code, err := strconv.Atoi(status[0])
+	if err != nil {
+		return 0, "", false
+	}
+	reason := ""
+	if len(status) > 1 {
+		reason = status[1]
+	}
+
+	matchedBranch, matchedCSeq := false, false
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "via", "v":
+			if strings.Contains(value, "branch="+branch) {
+				matchedBranch = true
+			}
+		case "cseq":
+			if strings.HasSuffix(strings.TrimSpace(value), "NOTIFY") {
+				matchedCSeq = true
+			}
+		}
+	}
+	return code, reason, matchedBranch && matchedCSeq
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
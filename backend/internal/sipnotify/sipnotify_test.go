@@ -0,0 +1,104 @@
+package sipnotify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// standIn is a local UDP "phone": it drops the first `drop` requests, then answers 100 Trying and the final code
+func standIn(t *testing.T, drop int, code string) (*net.UDPConn, <-chan string) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			msg := string(buf[:n])
+			received <- msg
+			if drop > 0 {
+				drop--
+				continue
+			}
+			if code == "" {
+				continue
+			}
+
+			// Echo Via, From, To, Call-ID, CSeq
+			var headers []string
+			for _, line := range strings.Split(msg, "\r\n")[1:] {
+				for _, h := range []string{"Via:", "From:", "To:", "Call-ID:", "CSeq:"} {
+					if strings.HasPrefix(line, h) {
+						headers = append(headers, line)
+					}
+				}
+			}
+			reply := func(status string) {
+				resp := "SIP/2.0 " + status + "\r\n" + strings.Join(headers, "\r\n") + "\r\nContent-Length: 0\r\n\r\n"
+				conn.WriteToUDP([]byte(resp), from)
+			}
+			reply("100 Trying")
+			reply(code)
+		}
+	}()
+	return conn, received
+}
+
+func TestSend(t *testing.T) {
+	conn, received := standIn(t, 1, "200 OK")
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	res, err := Send(context.Background(), Request{Host: "127.0.0.1", Port: port, User: "101", Event: "check-sync;reboot=false"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !res.Success() || res.StatusCode != 200 || res.Reason != "OK" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	msg := <-received
+	for _, want := range []string{"NOTIFY sip:101@127.0.0.1:", "Event: check-sync;reboot=false\r\n", "CSeq: 1 NOTIFY\r\n", "Subscription-State: terminated"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("request has no %q:\n%s", want, msg)
+		}
+	}
+	// The first request was dropped, so it was retransmitted
+	if len(received) != 1 {
+		t.Errorf("expected one retransmission, got %d", len(received))
+	}
+}
+
+func TestSendRejected(t *testing.T) {
+	conn, _ := standIn(t, 0, "489 Bad Event")
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	res, err := Send(context.Background(), Request{Host: "127.0.0.1", Port: port, Event: "resync"})
+	if err == nil || res.Success() || res.StatusCode != 489 {
+		t.Errorf("expected rejection, got %+v, %v", res, err)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	conn, _ := standIn(t, 0, "")
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	start := time.Now()
+	res, err := Send(context.Background(), Request{Host: "127.0.0.1", Port: port, Event: "check-sync", Timeout: 700 * time.Millisecond})
+	if err == nil || res.StatusCode != 0 {
+		t.Errorf("expected timeout, got %+v", res)
+	}
+	if d := time.Since(start); d < 600*time.Millisecond || d > 2*time.Second {
+		t.Errorf("unexpected duration %s", d)
+	}
+}
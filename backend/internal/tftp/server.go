@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"provisioning-system/internal/accesspolicy"
 	"provisioning-system/internal/config"
 	"provisioning-system/internal/devicelogger"
 
@@ -16,18 +17,20 @@ import (
 )
 
 type Server struct {
-	ConfigDir    string
-	Config       *config.SystemConfig
-	DeviceLogger *devicelogger.DeviceLogger
-	isRunning    bool
-	lastError    error
+	ConfigDir     string
+	Config        *config.SystemConfig
+	DeviceLogger  *devicelogger.DeviceLogger
+	AccessChecker *accesspolicy.Checker
+	isRunning     bool
+	lastError     error
 }
 
-func NewServer(configDir string, cfg *config.SystemConfig, dl *devicelogger.DeviceLogger) *Server {
+func NewServer(configDir string, cfg *config.SystemConfig, dl *devicelogger.DeviceLogger, ac *accesspolicy.Checker) *Server {
 	return &Server{
-		ConfigDir:    configDir,
-		Config:       cfg,
-		DeviceLogger: dl,
+		ConfigDir:     configDir,
+		Config:        cfg,
+		DeviceLogger:  dl,
+		AccessChecker: ac,
 	}
 }
 
@@ -79,8 +82,19 @@ func (s *Server) readHandler(filename string, rf io.ReaderFrom) error {
 		clientIP = remoteAddr
 	}
 
+	// Access policy (only the source IP check applies to TFTP)
+	if s.AccessChecker != nil {
+		decision := s.AccessChecker.CheckTFTP("/"+cleanPath, clientIP)
+		if len(decision.Violations) > 0 {
+			s.DeviceLogger.LogAccess(clientIP, decision.Status(), "TFTP", "/"+cleanPath, "TFTP Client", decision.Message())
+			if !decision.Allowed() {
+				return fmt.Errorf("access denied")
+			}
+		}
+	}
+
 	configsDir := filepath.Join(s.ConfigDir, "temp_configs")
-	
+
 	// Fallback logic similar to HTTP server in main.go
 	var foundPath string
 	var foundDomain string
@@ -0,0 +1,80 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+
+	"provisioning-system/internal/macaddr"
+)
+
+// Info is what we can learn about a device from its User-Agent header
+type Info struct {
+	Vendor   string `json:"vendor,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	MAC      string `json:"mac,omitempty"` // Normalized (12 lowercase hex digits)
+}
+
+type vendorRule struct {
+	vendor  string
+	match   string         // Case-insensitive substring identifying the vendor
+	modelRe *regexp.Regexp // First submatch is the model
+}
+
+// Known vendor User-Agent formats, e.g.:
+//
+//	Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc
+//	Cisco/SPA504G-7.6.2b (0011223344AA)(CCQ...)
+//	Grandstream Model HW GXP2170 SW 1.0.11.3 DevId 000b82aabbcc
+//	FileTransport PolycomVVX-VVX_410-UA/5.9.0.9373
+//	Mozilla/4.0 (compatible; snom320-SIP 8.7.5.35 1.1.3-n)
+//	Aastra6731i MAC:00-08-5D-12-34-56 V:3.3.1.4305-SIP
+//	Fanvil X4 2.4.5 0c383e112233
+var vendorRules = []vendorRule{
+	{vendor: "yealink", match: "yealink", modelRe: regexp.MustCompile(`(?i)yealink\s+(?:sip[- ])?([\w-]+)`)},
+	{vendor: "cisco", match: "cisco", modelRe: regexp.MustCompile(`(?i)cisco/([a-z]+[\d]+[a-z]*)`)},
+	{vendor: "grandstream", match: "grandstream", modelRe: regexp.MustCompile(`(?i)HW\s+([\w-]+)`)},
+	{vendor: "polycom", match: "polycom", modelRe: regexp.MustCompile(`(?i)polycom\w*-([\w]+)-UA`)},
+	{vendor: "snom", match: "snom", modelRe: regexp.MustCompile(`(?i)(snom\w+)`)},
+	{vendor: "mitel", match: "aastra", modelRe: regexp.MustCompile(`(?i)aastra\s*(\w+)`)},
+	{vendor: "mitel", match: "mitel", modelRe: regexp.MustCompile(`(?i)mitel\s*(\w+)`)},
+	{vendor: "fanvil", match: "fanvil", modelRe: regexp.MustCompile(`(?i)fanvil\s+(\w+)`)},
+	{vendor: "eltex", match: "eltex", modelRe: regexp.MustCompile(`(?i)eltex[\s/_-]+(\w+)`)},
+}
+
+var firmwareRe = regexp.MustCompile(`\d+(?:\.\d+){2,}[\w-]*`)
+
+// Parse extracts vendor, model, firmware version and MAC address from a User-Agent string.
+// Unknown formats return whatever could be found (often just the MAC or nothing).
+func Parse(ua string) Info {
+	var info Info
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return info
+	}
+
+	info.MAC = macaddr.Find(ua)
+
+	lower := strings.ToLower(ua)
+	for _, rule := range vendorRules {
+		if !strings.Contains(lower, rule.match) {
+			continue
+		}
+		info.Vendor = rule.vendor
+		if m := rule.modelRe.FindStringSubmatch(ua); len(m) > 1 {
+			info.Model = m[1]
+		}
+		break
+	}
+
+	// Firmware is the first dotted version that is not part of the MAC
+	for _, v := range firmwareRe.FindAllString(ua, -1) {
+		if macaddr.Normalize(v) != "" {
+			continue
+		}
+		info.Firmware = v
+		break
+	}
+
+	return info
+}
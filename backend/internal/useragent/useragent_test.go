@@ -0,0 +1,42 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want Info
+	}{
+		{
+			ua:   "Yealink SIP-T46U 108.86.0.45 00:15:65:aa:bb:cc",
+			want: Info{Vendor: "yealink", Model: "T46U", Firmware: "108.86.0.45", MAC: "001565aabbcc"},
+		},
+		{
+			ua:   "Cisco/SPA504G-7.6.2b (0011223344AA)(CCQ154106JT)",
+			want: Info{Vendor: "cisco", Model: "SPA504G", Firmware: "7.6.2b", MAC: "0011223344aa"},
+		},
+		{
+			ua:   "Grandstream Model HW GXP2170 SW 1.0.11.3 DevId 000b82aabbcc",
+			want: Info{Vendor: "grandstream", Model: "GXP2170", Firmware: "1.0.11.3", MAC: "000b82aabbcc"},
+		},
+		{
+			ua:   "Aastra6731i MAC:00-08-5D-12-34-56 V:3.3.1.4305-SIP",
+			want: Info{Vendor: "mitel", Model: "6731i", Firmware: "3.3.1.4305-SIP", MAC: "00085d123456"},
+		},
+		{
+			ua:   "curl/8.4.0",
+			want: Info{Firmware: "8.4.0"},
+		},
+		{
+			ua:   "",
+			want: Info{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Parse(tt.ua)
+		if got != tt.want {
+			t.Errorf("Parse(%q)\n got: %+v\nwant: %+v", tt.ua, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package variables resolves template variables defined at several levels. From the lowest to the
+// highest precedence:
+//
+//	global  - variables: in provisioning-system.yaml
+//	domain  - domains[].variables
+//	vendor  - variables: in vendor.yaml
+//	model   - variables: in the model yaml
+//	group   - variables of the phone profile
+//	phone   - variables of the phone
+//
+// A value of a higher level replaces the value of the same name from the lower levels.
+package variables
+
+// Variable levels in the order of precedence
+const (
+	SourceGlobal = "global"
+	SourceDomain = "domain"
+	SourceVendor = "vendor"
+	SourceModel  = "model"
+	SourceGroup  = "group"
+	SourcePhone  = "phone"
+)
+
+// Precedence lists the levels from the lowest to the highest
+var Precedence = []string{SourceGlobal, SourceDomain, SourceVendor, SourceModel, SourceGroup, SourcePhone}
+
+// Layer is the variables of one level
+type Layer struct {
+	Source string // global, domain, vendor, model, group, phone
+	Name   string // Domain name, vendor id, model id, profile name; empty for global and phone
+	Values map[string]string
+}
+
+// Value is an effective variable and where it comes from
+type Value struct {
+	Value      string   `json:"value"`
+	Source     string   `json:"source"`
+	Name       string   `json:"name,omitempty"`
+	Overridden []Shadow `json:"overridden,omitempty"` // Values of lower levels replaced by this one
+}
+
+// Shadow is a value of a lower level replaced by a higher one
+type Shadow struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Resolved is the merged variables by name
+type Resolved map[string]Value
+
+// Resolve merges the layers, given from the lowest to the highest precedence
+func Resolve(layers ...Layer) Resolved {
+	result := make(Resolved)
+	for _, layer := range layers {
+		for k, v := range layer.Values {
+			value := Value{Value: v, Source: layer.Source, Name: layer.Name}
+			if prev, ok := result[k]; ok {
+				value.Overridden = append([]Shadow{{Value: prev.Value, Source: prev.Source, Name: prev.Name}}, prev.Overridden...)
+			}
+			result[k] = value
+		}
+	}
+	return result
+}
+
+// Values returns the merged values (the "variables" map of the templates)
+func (r Resolved) Values() map[string]string {
+	values := make(map[string]string, len(r))
+	for k, v := range r {
+		values[k] = v.Value
+	}
+	return values
+}
+
+// Sources returns the level each variable comes from (the "variable_sources" map of the templates)
+func (r Resolved) Sources() map[string]string {
+	sources := make(map[string]string, len(r))
+	for k, v := range r {
+		sources[k] = v.Source
+	}
+	return sources
+}
@@ -0,0 +1,29 @@
+package variables
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	r := Resolve(
+		Layer{Source: SourceGlobal, Values: map[string]string{"ntp_server": "pool.ntp.org", "lang": "English"}},
+		Layer{Source: SourceDomain, Name: "office", Values: map[string]string{"ntp_server": "10.0.0.1", "sip_server": "10.0.0.2"}},
+		Layer{Source: SourceModel, Name: "yealink-SIP-T46U", Values: nil},
+		Layer{Source: SourceGroup, Name: "Reception", Values: map[string]string{"ntp_server": "10.0.0.3"}},
+		Layer{Source: SourcePhone, Values: map[string]string{"lang": "Russian"}},
+	)
+
+	ntp := r["ntp_server"]
+	if ntp.Value != "10.0.0.3" || ntp.Source != SourceGroup || ntp.Name != "Reception" {
+		t.Fatalf("unexpected ntp_server %+v", ntp)
+	}
+	if len(ntp.Overridden) != 2 || ntp.Overridden[0].Source != SourceDomain || ntp.Overridden[1].Source != SourceGlobal {
+		t.Fatalf("overridden values must go from the nearest level, got %+v", ntp.Overridden)
+	}
+
+	values, sources := r.Values(), r.Sources()
+	if values["lang"] != "Russian" || sources["lang"] != SourcePhone {
+		t.Fatalf("phone value must win, got %q from %q", values["lang"], sources["lang"])
+	}
+	if values["sip_server"] != "10.0.0.2" || sources["sip_server"] != SourceDomain || len(values) != 3 {
+		t.Fatalf("unexpected values %v", values)
+	}
+}
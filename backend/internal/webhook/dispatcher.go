@@ -0,0 +1,334 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/logger"
+	"provisioning-system/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts before a delivery is marked as failed
+	MaxAttempts = 8
+	// Retry delays: 10s, 20s, 40s ... up to maxBackoff
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+
+	pollInterval    = 5 * time.Second
+	requestTimeout  = 10 * time.Second
+	maxResponseBody = 4096
+	retentionDays   = 30
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Provisioning-Event"
+	HeaderDelivery  = "X-Provisioning-Delivery"
+	HeaderSignature = "X-Provisioning-Signature" // "sha256=<hex HMAC of the body>"
+)
+
+// Dispatcher turns bus events into webhook deliveries and sends them with retries
+type Dispatcher struct {
+	DB     *gorm.DB
+	Events *broadcaster.Broadcaster
+	Client *http.Client
+
+	mu       sync.RWMutex
+	webhooks []models.Webhook // Enabled webhooks, cached
+	busy     map[uint]bool    // Webhooks with a running delivery worker
+	workers  sync.WaitGroup
+	wake     chan struct{}
+}
+
+func NewDispatcher(database *gorm.DB, b *broadcaster.Broadcaster) *Dispatcher {
+	return &Dispatcher{
+		DB:     database,
+		Events: b,
+		Client: &http.Client{Timeout: requestTimeout},
+		busy:   make(map[uint]bool),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start subscribes to the event bus and starts the delivery worker
+func (d *Dispatcher) Start() {
+	d.Reload()
+
+	sub := d.Events.SubscribeSink()
+	go func() {
+		for event := range sub.C {
+			d.enqueue(event)
+		}
+	}()
+
+	go d.run()
+}
+
+// Reload refreshes the cached list of enabled webhooks. Call it after webhooks are changed.
+func (d *Dispatcher) Reload() {
+	var webhooks []models.Webhook
+	if err := d.DB.Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+		logger.Error("Failed to load webhooks: %v", err)
+		return
+	}
+	d.mu.Lock()
+	d.webhooks = webhooks
+	d.mu.Unlock()
+}
+
+// NoisyEvents are sent for every device request. Webhooks get them only when subscribed explicitly.
+var NoisyEvents = []string{broadcaster.TypeDeviceAccess, broadcaster.TypeDeviceFetchFailed}
+
+// Matches reports whether the webhook is subscribed to the event.
+// Without explicit event types a webhook gets everything except NoisyEvents.
+func Matches(hook models.Webhook, event broadcaster.Event) bool {
+	if hook.Domain != "" && event.Domain != "" && hook.Domain != event.Domain {
+		return false
+	}
+	if len(hook.Events) == 0 {
+		return !broadcaster.MatchTypes(NoisyEvents, event.Type)
+	}
+	return broadcaster.MatchTypes(hook.Events, event.Type)
+}
+
+// enqueue stores a pending delivery for every webhook subscribed to the event
+func (d *Dispatcher) enqueue(event broadcaster.Event) {
+	d.mu.RLock()
+	var targets []models.Webhook
+	for _, hook := range d.webhooks {
+		if Matches(hook, event) {
+			targets = append(targets, hook)
+		}
+	}
+	d.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode event %s for webhooks: %v", event.Type, err)
+		return
+	}
+
+	now := time.Now()
+	for _, hook := range targets {
+		delivery := models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := d.DB.Create(&delivery).Error; err != nil {
+			logger.Error("Failed to queue webhook delivery: %v", err)
+		}
+	}
+	d.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) run() {
+	poll := time.NewTicker(pollInterval)
+	prune := time.NewTicker(time.Hour)
+	defer poll.Stop()
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-d.wake:
+		case <-poll.C:
+		case <-prune.C:
+			d.prune()
+			continue
+		}
+		d.deliverDue()
+	}
+}
+
+// deliverDue sends the pending deliveries whose next attempt time has come.
+// Each webhook gets its own worker, deliveries of one webhook are sent in order:
+// a slow or dead endpoint delays only its own deliveries.
+func (d *Dispatcher) deliverDue() {
+	d.mu.RLock()
+	busy := make([]uint, 0, len(d.busy))
+	for id := range d.busy {
+		busy = append(busy, id)
+	}
+	d.mu.RUnlock()
+
+	query := d.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now())
+	if len(busy) > 0 {
+		query = query.Where("webhook_id NOT IN ?", busy)
+	}
+	var due []models.WebhookDelivery
+	if err := query.Order("id").Limit(100).Find(&due).Error; err != nil {
+		logger.Error("Failed to load webhook deliveries: %v", err)
+		return
+	}
+
+	byHook := make(map[uint][]models.WebhookDelivery)
+	for _, delivery := range due {
+		byHook[delivery.WebhookID] = append(byHook[delivery.WebhookID], delivery)
+	}
+
+	for hookID, deliveries := range byHook {
+		var hook models.Webhook
+		if err := d.DB.First(&hook, hookID).Error; err != nil {
+			// Webhook was deleted
+			for i := range deliveries {
+				deliveries[i].Status = models.DeliveryFailed
+				deliveries[i].Error = "webhook not found"
+				deliveries[i].NextAttemptAt = nil
+				d.DB.Save(&deliveries[i])
+			}
+			continue
+		}
+
+		d.mu.Lock()
+		if d.busy[hookID] {
+			d.mu.Unlock()
+			continue
+		}
+		d.busy[hookID] = true
+		d.mu.Unlock()
+
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			for i := range deliveries {
+				d.Deliver(hook, &deliveries[i])
+			}
+			d.mu.Lock()
+			delete(d.busy, hookID)
+			d.mu.Unlock()
+			d.notify() // More deliveries of the webhook may have become due meanwhile
+		}()
+	}
+}
+
+// Deliver makes one attempt to send the delivery and stores the result.
+// On failure the next attempt is scheduled with exponential backoff until MaxAttempts.
+func (d *Dispatcher) Deliver(hook models.Webhook, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	code, body, err := d.send(hook, delivery)
+	delivery.ResponseCode = code
+	delivery.ResponseBody = body
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+		logger.Warn("Webhook %d delivery %d failed after %d attempts: %v", hook.ID, delivery.ID, delivery.Attempts, err)
+	default:
+		next := now.Add(Backoff(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.DB.Save(delivery).Error; err != nil {
+		logger.Error("Failed to store webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(hook models.Webhook, delivery *models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "provisioning-system-webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	if hook.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// Redeliver queues the delivery to be sent again right away, with a fresh attempt counter
+func (d *Dispatcher) Redeliver(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := d.DB.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.Error = ""
+	if err := d.DB.Save(&delivery).Error; err != nil {
+		return nil, err
+	}
+
+	d.notify()
+	return &delivery, nil
+}
+
+// prune removes finished deliveries older than retentionDays
+func (d *Dispatcher) prune() {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	if err := d.DB.Where("status <> ? AND created_at < ?", models.DeliveryPending, cutoff).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		logger.Warn("Failed to prune webhook deliveries: %v", err)
+	}
+}
+
+// Sign returns the X-Provisioning-Signature value for body: "sha256=" + hex HMAC-SHA256
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay before the next attempt after the given number of attempts
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
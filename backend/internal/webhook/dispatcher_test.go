@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"provisioning-system/internal/broadcaster"
+	"provisioning-system/internal/db"
+	"provisioning-system/internal/models"
+)
+
+func TestDeliver(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	var calls atomic.Int32
+	var gotSignature, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// First attempt fails, the retry succeeds
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		gotSignature = r.Header.Get(HeaderSignature)
+		gotEvent = r.Header.Get(HeaderEvent)
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	hooks := []models.Webhook{
+		{URL: srv.URL, Secret: "s3cret", Events: []string{"phone.*"}, Domain: "office", Enabled: true},
+		{URL: srv.URL, Events: []string{"phone.*"}, Domain: "branch", Enabled: true},
+		{URL: srv.URL, Enabled: false},
+	}
+	if err := database.Create(&hooks).Error; err != nil {
+		t.Fatalf("Failed to create webhooks: %v", err)
+	}
+
+	d := NewDispatcher(database, broadcaster.New())
+	d.Reload()
+	d.enqueue(broadcaster.Event{ID: 7, Type: broadcaster.TypePhoneCreated, Domain: "office", Time: time.Now()})
+	d.enqueue(broadcaster.Event{ID: 8, Type: broadcaster.TypeBackupCreated, Time: time.Now()})
+
+	var deliveries []models.WebhookDelivery
+	database.Find(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].WebhookID != hooks[0].ID || deliveries[0].EventID != 7 {
+		t.Fatalf("expected one delivery for webhook %d, got %+v", hooks[0].ID, deliveries)
+	}
+
+	// First attempt: 503, retry is scheduled
+	d.deliverDue()
+	d.workers.Wait()
+	var delivery models.WebhookDelivery
+	database.First(&delivery, deliveries[0].ID)
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.ResponseCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected delivery after failed attempt: %+v", delivery)
+	}
+	if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(time.Now().Add(baseBackoff/2)) {
+		t.Fatalf("retry is not delayed: %v", delivery.NextAttemptAt)
+	}
+
+	// Not due yet
+	d.deliverDue()
+	d.workers.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("delivery retried before backoff elapsed")
+	}
+
+	// Redeliver sends it right away
+	if _, err := d.Redeliver(delivery.ID); err != nil {
+		t.Fatalf("Redeliver failed: %v", err)
+	}
+	d.deliverDue()
+	d.workers.Wait()
+	database.First(&delivery, delivery.ID)
+	if delivery.Status != models.DeliverySucceeded || delivery.DeliveredAt == nil {
+		t.Fatalf("unexpected delivery after redeliver: %+v", delivery)
+	}
+
+	if gotEvent != broadcaster.TypePhoneCreated {
+		t.Errorf("unexpected %s header %q", HeaderEvent, gotEvent)
+	}
+	if gotSignature != Sign("s3cret", gotBody) {
+		t.Errorf("signature mismatch: %q", gotSignature)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		4:  80 * time.Second,
+		20: time.Hour,
+	}
+	for attempts, want := range tests {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestDeliverConcurrently(t *testing.T) {
+	database, err := db.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to init db: %v", err)
+	}
+
+	release := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer dead.Close()
+	delivered := make(chan string, 1)
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- r.Header.Get(HeaderEvent)
+	}))
+	defer alive.Close()
+
+	hooks := []models.Webhook{
+		{URL: dead.URL, Enabled: true},
+		{URL: alive.URL, Enabled: true},
+	}
+	database.Create(&hooks)
+
+	d := NewDispatcher(database, broadcaster.New())
+	defer func() {
+		close(release)
+		d.workers.Wait()
+	}()
+	d.Reload()
+	// Not subscribed explicitly: no device request events
+	d.enqueue(broadcaster.Event{ID: 1, Type: broadcaster.TypeDeviceFetchFailed, Time: time.Now()})
+	d.enqueue(broadcaster.Event{ID: 2, Type: broadcaster.TypePhoneCreated, Time: time.Now()})
+
+	var count int64
+	database.Model(&models.WebhookDelivery{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected a phone.created delivery per webhook, got %d deliveries", count)
+	}
+
+	// The hanging endpoint does not hold up the other webhook
+	d.deliverDue()
+	select {
+	case event := <-delivered:
+		if event != broadcaster.TypePhoneCreated {
+			t.Errorf("unexpected event %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery blocked by a hanging webhook")
+	}
+}
@@ -121,4 +121,7 @@
   </dialpatterntemplate0>
 </dialpatterntemplate>
 </gateway>
+{%- if raw_config %}
+{{ raw_config|safe }}
+{%- endif %}
 </ta>
@@ -13,4 +13,14 @@
        </Entry>
     {%- endfor %}
   {%- endfor %}
-{%- endfor %}
\ No newline at end of file
+{%- endfor %}
+{%- for entry in directory %}
+  {%- if entry.Source == "external" %}
+  <!-- Contact: {{ entry.Phonebook }} -->
+  <Entry>
+    <Name>{{ entry.Name }}</Name>
+    <Company>{{ entry.Company }}</Company>
+    <Number>{{ entry.Number }}</Number>
+  </Entry>
+  {%- endif %}
+{%- endfor %}
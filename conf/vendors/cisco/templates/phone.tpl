@@ -74,4 +74,7 @@
 {%- endif %}
 <Idle_Key_List>em_login|1;acd_login|1;acd_logout|1;avail|3;unavail|3;redial|5;dir|6;cfwd|7;|8;lcr|9;pickup|10;gpickup|11;unpark|12;em_logout</Idle_Key_List>
 <Group_Paging_Script group="Phone/Multiple_Paging_Group_Parameters"></Group_Paging_Script>
+{%- if raw_config %}
+{{ raw_config|safe }}
+{%- endif %}
 </flat-profile>
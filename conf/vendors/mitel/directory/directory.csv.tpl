@@ -1,9 +1,14 @@
-{# John,Smith,Acme Ltd.,Director of Marketing,123 Acme Rd.,Toronto,Ontario,L4K 4N9,Canada,,,,,,jsmith@acme.com,,,2,1,1,9054804321,3,1,9054801234 #}
+{# Text fields go through |csv (quoted if they hold commas or quotes): John,Smith,Acme Ltd.,Director of Marketing,123 Acme Rd.,Toronto,Ontario,L4K 4N9,Canada,,,,,,jsmith@acme.com,,,2,1,1,9054804321,3,1,9054801234 #}
 {%- for domain in all_domains -%}
 {%- for phone in domain.phones -%}
 {%- if phone.Description and phone.PhoneNumber-%}
 {%- set parts = phone.Description | split: " " -%}
-{{ parts.0 }},{{ parts.1 | default: "" }},{{ domain.variables.company | default: "" }},{{ domain.variables.job_title | default: "" }},{{ domain.variables.work_street | default: "" }},{{ domain.variables.work_city | default: "" }},{{ domain.variables.work_state | default: "" }},{{ domain.variables.work_zip | default: "" }},{{ domain.variables.work_country | default: "" }},,,,,,{{domain.variables.email | default: "" }},,,1,1,1,{{ phone.PhoneNumber }},,,,
+{{ parts.0 | csv }},{{ parts.1 | default: "" | csv }},{{ domain.variables.company | default: "" | csv }},{{ domain.variables.job_title | default: "" | csv }},{{ domain.variables.work_street | default: "" | csv }},{{ domain.variables.work_city | default: "" | csv }},{{ domain.variables.work_state | default: "" | csv }},{{ domain.variables.work_zip | default: "" | csv }},{{ domain.variables.work_country | default: "" | csv }},,,,,,{{domain.variables.email | default: "" | csv }},,,1,1,1,{{ phone.PhoneNumber | csv }},,,,
 {% endif -%}
 {%- endfor -%}
 {%- endfor -%}
+{%- for entry in directory -%}
+{%- if entry.Source == "external" and entry.Number -%}
+{{ entry.FirstName | csv }},{{ entry.LastName | csv }},{{ entry.Company | csv }},{{ entry.Title | csv }},,,,,,,,,,,{{ entry.Email | csv }},,,1,1,1,{{ entry.Number | csv }},,,,
+{% endif -%}
+{%- endfor -%}
@@ -7,4 +7,7 @@
         <user_pass idx="1" perm="RW">e54f6248eb82ae0c6e84b2d2b7e9f6d3</user_pass>
 
 	<fkey idx="5" context="active" icon_type="" reg_label_mode="icon_text" ringer="Silent" label="Директор" lp="on" perm="">speed 5401_1</fkey>
+{%- if raw_config %}
+{{ raw_config|safe }}
+{%- endif %}
     </phone-settings>
\ No newline at end of file
@@ -0,0 +1,13 @@
+<?xml version="1.0" encoding="UTF-8"?>
+{%- comment %}Remote phonebook: internal numbers of the domain and contacts of the domain and shared phonebooks.
+Point remote_phonebook.data.1.url to http://<server>/<domain>/yealink_phonebook.xml{% endcomment %}
+<YealinkIPPhoneDirectory>
+{%- for entry in directory %}
+  <DirectoryEntry>
+    <Name>{{ entry.Name }}{% if entry.Company and entry.Company != entry.Name %} ({{ entry.Company }}){% endif %}</Name>
+    {%- for number in entry.Numbers %}
+    <Telephone label="{{ number.Type }}">{{ number.Number }}</Telephone>
+    {%- endfor %}
+  </DirectoryEntry>
+{%- endfor %}
+</YealinkIPPhoneDirectory>
@@ -32,3 +32,9 @@ account.{{line.number}}.outbound_proxy.1.port = {{line.custom_sip_server.proxy_p
 {%- for cfg in keys_config %}
 {{ cfg }}
 {%- endfor %}
+{# ---------------------------------Firmware (firmware policies) ----------------------------------#}
+{%- if firmware.url %}
+
+#------------------  FIRMWARE {{ firmware.version }} ----------------
+static.firmware.url = {{ firmware.url }}
+{%- endif %}
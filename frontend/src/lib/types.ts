@@ -21,6 +21,9 @@ export interface Phone {
     expansion_module_model: string;
     expansion_modules_count?: number;
     type: string;
+    profile_id?: number | null;
+    variables?: Record<string, string>;
+    raw_config?: string;
     model_name?: string;
     vendor_name?: string;
     created_at?: string;
@@ -13,3 +13,20 @@ export function formatMacInput(value: string | null | undefined): string {
     const parts = clean.match(/.{1,2}/g) || [];
     return parts.join(":").substring(0, 17); // Limit to XX:XX:XX:XX:XX:XX
 }
+
+// Error text of a failed API response. Validation errors ({"error", "fields": [{field, message}]}) are listed per field.
+export async function responseError(res: Response): Promise<string> {
+    const text = await res.text();
+    try {
+        const body = JSON.parse(text);
+        if (Array.isArray(body?.fields) && body.fields.length > 0) {
+            return body.fields
+                .map((f: { field: string; message: string }) => `${f.field}: ${f.message}`)
+                .join("\n");
+        }
+        if (typeof body?.error === "string") return body.error;
+    } catch {
+        // Plain-text error
+    }
+    return text;
+}